@@ -5,6 +5,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/spirilis/generic-go-mcp/config"
@@ -61,6 +62,11 @@ func NewAuthService(cfg *config.AuthConfig) (*AuthService, error) {
 	return svc, nil
 }
 
+// Issuer returns the OAuth issuer URL the service advertises its routes under.
+func (svc *AuthService) Issuer() string {
+	return svc.config.Issuer
+}
+
 // Close closes the auth service and releases resources
 func (svc *AuthService) Close() error {
 	if svc.storage != nil {
@@ -81,6 +87,28 @@ type User struct {
 	Teams         []string `json:"teams,omitempty"` // Format: "org/team"
 }
 
+// InOrganization reports whether the user belonged to GitHub organization org when they
+// last logged in. Names compare case-insensitively, as GitHub's do.
+func (u *User) InOrganization(org string) bool {
+	for _, o := range u.Organizations {
+		if strings.EqualFold(o, org) {
+			return true
+		}
+	}
+	return false
+}
+
+// InTeam reports whether the user belonged to team, given as "org/team", when they last
+// logged in.
+func (u *User) InTeam(team string) bool {
+	for _, t := range u.Teams {
+		if strings.EqualFold(t, team) {
+			return true
+		}
+	}
+	return false
+}
+
 // AuthorizationCode represents a pending authorization code
 type AuthorizationCode struct {
 	Code                string    `json:"code"`
@@ -192,8 +192,25 @@ func (gc *GitHubClient) GetUserTeams(ctx context.Context, token string) ([]GitHu
 	return teams, nil
 }
 
+// githubMembership is a user's organizations and teams, fetched once per login and used
+// for both the allowlist check and User.Organizations/Teams. A failed fetch leaves its
+// error set and its slice nil.
+type githubMembership struct {
+	orgs     []GitHubOrg
+	orgsErr  error
+	teams    []GitHubTeam
+	teamsErr error
+}
+
+func (svc *AuthService) fetchMembership(ctx context.Context, token string) githubMembership {
+	var m githubMembership
+	m.orgs, m.orgsErr = svc.githubClient.GetUserOrgs(ctx, token)
+	m.teams, m.teamsErr = svc.githubClient.GetUserTeams(ctx, token)
+	return m
+}
+
 // isUserAuthorized checks if the user matches the allowlist
-func (svc *AuthService) isUserAuthorized(ctx context.Context, ghUser *GitHubUser, token string) bool {
+func (svc *AuthService) isUserAuthorized(ghUser *GitHubUser, m githubMembership) bool {
 	allowlist := svc.config.Allowlist
 
 	// If no allowlist configured, allow all authenticated users
@@ -209,30 +226,20 @@ func (svc *AuthService) isUserAuthorized(ctx context.Context, ghUser *GitHubUser
 	}
 
 	// Check organization membership
-	if len(allowlist.Orgs) > 0 || len(allowlist.Teams) > 0 {
-		orgs, err := svc.githubClient.GetUserOrgs(ctx, token)
-		if err == nil {
-			for _, org := range orgs {
-				for _, allowedOrg := range allowlist.Orgs {
-					if strings.EqualFold(allowedOrg, org.Login) {
-						return true
-					}
-				}
+	for _, org := range m.orgs {
+		for _, allowedOrg := range allowlist.Orgs {
+			if strings.EqualFold(allowedOrg, org.Login) {
+				return true
 			}
 		}
+	}
 
-		// Check team membership
-		if len(allowlist.Teams) > 0 {
-			teams, err := svc.githubClient.GetUserTeams(ctx, token)
-			if err == nil {
-				for _, team := range teams {
-					for _, allowedTeam := range allowlist.Teams {
-						if strings.EqualFold(allowedTeam.Org, team.Organization.Login) &&
-							strings.EqualFold(allowedTeam.Team, team.Slug) {
-							return true
-						}
-					}
-				}
+	// Check team membership
+	for _, team := range m.teams {
+		for _, allowedTeam := range allowlist.Teams {
+			if strings.EqualFold(allowedTeam.Org, team.Organization.Login) &&
+				strings.EqualFold(allowedTeam.Team, team.Slug) {
+				return true
 			}
 		}
 	}
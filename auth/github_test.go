@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/spirilis/generic-go-mcp/config"
+)
+
+// fakeGitHub serves the GitHub OAuth and API endpoints the callback uses, for the login
+// "alice" in organization "acme" and team "acme/ops", counting membership fetches.
+type fakeGitHub struct {
+	orgFetches, teamFetches atomic.Int32
+}
+
+func (f *fakeGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/login/oauth/access_token":
+		w.Write([]byte(`{"access_token":"gh-token","token_type":"bearer"}`))
+	case "/user":
+		w.Write([]byte(`{"id":1,"login":"alice"}`))
+	case "/user/orgs":
+		f.orgFetches.Add(1)
+		w.Write([]byte(`[{"id":10,"login":"acme"}]`))
+	case "/user/teams":
+		f.teamFetches.Add(1)
+		w.Write([]byte(`[{"id":20,"slug":"ops","organization":{"id":10,"login":"acme"}}]`))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// redirectTransport sends every request to target, whatever host it was addressed to.
+type redirectTransport struct{ target *url.URL }
+
+func (rt redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = rt.target.Scheme, rt.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestLoginFetchesMembershipOnce(t *testing.T) {
+	github := &fakeGitHub{}
+	ts := httptest.NewServer(github)
+	defer ts.Close()
+	target, _ := url.Parse(ts.URL)
+
+	svc, err := NewAuthService(&config.AuthConfig{
+		Enabled:   true,
+		Issuer:    "https://mcp.example.com",
+		Storage:   config.StorageConfig{DBPath: filepath.Join(t.TempDir(), "oauth.db")},
+		Allowlist: config.AllowlistConfig{Orgs: []string{"acme"}},
+		Clients: []config.StaticClient{
+			{ClientID: "cli", ClientSecret: "secret", RedirectURIs: []string{"http://localhost/cb"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewAuthService: %v", err)
+	}
+	defer svc.Close()
+	svc.githubClient.httpClient = &http.Client{Transport: redirectTransport{target}}
+	mux := http.NewServeMux()
+	svc.RegisterRoutes(mux)
+
+	login := func() {
+		t.Helper()
+		authorize := httptest.NewRecorder()
+		mux.ServeHTTP(authorize, httptest.NewRequest(http.MethodGet, "/authorize?"+url.Values{
+			"response_type":         {"code"},
+			"client_id":             {"cli"},
+			"redirect_uri":          {"http://localhost/cb"},
+			"code_challenge":        {strings.Repeat("a", 43)},
+			"code_challenge_method": {"S256"},
+		}.Encode(), nil))
+		toGitHub, err := url.Parse(authorize.Header().Get("Location"))
+		if authorize.Code != http.StatusFound || err != nil {
+			t.Fatalf("/authorize = %d, Location %q", authorize.Code, authorize.Header().Get("Location"))
+		}
+		callback := httptest.NewRecorder()
+		mux.ServeHTTP(callback, httptest.NewRequest(http.MethodGet, "/callback?"+url.Values{
+			"code":  {"gh-code"},
+			"state": {toGitHub.Query().Get("state")},
+		}.Encode(), nil))
+		if loc := callback.Header().Get("Location"); callback.Code != http.StatusFound || !strings.Contains(loc, "code=") {
+			t.Fatalf("/callback = %d, Location %q; want a redirect with a code", callback.Code, loc)
+		}
+	}
+
+	for i := int32(1); i <= 2; i++ {
+		login()
+		if orgs, teams := github.orgFetches.Load(), github.teamFetches.Load(); orgs != i || teams != i {
+			t.Fatalf("after %d logins: %d org and %d team fetches, want %d of each", i, orgs, teams, i)
+		}
+	}
+
+	user, err := svc.storage.GetUserByGitHubLogin(context.Background(), "alice")
+	if err != nil || user == nil {
+		t.Fatalf("GetUserByGitHubLogin = %v, %v", user, err)
+	}
+	if !user.InOrganization("ACME") || user.InOrganization("other") {
+		t.Errorf("InOrganization with Organizations %v: want acme only", user.Organizations)
+	}
+	if !user.InTeam("acme/ops") || user.InTeam("acme/dev") {
+		t.Errorf("InTeam with Teams %v: want acme/ops only", user.Teams)
+	}
+}
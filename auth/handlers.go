@@ -7,6 +7,27 @@ import (
 	"time"
 )
 
+// Routes returns the paths RegisterRoutes and RegisterAdminRoutes serve, relative to the
+// path prefix the HTTP transport mounts them under. The transport checks its WebSocket
+// path against them.
+func Routes() []string {
+	return []string{
+		"/.well-known/oauth-authorization-server",
+		"/.well-known/oauth-protected-resource",
+		"/register",
+		"/authorize",
+		"/token",
+		"/callback",
+		"/admin/clients",
+	}
+}
+
+// Routes returns the package's Routes, for the HTTP transport to check its own routes
+// against.
+func (svc *AuthService) Routes() []string {
+	return Routes()
+}
+
 // RegisterRoutes adds all OAuth endpoints to the mux
 func (svc *AuthService) RegisterRoutes(mux *http.ServeMux) {
 	// RFC 8414 - Authorization Server Metadata
@@ -145,7 +166,8 @@ func (svc *AuthService) handleGitHubCallback(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Check authorization (allowlist)
-	if !svc.isUserAuthorized(r.Context(), githubUser, githubToken) {
+	membership := svc.fetchMembership(r.Context(), githubToken)
+	if !svc.isUserAuthorized(githubUser, membership) {
 		svc.authError(w, authReq.RedirectURI, "access_denied",
 			"User not authorized", authReq.State)
 		return
@@ -171,6 +193,20 @@ func (svc *AuthService) handleGitHubCallback(w http.ResponseWriter, r *http.Requ
 			AvatarURL:   githubUser.AvatarURL,
 		}
 	}
+	// Refresh org and team membership for per-user authorization decisions (e.g. an
+	// mcp.ServerConfig.ToolVisible hook). Keep the last known values if GitHub fails us.
+	if membership.orgsErr == nil {
+		user.Organizations = make([]string, 0, len(membership.orgs))
+		for _, org := range membership.orgs {
+			user.Organizations = append(user.Organizations, org.Login)
+		}
+	}
+	if membership.teamsErr == nil {
+		user.Teams = make([]string, 0, len(membership.teams))
+		for _, team := range membership.teams {
+			user.Teams = append(user.Teams, team.Organization.Login+"/"+team.Slug)
+		}
+	}
 	svc.storage.StoreUser(r.Context(), user)
 
 	// Generate authorization code
@@ -0,0 +1,19 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRoutesMatchTheRegisteredHandlers(t *testing.T) {
+	svc := &AuthService{}
+	mux := http.NewServeMux()
+	svc.RegisterRoutes(mux)
+	svc.RegisterAdminRoutes(mux)
+	for _, route := range Routes() {
+		if _, pattern := mux.Handler(httptest.NewRequest(http.MethodGet, route, nil)); pattern != route {
+			t.Errorf("Routes lists %q, but the mux serves it as %q", route, pattern)
+		}
+	}
+}
@@ -2,7 +2,10 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -16,9 +19,10 @@ type Config struct {
 
 // ServerConfig represents server-specific configuration
 type ServerConfig struct {
-	Mode string      `yaml:"mode"` // "stdio", "http", or "unix"
+	Mode string      `yaml:"mode"` // "stdio", "http", "unix", or "tcp"
 	HTTP *HTTPConfig `yaml:"http,omitempty"`
 	Unix *UnixConfig `yaml:"unix,omitempty"`
+	TCP  *TCPConfig  `yaml:"tcp,omitempty"`
 }
 
 // HTTPConfig represents HTTP server configuration
@@ -30,6 +34,17 @@ type HTTPConfig struct {
 	// rebinding protection. If empty, only http(s)://localhost and http(s)://127.0.0.1
 	// are allowed. Use ["*"] to allow any origin (e.g. behind a trusted reverse proxy).
 	AllowedOrigins []string `yaml:"allowed_origins,omitempty"`
+
+	// WebSocketPath, if set (e.g. "/mcp/ws"), also serves the WebSocket binding at that
+	// path, subject to the same AllowedOrigins check and authentication as /mcp. It may not
+	// be /mcp itself or, with auth enabled, one of the OAuth or admin routes; the HTTP
+	// transport reports the latter when it starts.
+	WebSocketPath string `yaml:"websocket_path,omitempty"`
+
+	// PathPrefix, if set (e.g. "/v1"), serves /mcp, the WebSocket binding and the OAuth
+	// routes under it. It must start with "/" and not end with one, and with auth enabled,
+	// auth.issuer must end in it too.
+	PathPrefix string `yaml:"path_prefix,omitempty"`
 }
 
 // UnixConfig represents UNIX domain socket configuration
@@ -37,6 +52,13 @@ type UnixConfig struct {
 	SocketPath string `yaml:"socket_path"` // Required
 	Name       string `yaml:"name"`        // Required - exposed as /name resource
 	FileMode   uint32 `yaml:"file_mode"`   // Optional, default 0660
+
+	MaxConnections int    `yaml:"max_connections,omitempty"` // Optional, default 0 (no limit)
+	IdleTimeout    string `yaml:"idle_timeout,omitempty"`    // Optional Go duration, e.g. "10m"; default none
+	SingleClient   bool   `yaml:"single_client,omitempty"`   // Optional: a new connection replaces the previous one
+
+	AllowedUIDs []uint32 `yaml:"allowed_uids,omitempty"` // Optional: admit only these peer users (or AllowedGIDs); Linux only
+	AllowedGIDs []uint32 `yaml:"allowed_gids,omitempty"` // Optional: admit only peers with these primary groups (or AllowedUIDs)
 }
 
 // LoggingConfig represents logging configuration
@@ -90,6 +112,25 @@ type StaticClient struct {
 	Scopes       []string `yaml:"scopes,omitempty"`
 }
 
+// TCPConfig represents raw TCP (optionally TLS) server configuration
+type TCPConfig struct {
+	Host string `yaml:"host"` // Default: "127.0.0.1"
+	Port int    `yaml:"port"` // Required
+
+	MaxConnections int    `yaml:"max_connections,omitempty"` // Optional, default 0 (no limit)
+	IdleTimeout    string `yaml:"idle_timeout,omitempty"`    // Optional Go duration, e.g. "10m"; default none
+
+	TLS *TLSConfig `yaml:"tls,omitempty"` // Optional; plain TCP if omitted
+}
+
+// TLSConfig names the PEM files a TLS listener is served from. They are reloaded when
+// they change on disk.
+type TLSConfig struct {
+	CertFile     string `yaml:"cert_file"`                // Required
+	KeyFile      string `yaml:"key_file"`                 // Required
+	ClientCAFile string `yaml:"client_ca_file,omitempty"` // Optional: require client certificates signed by these CAs
+}
+
 // Load reads configuration from a YAML file
 func Load(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
@@ -123,6 +164,12 @@ func LoadFromBytes(data []byte) (*Config, error) {
 		if cfg.Server.HTTP.Port == 0 {
 			cfg.Server.HTTP.Port = 8080
 		}
+		if err := validateWebSocketPath(cfg.Server.HTTP.WebSocketPath); err != nil {
+			return nil, err
+		}
+		if err := validatePathPrefix(cfg.Server.HTTP.PathPrefix, cfg.Auth); err != nil {
+			return nil, err
+		}
 	}
 
 	// Validate and apply UNIX defaults
@@ -139,6 +186,32 @@ func LoadFromBytes(data []byte) (*Config, error) {
 		if cfg.Server.Unix.FileMode == 0 {
 			cfg.Server.Unix.FileMode = 0660
 		}
+		if cfg.Server.Unix.IdleTimeout != "" {
+			if _, err := time.ParseDuration(cfg.Server.Unix.IdleTimeout); err != nil {
+				return nil, fmt.Errorf("invalid idle_timeout for unix mode: %w", err)
+			}
+		}
+	}
+
+	// Validate and apply TCP defaults
+	if cfg.Server.Mode == "tcp" {
+		if cfg.Server.TCP == nil {
+			return nil, fmt.Errorf("tcp configuration required when mode is 'tcp'")
+		}
+		if cfg.Server.TCP.Port == 0 {
+			return nil, fmt.Errorf("port is required for tcp mode")
+		}
+		if cfg.Server.TCP.Host == "" {
+			cfg.Server.TCP.Host = "127.0.0.1"
+		}
+		if cfg.Server.TCP.IdleTimeout != "" {
+			if _, err := time.ParseDuration(cfg.Server.TCP.IdleTimeout); err != nil {
+				return nil, fmt.Errorf("invalid idle_timeout for tcp mode: %w", err)
+			}
+		}
+		if tls := cfg.Server.TCP.TLS; tls != nil && (tls.CertFile == "" || tls.KeyFile == "") {
+			return nil, fmt.Errorf("cert_file and key_file are required for tcp tls")
+		}
 	}
 
 	// Apply logging defaults
@@ -155,6 +228,40 @@ func LoadFromBytes(data []byte) (*Config, error) {
 	return &cfg, nil
 }
 
+// validateWebSocketPath rejects a websocket_path that is not a path or that would collide
+// with the /mcp endpoint. Collisions with the auth routes, which this package cannot see,
+// are left to the HTTP transport (see auth.Routes).
+func validateWebSocketPath(path string) error {
+	if path == "" {
+		return nil
+	}
+	if path[0] != '/' {
+		return fmt.Errorf("websocket_path must start with '/': %q", path)
+	}
+	if path == "/mcp" {
+		return fmt.Errorf("websocket_path must differ from the /mcp endpoint")
+	}
+	return nil
+}
+
+// validatePathPrefix rejects a path_prefix that cannot be joined into routes, or, with
+// auth enabled, that auth.issuer does not end in.
+func validatePathPrefix(prefix string, auth *AuthConfig) error {
+	if prefix == "" {
+		return nil
+	}
+	if !strings.HasPrefix(prefix, "/") || strings.HasSuffix(prefix, "/") {
+		return fmt.Errorf("path_prefix must start with '/' and not end with one: %q", prefix)
+	}
+	if auth != nil && auth.Enabled {
+		u, err := url.Parse(auth.Issuer)
+		if err != nil || !strings.HasSuffix(strings.TrimSuffix(u.Path, "/"), prefix) {
+			return fmt.Errorf("auth.issuer %q must end in path_prefix %q", auth.Issuer, prefix)
+		}
+	}
+	return nil
+}
+
 // LoadFromString parses configuration from a YAML string
 func LoadFromString(yamlContent string) (*Config, error) {
 	return LoadFromBytes([]byte(yamlContent))
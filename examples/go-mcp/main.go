@@ -8,6 +8,7 @@ import (
 	"os/signal"
 	"strconv"
 	"syscall"
+	"time"
 
 	"github.com/spirilis/generic-go-mcp/auth"
 	"github.com/spirilis/generic-go-mcp/config"
@@ -89,10 +90,10 @@ func applyCLIOverrides(cfg *config.Config, flags cliFlags) {
 func validateConfig(cfg *config.Config) error {
 	// Validate mode
 	switch cfg.Server.Mode {
-	case "stdio", "http", "unix":
+	case "stdio", "http", "unix", "tcp":
 		// Valid modes
 	default:
-		return fmt.Errorf("invalid mode '%s', must be stdio, http, or unix", cfg.Server.Mode)
+		return fmt.Errorf("invalid mode '%s', must be stdio, http, unix, or tcp", cfg.Server.Mode)
 	}
 
 	// Validate unix mode requirements
@@ -110,6 +111,23 @@ func validateConfig(cfg *config.Config) error {
 		if cfg.Server.Unix.FileMode == 0 {
 			cfg.Server.Unix.FileMode = 0660
 		}
+		if cfg.Server.Unix.IdleTimeout != "" {
+			if _, err := time.ParseDuration(cfg.Server.Unix.IdleTimeout); err != nil {
+				return fmt.Errorf("invalid idle_timeout for unix mode: %w", err)
+			}
+		}
+	}
+
+	// Validate tcp mode requirements
+	if cfg.Server.Mode == "tcp" {
+		if cfg.Server.TCP == nil || cfg.Server.TCP.Port == 0 {
+			return fmt.Errorf("tcp port is required for tcp mode")
+		}
+		if cfg.Server.TCP.IdleTimeout != "" {
+			if _, err := time.ParseDuration(cfg.Server.TCP.IdleTimeout); err != nil {
+				return fmt.Errorf("invalid idle_timeout for tcp mode: %w", err)
+			}
+		}
 	}
 
 	// Validate HTTP mode requirements
@@ -134,7 +152,7 @@ func validateConfig(cfg *config.Config) error {
 func main() {
 	// Define command-line flags
 	configPath := flag.String("config", "", "Path to configuration file (optional)")
-	mode := flag.String("mode", "", "Transport mode: stdio, http, unix")
+	mode := flag.String("mode", "", "Transport mode: stdio, http, unix, tcp")
 	unixSocket := flag.String("unix-socket", "", "Unix socket path")
 	unixName := flag.String("unix-name", "", "Server name for /name resource")
 	unixFileMode := flag.String("unix-filemode", "", "Socket permissions (octal, e.g., 0660)")
@@ -183,17 +201,37 @@ func main() {
 
 	// Create tool registry and register tools
 	registry := mcp.NewToolRegistry()
-	registry.Register(tools.GetDateToolDefinition(), tools.DateTool)
+	if err := mcp.RegisterTyped(registry, tools.GetDateToolDefinition(), tools.DateTool); err != nil {
+		logging.Error("Error registering tool", "error", err)
+		os.Exit(1)
+	}
 	registry.Register(tools.GetFortuneToolDefinition(), tools.FortuneTool)
-	registry.Register(tools.GetConfirmToolDefinition(), tools.ConfirmTool)
+	if err := mcp.RegisterTyped(registry, tools.GetConfirmToolDefinition(), tools.ConfirmTool); err != nil {
+		logging.Error("Error registering tool", "error", err)
+		os.Exit(1)
+	}
 
 	// Create resource registry
 	resourceRegistry := mcp.NewResourceRegistry()
 
+	// Create resource template registry, with timezone completions for time://{+timezone}
+	templateRegistry := mcp.NewResourceTemplateRegistry()
+	timeTemplate := tools.GetTimeTemplateDefinition()
+	if err := templateRegistry.Register(timeTemplate, tools.TimeTemplate); err != nil {
+		logging.Error("Error registering resource template", "error", err)
+		os.Exit(1)
+	}
+	templateRegistry.RegisterCompletion(timeTemplate.URITemplate, "timezone", mcp.CompleteFromList(tools.CommonTimezones))
+
 	// Create MCP server
 	server := mcp.NewServer(registry, resourceRegistry, &mcp.ServerConfig{
-		Name:    "go-mcp-example",
-		Version: "0.1.0",
+		Name:              "go-mcp-example",
+		Version:           "0.1.0",
+		ResourceTemplates: templateRegistry,
+		// In unix mode, callers are identified by the user on the other end of the socket,
+		// and in tcp mode with mutual TLS by their client certificate; elsewhere this is ""
+		// and every caller shares one principal.
+		PrincipalFromContext: transport.PeerPrincipal,
 	})
 
 	// Initialize auth service if enabled
@@ -219,6 +257,8 @@ func main() {
 			Host:           cfg.Server.HTTP.Host,
 			Port:           cfg.Server.HTTP.Port,
 			AllowedOrigins: cfg.Server.HTTP.AllowedOrigins,
+			WebSocketPath:  cfg.Server.HTTP.WebSocketPath,
+			PathPrefix:     cfg.Server.HTTP.PathPrefix,
 		}
 		// Only set AuthService when auth is actually enabled: assigning a nil
 		// *auth.AuthService unconditionally would store a typed nil in the
@@ -251,12 +291,36 @@ func main() {
 			return mcp.ResourceContentResult{Text: strconv.Itoa(os.Getpid())}, nil
 		})
 
+		// Checked by validateConfig; empty means no idle timeout.
+		idleTimeout, _ := time.ParseDuration(cfg.Server.Unix.IdleTimeout)
 		trans = transport.NewUnixTransport(transport.UnixTransportConfig{
-			SocketPath: cfg.Server.Unix.SocketPath,
-			FileMode:   os.FileMode(cfg.Server.Unix.FileMode),
+			SocketPath:     cfg.Server.Unix.SocketPath,
+			FileMode:       os.FileMode(cfg.Server.Unix.FileMode),
+			MaxConnections: cfg.Server.Unix.MaxConnections,
+			IdleTimeout:    idleTimeout,
+			SingleClient:   cfg.Server.Unix.SingleClient,
+			AllowedUIDs:    cfg.Server.Unix.AllowedUIDs,
+			AllowedGIDs:    cfg.Server.Unix.AllowedGIDs,
 		})
 		logging.Info("Starting MCP server in UNIX socket mode",
 			"socket", cfg.Server.Unix.SocketPath, "name", cfg.Server.Unix.Name)
+	case "tcp":
+		tcpCfg := transport.TCPTransportConfig{
+			Host:           cfg.Server.TCP.Host,
+			Port:           cfg.Server.TCP.Port,
+			MaxConnections: cfg.Server.TCP.MaxConnections,
+		}
+		// Checked by validateConfig; empty means no idle timeout.
+		tcpCfg.IdleTimeout, _ = time.ParseDuration(cfg.Server.TCP.IdleTimeout)
+		if tlsCfg := cfg.Server.TCP.TLS; tlsCfg != nil {
+			tcpCfg.TLS = &transport.TLSConfig{
+				CertFile:     tlsCfg.CertFile,
+				KeyFile:      tlsCfg.KeyFile,
+				ClientCAFile: tlsCfg.ClientCAFile,
+			}
+		}
+		trans = transport.NewTCPTransport(tcpCfg)
+		logging.Info("Starting MCP server in TCP mode", "host", tcpCfg.Host, "port", tcpCfg.Port, "tls", tcpCfg.TLS != nil)
 	default:
 		logging.Error("Unknown transport mode", "mode", cfg.Server.Mode)
 		os.Exit(1)
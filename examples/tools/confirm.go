@@ -10,7 +10,16 @@ import (
 
 // ConfirmArguments represents the arguments for the confirm_delete tool.
 type ConfirmArguments struct {
-	Count int `json:"count"`
+	Count int `json:"count" description:"Number of records to (pretend to) delete"`
+}
+
+// ConfirmResult is the structured output of a confirmed confirm_delete.
+type ConfirmResult struct {
+	Deleted int `json:"deleted" description:"Number of records deleted"`
+}
+
+func (r ConfirmResult) String() string {
+	return fmt.Sprintf("Deleted %d record(s)", r.Deleted)
 }
 
 var confirmSchema = json.RawMessage(`{
@@ -28,50 +37,32 @@ var confirmSchema = json.RawMessage(`{
 // elicitation/create request and a signed requestState. Retry the identical call (new
 // JSON-RPC id) with inputResponses.confirm = {"action":"accept","content":{"confirm":true}}
 // and requestState echoed back verbatim to see it complete.
-func ConfirmTool(ctx context.Context, req *mcp.ToolRequest) (mcp.Result, error) {
-	var args ConfirmArguments
-	if err := req.BindArguments(&args); err != nil {
-		return mcp.ErrorResultf("invalid arguments: %v", err), nil
-	}
-
+func ConfirmTool(ctx context.Context, req *mcp.ToolRequest, args ConfirmArguments) (ConfirmResult, error) {
 	if !req.ClientCapabilities.HasElicitation() {
-		return mcp.ErrorResultf("this tool requires elicitation support, which the client did not declare"), nil
+		return ConfirmResult{}, mcp.ReturnResult(mcp.ErrorResultf("this tool requires elicitation support, which the client did not declare"), nil)
 	}
 
 	answer, asked := req.ElicitResponse("confirm")
 	if !asked {
-		return req.NeedInput(mcp.InputRequests{
+		return ConfirmResult{}, mcp.ReturnResult(req.NeedInput(mcp.InputRequests{
 			"confirm": mcp.NewElicitRequest("form", fmt.Sprintf("Delete %d record(s)?", args.Count), confirmSchema),
-		})
+		}))
 	}
 	if !answer.Accepted() {
-		return mcp.ErrorResultf("cancelled by user"), nil
+		return ConfirmResult{}, mcp.ReturnResult(mcp.ErrorResultf("cancelled by user"), nil)
 	}
 
-	return &mcp.ToolCallResult{
-		Content: []mcp.Content{mcp.Text(fmt.Sprintf("Deleted %d record(s)", args.Count))},
-	}, nil
+	return ConfirmResult{Deleted: args.Count}, nil
 }
 
-// GetConfirmToolDefinition returns the MCP tool definition for confirm_delete.
+// GetConfirmToolDefinition returns the MCP tool definition for confirm_delete. Its
+// schemas are left empty for mcp.RegisterTyped to generate.
 func GetConfirmToolDefinition() mcp.Tool {
-	schema := json.RawMessage(`{
-		"type": "object",
-		"properties": {
-			"count": {
-				"type": "integer",
-				"description": "Number of records to (pretend to) delete"
-			}
-		},
-		"required": ["count"]
-	}`)
-
 	destructive := true
 	return mcp.Tool{
 		Name:        "confirm_delete",
 		Title:       "Confirm Delete (MRTR reference)",
 		Description: "Deletes N records, asking the user to confirm first via elicitation. Reference implementation of the Multi Round-Trip Requests (MRTR) pattern.",
-		InputSchema: schema,
 		Annotations: &mcp.ToolAnnotations{
 			DestructiveHint: &destructive,
 		},
@@ -2,7 +2,6 @@ package tools
 
 import (
 	"context"
-	"encoding/json"
 	"time"
 
 	"github.com/spirilis/generic-go-mcp/mcp"
@@ -10,18 +9,27 @@ import (
 
 // DateArguments represents the arguments for the date tool
 type DateArguments struct {
-	Timezone string `json:"timezone"`
+	Timezone string `json:"timezone" description:"IANA timezone name (e.g., 'America/New_York', 'Europe/London', 'Asia/Tokyo')"`
+}
+
+// DateResult is the structured output of the date tool. Its String form, the
+// human-readable time, is what the tool's text content block carries.
+type DateResult struct {
+	ISO8601  string `json:"iso8601" description:"Current time in RFC 3339 / ISO 8601 format"`
+	Timezone string `json:"timezone" description:"Resolved IANA timezone name"`
+
+	formatted string
+}
+
+func (r DateResult) String() string {
+	return r.formatted
 }
 
 // DateTool returns the current date/time in the specified timezone, as both a
 // human-readable text block and structured content — the reference example for a tool
-// that returns structuredContent alongside an outputSchema.
-func DateTool(ctx context.Context, req *mcp.ToolRequest) (mcp.Result, error) {
-	var args DateArguments
-	if err := req.BindArguments(&args); err != nil {
-		return mcp.ErrorResultf("invalid arguments: %v", err), nil
-	}
-
+// registered with mcp.RegisterTyped, whose input and output schemas are generated from
+// DateArguments and DateResult.
+func DateTool(ctx context.Context, req *mcp.ToolRequest, args DateArguments) (DateResult, error) {
 	// Default to UTC if no timezone specified
 	timezone := args.Timezone
 	if timezone == "" {
@@ -31,58 +39,59 @@ func DateTool(ctx context.Context, req *mcp.ToolRequest) (mcp.Result, error) {
 	// Load the timezone
 	loc, err := time.LoadLocation(timezone)
 	if err != nil {
-		return mcp.ErrorResultf("invalid timezone: %v", err), nil
+		return DateResult{}, mcp.ReturnResult(mcp.ErrorResultf("invalid timezone: %v", err), nil)
 	}
 
 	// Get current time in the specified timezone
 	now := time.Now().In(loc)
-	formatted := now.Format("2006-01-02 15:04:05 MST")
-
-	return &mcp.ToolCallResult{
-		Content: []mcp.Content{mcp.Text(formatted)},
-		StructuredContent: map[string]interface{}{
-			"iso8601":  now.Format(time.RFC3339),
-			"timezone": loc.String(),
-		},
+	return DateResult{
+		ISO8601:   now.Format(time.RFC3339),
+		Timezone:  loc.String(),
+		formatted: now.Format("2006-01-02 15:04:05 MST"),
 	}, nil
 }
 
-// GetDateToolDefinition returns the MCP tool definition for date
+// GetDateToolDefinition returns the MCP tool definition for date. Its schemas are left
+// empty for mcp.RegisterTyped to generate.
 func GetDateToolDefinition() mcp.Tool {
-	inputSchema := json.RawMessage(`{
-		"type": "object",
-		"properties": {
-			"timezone": {
-				"type": "string",
-				"description": "IANA timezone name (e.g., 'America/New_York', 'Europe/London', 'Asia/Tokyo')"
-			}
-		},
-		"required": ["timezone"]
-	}`)
-
-	outputSchema := json.RawMessage(`{
-		"type": "object",
-		"properties": {
-			"iso8601": {
-				"type": "string",
-				"description": "Current time in RFC 3339 / ISO 8601 format"
-			},
-			"timezone": {
-				"type": "string",
-				"description": "Resolved IANA timezone name"
-			}
-		},
-		"required": ["iso8601", "timezone"]
-	}`)
-
 	return mcp.Tool{
-		Name:         "date",
-		Title:        "Current Date/Time",
-		Description:  "Returns the current date and time in the specified timezone",
-		InputSchema:  inputSchema,
-		OutputSchema: outputSchema,
+		Name:        "date",
+		Title:       "Current Date/Time",
+		Description: "Returns the current date and time in the specified timezone",
 		Annotations: &mcp.ToolAnnotations{
 			ReadOnlyHint: true,
 		},
 	}
 }
+
+// CommonTimezones is the list of IANA timezone names offered as completions for the
+// time://{+timezone} resource template. It is a convenience, not a limit: any name
+// time.LoadLocation accepts can be read.
+var CommonTimezones = []string{
+	"UTC",
+	"America/New_York", "America/Chicago", "America/Denver", "America/Los_Angeles",
+	"America/Sao_Paulo", "Europe/London", "Europe/Paris", "Europe/Berlin", "Africa/Johannesburg",
+	"Asia/Kolkata", "Asia/Shanghai", "Asia/Tokyo", "Australia/Sydney", "Pacific/Auckland",
+}
+
+// TimeTemplate serves time://{+timezone}: the current time in that timezone, as a resource
+// rather than a tool call — the reference example for a resource template whose variable
+// has completion/complete suggestions attached (see CommonTimezones).
+func TimeTemplate(ctx context.Context, req *mcp.ResourceRequest) (mcp.ResourceContentResult, error) {
+	loc, err := time.LoadLocation(req.Variable("timezone"))
+	if err != nil {
+		return mcp.ResourceContentResult{}, err
+	}
+	return mcp.ResourceContentResult{Text: time.Now().In(loc).Format(time.RFC3339)}, nil
+}
+
+// GetTimeTemplateDefinition returns the MCP resource template definition for
+// time://{+timezone}.
+func GetTimeTemplateDefinition() mcp.ResourceTemplate {
+	return mcp.ResourceTemplate{
+		URITemplate: "time://{+timezone}",
+		Name:        "Current time in a timezone",
+		Description: "The current time, RFC 3339 formatted, in the IANA timezone named by the URI",
+		MimeType:    "text/plain",
+	}
+}
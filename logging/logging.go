@@ -105,6 +105,16 @@ func Error(msg string, args ...any) {
 	}
 }
 
+// Handler returns the handler behind the global logger, for building derived loggers that
+// still write through it (e.g. mcp's request-scoped tool logger). Before Initialize it is
+// a handler that discards everything, matching the package-level functions' no-op.
+func Handler() slog.Handler {
+	if logger == nil {
+		return slog.DiscardHandler
+	}
+	return logger.Handler()
+}
+
 // IsTraceEnabled returns true if trace logging is enabled
 func IsTraceEnabled() bool {
 	return level <= LevelTrace
@@ -2,8 +2,9 @@ package mcp
 
 import "encoding/json"
 
-// ToolsCapability, ResourcesCapability, PromptsCapability, and ServerCapabilities mirror
-// the server-side capability objects returned from server/discover.
+// ToolsCapability, ResourcesCapability, PromptsCapability, CompletionsCapability,
+// LoggingCapability, and ServerCapabilities mirror the server-side capability objects
+// returned from server/discover.
 
 type ToolsCapability struct {
 	ListChanged bool `json:"listChanged,omitempty"`
@@ -18,12 +19,20 @@ type PromptsCapability struct {
 	ListChanged bool `json:"listChanged,omitempty"`
 }
 
+type CompletionsCapability struct{}
+
+type LoggingCapability struct{}
+
 // ServerCapabilities describes what this server supports. Tools/Resources/Prompts are
 // only present when the corresponding registry actually has entries to serve — an empty
 // registry declares no capability for it, rather than an always-present empty object.
+// Completions likewise appears only once some completion provider is attached, and
+// Logging alongside Tools, since tools are what log to the client.
 type ServerCapabilities struct {
-	Tools      *ToolsCapability           `json:"tools,omitempty"`
-	Resources  *ResourcesCapability       `json:"resources,omitempty"`
-	Prompts    *PromptsCapability         `json:"prompts,omitempty"`
-	Extensions map[string]json.RawMessage `json:"extensions,omitempty"`
+	Tools       *ToolsCapability           `json:"tools,omitempty"`
+	Resources   *ResourcesCapability       `json:"resources,omitempty"`
+	Prompts     *PromptsCapability         `json:"prompts,omitempty"`
+	Completions *CompletionsCapability     `json:"completions,omitempty"`
+	Logging     *LoggingCapability         `json:"logging,omitempty"`
+	Extensions  map[string]json.RawMessage `json:"extensions,omitempty"`
 }
@@ -0,0 +1,186 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/spirilis/generic-go-mcp/transport"
+)
+
+// Completion reference types: what a completion/complete request is completing an
+// argument of.
+const (
+	CompletionRefPrompt   = "ref/prompt"
+	CompletionRefResource = "ref/resource"
+)
+
+// maxCompletionValues is the spec's cap on how many values one completion result may
+// carry.
+const maxCompletionValues = 100
+
+// CompletionReference names the prompt (Type CompletionRefPrompt, Name set) or resource
+// template (Type CompletionRefResource, URI set to the URI template) whose argument is
+// being completed.
+type CompletionReference struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+	URI  string `json:"uri,omitempty"`
+}
+
+// CompletionRequest carries everything a CompletionFunction needs about the
+// completion/complete in progress.
+type CompletionRequest struct {
+	Ref      CompletionReference
+	Argument string // name of the prompt argument or template variable being completed
+	Value    string // what the user has typed so far
+
+	// Arguments holds the values of the prompt's or template's other arguments, where the
+	// client has already resolved them — useful when one argument's candidates depend on
+	// another's.
+	Arguments          map[string]string
+	Meta               *RequestMeta
+	ClientCapabilities *ClientCapabilities
+}
+
+// CompletionResult is what a CompletionFunction returns. Values beyond the spec's limit of
+// 100 are truncated by the server, which then sets HasMore and, if it was left zero,
+// Total. Total is omitted from the wire when zero.
+type CompletionResult struct {
+	Values  []string
+	Total   int
+	HasMore bool
+}
+
+// CompletionFunction suggests values for one prompt argument or template variable. A
+// non-nil error is a protocol-level failure (-32603).
+type CompletionFunction func(ctx context.Context, req *CompletionRequest) (CompletionResult, error)
+
+// CompleteFromList returns a CompletionFunction suggesting every entry of values that
+// starts with what the user has typed so far, ignoring case, in the order given.
+func CompleteFromList(values []string) CompletionFunction {
+	return func(ctx context.Context, req *CompletionRequest) (CompletionResult, error) {
+		prefix := strings.ToLower(req.Value)
+		var out []string
+		for _, v := range values {
+			if strings.HasPrefix(strings.ToLower(v), prefix) {
+				out = append(out, v)
+			}
+		}
+		return CompletionResult{Values: out}, nil
+	}
+}
+
+// completionProviders is the per-registry store of CompletionFunctions, keyed by the
+// registered entry's key (prompt name or URI template) and then by argument name. It is
+// deliberately independent of the entry itself, so re-registering a prompt or template
+// keeps the completions already attached to it. Callers hold the owning registry's lock.
+type completionProviders map[string]map[string]CompletionFunction
+
+func (c completionProviders) set(key, argument string, fn CompletionFunction) {
+	if c[key] == nil {
+		c[key] = make(map[string]CompletionFunction)
+	}
+	c[key][argument] = fn
+}
+
+func (c completionProviders) remove(key, argument string) bool {
+	if _, ok := c[key][argument]; !ok {
+		return false
+	}
+	delete(c[key], argument)
+	if len(c[key]) == 0 {
+		delete(c, key)
+	}
+	return true
+}
+
+func (c completionProviders) get(key, argument string) CompletionFunction {
+	return c[key][argument]
+}
+
+// CompletionContext is the optional context of a completion/complete request.
+type CompletionContext struct {
+	Arguments map[string]string `json:"arguments,omitempty"`
+}
+
+// CompleteParams is the params of a completion/complete request.
+type CompleteParams struct {
+	Ref      CompletionReference `json:"ref"`
+	Argument struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	} `json:"argument"`
+	Context *CompletionContext `json:"context,omitempty"`
+}
+
+// CompletionValues is the completion object of a completion/complete result.
+type CompletionValues struct {
+	Values  []string `json:"values"`
+	Total   int      `json:"total,omitempty"`
+	HasMore bool     `json:"hasMore,omitempty"`
+}
+
+// CompleteResult is the result of completion/complete. Like prompts/get it carries no
+// caching hints: its content depends on what the user has typed.
+type CompleteResult struct {
+	BaseResult
+	Completion CompletionValues `json:"completion"`
+}
+
+func (s *Server) handleComplete(ctx context.Context, meta *RequestMeta, params json.RawMessage) (Result, *transport.RPCError) {
+	var p CompleteParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, invalidParamsErr("invalid completion/complete params: %v", err)
+	}
+
+	var fn CompletionFunction
+	switch p.Ref.Type {
+	case CompletionRefPrompt:
+		if _, ok := s.promptRegistry.Get(p.Ref.Name); !ok {
+			return nil, invalidParamsErr("Unknown prompt: %s", p.Ref.Name)
+		}
+		fn = s.promptRegistry.completion(p.Ref.Name, p.Argument.Name)
+	case CompletionRefResource:
+		if _, ok := s.templateRegistry.Get(p.Ref.URI); !ok {
+			return nil, invalidParamsErr("Unknown resource template: %s", p.Ref.URI)
+		}
+		fn = s.templateRegistry.completion(p.Ref.URI, p.Argument.Name)
+	default:
+		return nil, invalidParamsErr("invalid completion reference type %q", p.Ref.Type)
+	}
+
+	// An argument nobody attached a provider to simply has no suggestions.
+	if fn == nil {
+		return &CompleteResult{Completion: CompletionValues{Values: []string{}}}, nil
+	}
+
+	req := &CompletionRequest{
+		Ref:                p.Ref,
+		Argument:           p.Argument.Name,
+		Value:              p.Argument.Value,
+		Meta:               meta,
+		ClientCapabilities: meta.ClientCapabilities,
+	}
+	if p.Context != nil {
+		req.Arguments = p.Context.Arguments
+	}
+
+	res, err := fn(ctx, req)
+	if err != nil {
+		return nil, internalErr(err)
+	}
+
+	values := res.Values
+	if values == nil {
+		values = []string{}
+	}
+	if len(values) > maxCompletionValues {
+		if res.Total == 0 {
+			res.Total = len(values)
+		}
+		values = values[:maxCompletionValues]
+		res.HasMore = true
+	}
+	return &CompleteResult{Completion: CompletionValues{Values: values, Total: res.Total, HasMore: res.HasMore}}, nil
+}
@@ -1,9 +1,18 @@
 package mcp
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -282,6 +291,165 @@ func TestResourcesReadRoundTrip(t *testing.T) {
 	}
 }
 
+func TestResourcesReadMultiPartAndStreamed(t *testing.T) {
+	resources := NewResourceRegistry()
+	resources.RegisterContents(Resource{URI: "file:///dir/", Name: "dir", MimeType: "text/plain"},
+		func(ctx context.Context, req *ResourceRequest) ([]ResourceContent, error) {
+			return []ResourceContent{
+				{URI: "file:///dir/a.txt", Text: "alpha"},
+				{URI: "file:///dir/b.bin", MimeType: "application/octet-stream", Blob: "AAEC"},
+			}, nil
+		})
+	declared := int64(1)
+	resources.RegisterContents(Resource{URI: "file:///liar/", Name: "liar"},
+		func(ctx context.Context, req *ResourceRequest) ([]ResourceContent, error) {
+			return []ResourceContent{{Text: strings.Repeat("x", 1000), Size: &declared}}, nil
+		})
+	resources.RegisterContents(Resource{URI: "file:///empty/", Name: "empty"},
+		func(ctx context.Context, req *ResourceRequest) ([]ResourceContent, error) {
+			return nil, nil
+		})
+	path := filepath.Join(t.TempDir(), "big.bin")
+	payload := bytes.Repeat([]byte{0xAB}, 1000)
+	if err := os.WriteFile(path, payload, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	stream := func(ctx context.Context, req *ResourceRequest) (*ResourceStream, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		return &ResourceStream{Reader: f, MimeType: "application/octet-stream"}, nil
+	}
+	resources.RegisterStream(Resource{URI: "file:///big.bin", Name: "big"}, stream)
+	resources.RegisterStream(Resource{URI: "file:///pipe", Name: "pipe"},
+		func(ctx context.Context, req *ResourceRequest) (*ResourceStream, error) {
+			return &ResourceStream{Reader: bytes.NewReader(payload), Text: true}, nil
+		})
+	srv := NewServer(NewToolRegistry(), resources, &ServerConfig{MaxResourceSize: 999})
+
+	read := func(uri string) (ResourcesReadResult, *rpcErrorBody) {
+		env := call(t, srv, 1, "resources/read", map[string]interface{}{"_meta": validMeta(), "uri": uri})
+		var result ResourcesReadResult
+		if env.Error == nil {
+			if err := json.Unmarshal(env.Result, &result); err != nil {
+				t.Fatalf("unmarshal result: %v", err)
+			}
+		}
+		return result, env.Error
+	}
+
+	result, rpcErr := read("file:///dir/")
+	if rpcErr != nil || len(result.Contents) != 2 {
+		t.Fatalf("multi-part read = %+v, %+v; want 2 contents", result, rpcErr)
+	}
+	a, b := result.Contents[0], result.Contents[1]
+	if a.URI != "file:///dir/a.txt" || a.MimeType != "text/plain" || a.Size == nil || *a.Size != 5 {
+		t.Errorf("first part = %+v, want its own URI, the registered mime type, and size 5", a)
+	}
+	if b.MimeType != "application/octet-stream" || b.Size == nil || *b.Size != 3 {
+		t.Errorf("second part = %+v, want its own mime type and the decoded size 3", b)
+	}
+
+	// A part cannot talk its way under the limit by declaring a small Size.
+	if _, rpcErr := read("file:///liar/"); rpcErr == nil || rpcErr.Code != transport.InternalError {
+		t.Errorf("over-limit part declaring Size 1 = %+v, want -32603", rpcErr)
+	}
+	// A directory with nothing in it is no contents entries, not one empty text entry.
+	if result, rpcErr := read("file:///empty/"); rpcErr != nil || len(result.Contents) != 0 {
+		t.Errorf("empty multi-part read = %+v, %+v; want no contents", result, rpcErr)
+	}
+
+	// 1000 bytes against a 999-byte limit: refused from the file's size, unread.
+	if _, rpcErr := read("file:///big.bin"); rpcErr == nil || rpcErr.Code != transport.InternalError {
+		t.Errorf("over-limit file read error = %+v, want -32603", rpcErr)
+	}
+	// The same with no size to go on: refused once reading passes the limit.
+	if _, rpcErr := read("file:///pipe"); rpcErr == nil || rpcErr.Code != transport.InternalError {
+		t.Errorf("over-limit stream read error = %+v, want -32603", rpcErr)
+	}
+
+	resources.RegisterStream(Resource{URI: "file:///big.bin", Name: "big"}, stream)
+	srv = NewServer(NewToolRegistry(), resources, nil)
+	result, rpcErr = read("file:///big.bin")
+	if rpcErr != nil || len(result.Contents) != 1 {
+		t.Fatalf("streamed read = %+v, %+v", result, rpcErr)
+	}
+	c := result.Contents[0]
+	if got, _ := base64.StdEncoding.DecodeString(c.Blob); !bytes.Equal(got, payload) {
+		t.Errorf("streamed blob decodes to %d bytes, want the file's %d", len(got), len(payload))
+	}
+	if c.Size == nil || *c.Size != 1000 || c.Annotations == nil || c.Annotations.LastModified != "2026-01-02T03:04:05Z" {
+		t.Errorf("streamed entry = size %v, annotations %+v; want 1000 and the file's mtime", c.Size, c.Annotations)
+	}
+}
+
+func TestConditionalReadAndContentCache(t *testing.T) {
+	resources := NewResourceRegistry()
+	reads := 0
+	resources.RegisterCached(Resource{URI: "test:///cached", Name: "cached"},
+		func(ctx context.Context, req *ResourceRequest) (ResourceContentResult, error) {
+			reads++
+			return ResourceContentResult{Text: fmt.Sprintf("read %d", reads)}, nil
+		})
+	resources.RegisterReader(Resource{URI: "test:///versioned", Name: "versioned"},
+		func(ctx context.Context, req *ResourceRequest) (ResourceContentResult, error) {
+			return ResourceContentResult{Text: "body", Version: "v1"}, nil
+		})
+	srv := NewServer(NewToolRegistry(), resources, nil)
+
+	read := func(ctx context.Context, uri, known string) (ResourcesReadResult, string, bool) {
+		t.Helper()
+		meta := validMeta()
+		if known != "" {
+			meta[MetaKeyResourceVersion] = known
+		}
+		w := transport.NewBufferedResponseWriter()
+		srv.HandleMessage(ctx, buildRequest(t, 1, "resources/read", map[string]interface{}{"_meta": meta, "uri": uri}), w)
+		var env rpcResponseEnvelope
+		if err := json.Unmarshal(w.Message(), &env); err != nil || env.Error != nil {
+			t.Fatalf("resources/read %s = %s, %v", uri, w.Message(), err)
+		}
+		var result ResourcesReadResult
+		if err := json.Unmarshal(env.Result, &result); err != nil {
+			t.Fatalf("unmarshal result: %v", err)
+		}
+		version, _ := result.Meta[MetaKeyResourceVersion].(string)
+		notModified, _ := result.Meta[MetaKeyNotModified].(bool)
+		return result, version, notModified
+	}
+	bg := context.Background()
+
+	first, v1, _ := read(bg, "test:///cached", "")
+	if v1 == "" || len(first.Contents) != 1 || first.Contents[0].Text != "read 1" {
+		t.Fatalf("first read = %+v, version %q; want content and a derived version", first.Contents, v1)
+	}
+	if again, v, _ := read(bg, "test:///cached", ""); v != v1 || again.Contents[0].Text != "read 1" || reads != 1 {
+		t.Errorf("second read = %+v, version %q, %d calls; want the cached content", again.Contents, v, reads)
+	}
+	if result, v, notModified := read(bg, "test:///cached", v1); !notModified || v != v1 || len(result.Contents) != 0 {
+		t.Errorf("conditional read = %+v, version %q, notModified %v; want an empty not-modified result", result.Contents, v, notModified)
+	}
+
+	resources.NotifyUpdated("test:///cached")
+	if result, v, notModified := read(bg, "test:///cached", v1); notModified || v == v1 || result.Contents[0].Text != "read 2" {
+		t.Errorf("read after NotifyUpdated = %+v, version %q, notModified %v; want fresh content under a new version", result.Contents, v, notModified)
+	}
+
+	// Over Streamable HTTP the known version may arrive as If-None-Match instead.
+	ctx := transport.WithRequestHeaders(bg, transport.RequestHeaders{Values: map[string]string{transport.IfNoneMatchHeader: `W/"v1"`}})
+	if _, v, notModified := read(ctx, "test:///versioned", ""); !notModified || v != "v1" {
+		t.Errorf("read with If-None-Match = version %q, notModified %v; want not modified", v, notModified)
+	}
+	if result, _, notModified := read(bg, "test:///versioned", "v0"); notModified || len(result.Contents) != 1 {
+		t.Errorf("read with a stale version = %+v, notModified %v; want the content", result.Contents, notModified)
+	}
+}
+
 func TestFailingToolReportsIsError(t *testing.T) {
 	srv, _, _ := newTestServer(t)
 	env := call(t, srv, 1, "tools/call", map[string]interface{}{
@@ -391,36 +559,191 @@ func TestMRTRRoundTrip(t *testing.T) {
 	}
 }
 
-func TestPaginationRoundTrip(t *testing.T) {
-	items := make([]int, 205)
-	for i := range items {
-		items[i] = i
+func TestResourceReadMRTRRoundTrip(t *testing.T) {
+	srv, _, resources := newTestServer(t)
+	for _, uri := range []string{"config:///current", "config:///other"} {
+		resources.RegisterReader(Resource{URI: uri, Name: "tenant config"},
+			func(ctx context.Context, req *ResourceRequest) (ResourceContentResult, error) {
+				if v, ok := req.ElicitResponse("tenant"); ok && v.Accepted() {
+					var answer struct {
+						Tenant string `json:"tenant"`
+					}
+					_ = json.Unmarshal(v.Content, &answer)
+					return ResourceContentResult{Text: "config for " + answer.Tenant}, nil
+				}
+				return req.NeedInput(InputRequests{
+					"tenant": NewElicitRequest("form", "which tenant?", json.RawMessage(`{"type":"object"}`)),
+				})
+			})
 	}
 
-	var cursor string
-	var seen []int
-	for {
-		page, next, err := paginate(items, cursor, 50)
-		if err != nil {
-			t.Fatalf("paginate: %v", err)
+	capsWithElicitation := map[string]interface{}{"elicitation": map[string]interface{}{}}
+	accepted := map[string]interface{}{
+		"tenant": map[string]interface{}{"action": "accept", "content": map[string]interface{}{"tenant": "acme"}},
+	}
+
+	env := call(t, srv, 1, "resources/read", map[string]interface{}{"_meta": validMeta(), "uri": "config:///current"})
+	if env.Error == nil || env.Error.Code != transport.MissingRequiredClientCapability {
+		t.Fatalf("expected MissingRequiredClientCapability, got %+v", env.Error)
+	}
+
+	env = call(t, srv, 2, "resources/read", map[string]interface{}{
+		"_meta": metaObject(ProtocolVersion, capsWithElicitation), "uri": "config:///current",
+	})
+	if env.Error != nil {
+		t.Fatalf("unexpected error: %+v", env.Error)
+	}
+	var interim InputRequiredResult
+	if err := json.Unmarshal(env.Result, &interim); err != nil {
+		t.Fatalf("unmarshal interim result: %v", err)
+	}
+	if interim.ResultType != ResultTypeInputRequired || interim.RequestState == "" {
+		t.Fatalf("interim = %+v, want input_required with a requestState", interim)
+	}
+	if _, ok := interim.InputRequests["tenant"]; !ok {
+		t.Errorf("inputRequests = %v, want a \"tenant\" entry", interim.InputRequests)
+	}
+
+	env = call(t, srv, 3, "resources/read", map[string]interface{}{
+		"_meta": metaObject(ProtocolVersion, capsWithElicitation), "uri": "config:///current",
+		"inputResponses": accepted, "requestState": interim.RequestState,
+	})
+	if env.Error != nil {
+		t.Fatalf("unexpected error on retry: %+v", env.Error)
+	}
+	var final ResourcesReadResult
+	if err := json.Unmarshal(env.Result, &final); err != nil {
+		t.Fatalf("unmarshal final result: %v", err)
+	}
+	if final.ResultType != ResultTypeComplete || len(final.Contents) != 1 || final.Contents[0].Text != "config for acme" {
+		t.Errorf("final = %+v, want the acme config", final)
+	}
+
+	// The requestState is bound to the URI it was issued for: replaying it against a
+	// different resource is rejected, as is a blob issued for a tools/call.
+	env = call(t, srv, 4, "resources/read", map[string]interface{}{
+		"_meta": metaObject(ProtocolVersion, capsWithElicitation), "uri": "config:///other",
+		"inputResponses": accepted, "requestState": interim.RequestState,
+	})
+	if env.Error == nil || env.Error.Code != transport.InvalidParams {
+		t.Errorf("requestState replayed on another URI: error = %+v, want code %d", env.Error, transport.InvalidParams)
+	}
+	toolState := srv.signRequestState("", "tools/call", "config:///current", nil)
+	env = call(t, srv, 5, "resources/read", map[string]interface{}{
+		"_meta": metaObject(ProtocolVersion, capsWithElicitation), "uri": "config:///current",
+		"inputResponses": accepted, "requestState": toolState,
+	})
+	if env.Error == nil || env.Error.Code != transport.InvalidParams {
+		t.Errorf("tools/call requestState on resources/read: error = %+v, want code %d", env.Error, transport.InvalidParams)
+	}
+}
+
+// listNames pages through method with srv, starting from cursor, and returns the names (or
+// URIs) it saw and the cursor each page ended on.
+func listNames(t *testing.T, srv *Server, method, cursor string, pages int) (names []string, cursors []string) {
+	t.Helper()
+	for i := 0; i < pages || pages < 0; i++ {
+		params := map[string]interface{}{"_meta": validMeta()}
+		if cursor != "" {
+			params["cursor"] = cursor
 		}
-		seen = append(seen, page...)
-		if next == "" {
+		env := call(t, srv, i+1, method, params)
+		if env.Error != nil {
+			t.Fatalf("%s page %d: %+v", method, i, env.Error)
+		}
+		var page struct {
+			Tools      []Tool     `json:"tools"`
+			Resources  []Resource `json:"resources"`
+			NextCursor string     `json:"nextCursor"`
+		}
+		if err := json.Unmarshal(env.Result, &page); err != nil {
+			t.Fatalf("unmarshal %s: %v", method, err)
+		}
+		for _, tool := range page.Tools {
+			names = append(names, tool.Name)
+		}
+		for _, res := range page.Resources {
+			names = append(names, res.URI)
+		}
+		cursor = page.NextCursor
+		cursors = append(cursors, cursor)
+		if cursor == "" {
 			break
 		}
-		cursor = next
 	}
-	if len(seen) != len(items) {
-		t.Fatalf("got %d items across all pages, want %d", len(seen), len(items))
+	return names, cursors
+}
+
+func TestPaginationRoundTrip(t *testing.T) {
+	registry := NewToolRegistry()
+	for i := 0; i < 205; i++ {
+		registry.Register(Tool{Name: fmt.Sprintf("t%03d", i), InputSchema: json.RawMessage(`{"type":"object"}`)}, nil)
+	}
+	srv := NewServer(registry, NewResourceRegistry(), nil)
+
+	names, cursors := listNames(t, srv, "tools/list", "", -1)
+	if len(cursors) != 5 {
+		t.Errorf("got %d pages, want 5 of at most 50", len(cursors))
+	}
+	if len(names) != 205 {
+		t.Fatalf("got %d tools across all pages, want 205", len(names))
 	}
-	for i, v := range seen {
-		if v != items[i] {
-			t.Fatalf("seen[%d] = %d, want %d", i, v, items[i])
+	for i, name := range names {
+		if want := fmt.Sprintf("t%03d", i); name != want {
+			t.Fatalf("names[%d] = %s, want %s", i, name, want)
 		}
 	}
 
-	if _, _, err := paginate(items, "not-a-valid-cursor!!", 50); err == nil {
-		t.Fatal("expected an error for an invalid cursor")
+	env := call(t, srv, 1, "tools/list", map[string]interface{}{"_meta": validMeta(), "cursor": "not-a-valid-cursor!!"})
+	if env.Error == nil || env.Error.Code != transport.InvalidParams {
+		t.Fatalf("invalid cursor = %+v, want -32602", env.Error)
+	}
+}
+
+func TestPaginationCursorsSurviveMutation(t *testing.T) {
+	registry := NewToolRegistry()
+	for i := 0; i < 10; i++ {
+		registry.Register(Tool{Name: fmt.Sprintf("t%d", i), InputSchema: json.RawMessage(`{"type":"object"}`)}, nil)
+	}
+	resources := NewResourceRegistry()
+	for i := 0; i < 10; i++ {
+		resources.Register(Resource{URI: fmt.Sprintf("test:///%d", i), Name: "r"}, nil)
+	}
+	srv := NewServer(registry, resources, &ServerConfig{PageSize: 4, PageSizes: map[string]int{"tools/list": 3}})
+
+	first, cursors := listNames(t, srv, "tools/list", "", 1)
+	if fmt.Sprint(first) != "[t0 t1 t2]" {
+		t.Fatalf("first page = %v, want the per-method page size of 3", first)
+	}
+	// Remove one entry already seen and one still ahead, and add another, between pages:
+	// an offset cursor would now skip t3's successor.
+	registry.Unregister("t1")
+	registry.Unregister("t3")
+	registry.Register(Tool{Name: "t10", InputSchema: json.RawMessage(`{"type":"object"}`)}, nil)
+	rest, _ := listNames(t, srv, "tools/list", cursors[0], -1)
+	if got := fmt.Sprint(rest); got != "[t4 t5 t6 t7 t8 t9 t10]" {
+		t.Errorf("pages after mutation = %s, want every remaining unseen tool exactly once", got)
+	}
+
+	uris, _ := listNames(t, srv, "resources/list", "", 1)
+	if len(uris) != 4 {
+		t.Errorf("resources/list page = %v, want the server-wide page size of 4", uris)
+	}
+
+	invalid := map[string]string{
+		"a tools/list cursor on resources/list": cursors[0],
+		"a tampered cursor":                     strings.Replace(cursors[0], ".", "x.", 1),
+	}
+	for what, cursor := range invalid {
+		env := call(t, srv, 1, "resources/list", map[string]interface{}{"_meta": validMeta(), "cursor": cursor})
+		if env.Error == nil || env.Error.Code != transport.InvalidParams {
+			t.Errorf("%s = %+v, want -32602", what, env.Error)
+		}
+	}
+	// A cursor from another server (another key, as after a restart) is refused too.
+	other := NewServer(NewToolRegistry(), NewResourceRegistry(), nil)
+	if env := call(t, other, 1, "tools/list", map[string]interface{}{"_meta": validMeta(), "cursor": cursors[0]}); env.Error == nil || env.Error.Code != transport.InvalidParams {
+		t.Errorf("foreign cursor = %+v, want -32602", env.Error)
 	}
 }
 
@@ -503,6 +826,73 @@ func TestSubscriptionsListenNotifiesOnToolsListChanged(t *testing.T) {
 	}
 }
 
+func TestStopEndsListenWithGracefulClosure(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	tr := transport.NewInMemoryTransport()
+	tr.Start(srv)
+	conn, err := tr.Connect()
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	if err := conn.Send(buildRequest(t, 7, "subscriptions/listen", map[string]interface{}{
+		"_meta":         validMeta(),
+		"notifications": map[string]interface{}{"toolsListChanged": true},
+	})); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	select {
+	case <-conn.Messages():
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for subscriptions/listen acknowledgment")
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		tr.Stop()
+		close(stopped)
+	}()
+
+	// Stop shuts the server down before closing the connection, so the listen's final
+	// result must arrive ahead of the end of the stream.
+	var final rpcResponseEnvelope
+	select {
+	case msg, ok := <-conn.Messages():
+		if !ok {
+			t.Fatal("stream ended without a final subscriptions/listen result")
+		}
+		if err := json.Unmarshal(msg, &final); err != nil {
+			t.Fatalf("unmarshal final result: %v (body: %s)", err, msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the final subscriptions/listen result")
+	}
+	if string(final.ID) != "7" || final.Error != nil {
+		t.Fatalf("final message = %+v, want a success response to id 7", final)
+	}
+	var result struct {
+		ResultType string                     `json:"resultType"`
+		Meta       map[string]json.RawMessage `json:"_meta"`
+	}
+	if err := json.Unmarshal(final.Result, &result); err != nil {
+		t.Fatalf("unmarshal result: %v", err)
+	}
+	if result.ResultType != ResultTypeComplete || string(result.Meta[metaKeySubscriptionID]) != "7" {
+		t.Errorf("final result = %s, want resultType complete and _meta.subscriptionId 7", final.Result)
+	}
+	<-stopped
+
+	env := call(t, srv, 8, "subscriptions/listen", map[string]interface{}{
+		"_meta":         validMeta(),
+		"notifications": map[string]interface{}{"toolsListChanged": true},
+	})
+	if env.Error == nil || env.Error.Code != transport.InternalError {
+		t.Errorf("subscriptions/listen after shutdown = %+v, want -32603", env.Error)
+	}
+	if env := call(t, srv, 9, "tools/list", map[string]interface{}{"_meta": validMeta()}); env.Error != nil {
+		t.Errorf("tools/list after shutdown = %+v, want it still served", env.Error)
+	}
+}
+
 // observeDuringMutation opens a subscriptions/listen stream with the given notification
 // filter, waits for its acknowledgment (so a subsequent registry mutation cannot race the
 // subscribe), runs mutate, then gives the broker a bounded window to deliver one
@@ -512,53 +902,66 @@ func observeDuringMutation(t *testing.T, srv *Server, filter map[string]interfac
 	return observeDuringMutationN(t, srv, filter, 1, mutate)
 }
 
-// observeDuringMutationN is observeDuringMutation with an explicit count: it keeps waiting
-// until want notifications have arrived past the acknowledgment, or the window expires.
-// Callers expecting a mutation to fire two notifications must use this — otherwise the wait
-// returns as soon as the first lands and the second races the stream teardown.
+// observeDuringMutationN is observeDuringMutation with an explicit count: it returns as
+// soon as want notifications have arrived past the acknowledgment, or once the window
+// expires. The stream is read live over an in-memory connection, so nothing is polled;
+// callers asserting that nothing arrives still pay the full window, which is what makes
+// that assertion meaningful.
 func observeDuringMutationN(t *testing.T, srv *Server, filter map[string]interface{}, want int, mutate func()) []transport.BufferedNotification {
 	t.Helper()
 
-	w := transport.NewBufferedResponseWriter()
-	ctx, cancel := context.WithCancel(context.Background())
-
-	done := make(chan struct{})
-	go func() {
-		defer close(done)
-		req := buildRequest(t, 1, "subscriptions/listen", map[string]interface{}{
-			"_meta":         validMeta(),
-			"notifications": filter,
-		})
-		srv.HandleMessage(ctx, req, w)
-	}()
+	tr := transport.NewInMemoryTransport()
+	tr.Start(srv)
+	defer tr.Stop()
+	conn, err := tr.Connect()
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	if err := conn.Send(buildRequest(t, 1, "subscriptions/listen", map[string]interface{}{
+		"_meta":         validMeta(),
+		"notifications": filter,
+	})); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
 
-	deadline := time.Now().Add(2 * time.Second)
-	for len(w.Notifications()) == 0 {
-		if time.Now().After(deadline) {
-			cancel()
-			<-done
-			t.Fatal("timed out waiting for subscriptions/listen acknowledgment")
+	next := func(timeout <-chan time.Time) (transport.BufferedNotification, bool) {
+		select {
+		case msg := <-conn.Messages():
+			var n struct {
+				Method string                 `json:"method"`
+				Params map[string]interface{} `json:"params"`
+			}
+			if err := json.Unmarshal(msg, &n); err != nil {
+				t.Fatalf("unmarshal stream message: %v", err)
+			}
+			return transport.BufferedNotification{Method: n.Method, Params: n.Params}, true
+		case <-timeout:
+			return transport.BufferedNotification{}, false
 		}
-		time.Sleep(5 * time.Millisecond)
 	}
 
-	mutate()
-
-	// Bounded wait for the post-mutation notifications. Callers asserting that nothing
-	// arrives still pay this window, which is what makes that assertion meaningful.
-	deadline = time.Now().Add(500 * time.Millisecond)
-	for len(w.Notifications()) < want+1 && time.Now().Before(deadline) {
-		time.Sleep(5 * time.Millisecond)
+	if ack, ok := next(time.After(2 * time.Second)); !ok || ack.Method != "notifications/subscriptions/acknowledged" {
+		t.Fatalf("timed out waiting for subscriptions/listen acknowledgment (got %+v)", ack)
 	}
 
-	cancel()
-	<-done
+	mutate()
 
-	all := w.Notifications()
-	if len(all) == 0 {
-		return nil
+	var got []transport.BufferedNotification
+	window := time.After(500 * time.Millisecond)
+	for len(got) < want {
+		n, ok := next(window)
+		if !ok {
+			break
+		}
+		got = append(got, n)
+	}
+	if len(got) == want {
+		// Anything beyond want is a bug the caller's count assertion should see.
+		if n, ok := next(time.After(50 * time.Millisecond)); ok {
+			got = append(got, n)
+		}
 	}
-	return all[1:] // drop the acknowledgment
+	return got
 }
 
 func TestUnregisterRemovesToolAndNotifies(t *testing.T) {
@@ -827,6 +1230,173 @@ func TestNotifyUpdatedUnknownURIIsNoOp(t *testing.T) {
 	}
 }
 
+func TestURICoversBySegment(t *testing.T) {
+	for _, tc := range []struct {
+		parent, uri string
+		want        bool
+	}{
+		{"file:///project/", "file:///project/a/b.txt", true},
+		{"file:///project", "file:///project/a.txt", true},
+		{"file:///project", "file:///project", true},
+		{"file:///project/", "file:///project", true},
+		{"file:///proj", "file:///project/a.txt", false},
+		{"file:///project/a/../b", "file:///project/b/c", true},
+		{"file:///project/", "file:///other/project/a", false},
+		{"FILE://Host/x", "file://host/x/y", true},
+		{"https://a.example/x", "https://b.example/x/y", false},
+		{"db://main/t?id=1", "db://main/t?id=1", true},
+		{"db://main/t?id=1", "db://main/t/x", false},
+		{"urn:isbn:1", "urn:isbn:1:2", false},
+	} {
+		if got := uriCovers(tc.parent, tc.uri); got != tc.want {
+			t.Errorf("uriCovers(%q, %q) = %v, want %v", tc.parent, tc.uri, got, tc.want)
+		}
+	}
+}
+
+func TestPrefixSubscriptionCoversSubResources(t *testing.T) {
+	srv, _, resources := newTestServer(t)
+	for _, uri := range []string{"file:///project/src/main.go", "file:///projects/other.go"} {
+		resources.Register(Resource{URI: uri, Name: uri}, func(ctx context.Context) (ResourceContentResult, error) {
+			return ResourceContentResult{Text: "x"}, nil
+		})
+	}
+
+	notifications := observeDuringMutationN(t, srv,
+		map[string]interface{}{"resourceSubscriptions": []string{"file:///project/"}}, 2,
+		func() {
+			resources.NotifyUpdated("file:///projects/other.go")
+			resources.NotifyUpdated("file:///project/src/main.go")
+		})
+
+	if len(notifications) != 1 {
+		t.Fatalf("got %d notification(s), want exactly 1 (for the URI under the prefix): %+v", len(notifications), notifications)
+	}
+	if uri, _ := notificationParams(t, notifications, "notifications/resources/updated")["uri"].(string); uri != "file:///project/src/main.go" {
+		t.Errorf("params.uri = %q, want the sub-resource's own URI", uri)
+	}
+}
+
+func TestTemplateSubscriptionCoversExpansions(t *testing.T) {
+	srv, _, templates := newTemplateTestServer(t)
+
+	notifications := observeDuringMutationN(t, srv,
+		map[string]interface{}{"resourceSubscriptions": []string{"file:///logs/{date}"}}, 2,
+		func() {
+			if templates.NotifyUpdated("file:///other/2024-01-01") {
+				t.Error("NotifyUpdated on a URI no template expands to = true, want false")
+			}
+			if !templates.NotifyUpdated("file:///logs/2024-01-01") {
+				t.Error("NotifyUpdated on a template expansion = false, want true")
+			}
+		})
+
+	if len(notifications) != 1 {
+		t.Fatalf("got %d notification(s), want exactly 1: %+v", len(notifications), notifications)
+	}
+	if uri, _ := notificationParams(t, notifications, "notifications/resources/updated")["uri"].(string); uri != "file:///logs/2024-01-01" {
+		t.Errorf("params.uri = %q, want \"file:///logs/2024-01-01\"", uri)
+	}
+}
+
+// stallingWriter holds the first notification after the acknowledgment until released,
+// standing in for a client that has stopped reading its stream.
+type stallingWriter struct {
+	*transport.BufferedResponseWriter
+	writes  int
+	stalled chan struct{}
+	release chan struct{}
+}
+
+func (w *stallingWriter) WriteNotification(method string, params interface{}) error {
+	w.writes++
+	if w.writes == 2 {
+		close(w.stalled)
+		<-w.release
+	}
+	return w.BufferedResponseWriter.WriteNotification(method, params)
+}
+
+func TestSlowSubscriberIsCoalescedThenResynced(t *testing.T) {
+	registry := NewToolRegistry()
+	resources := NewResourceRegistry()
+	for _, uri := range []string{"test:///a", "test:///b", "test:///c"} {
+		resources.Register(Resource{URI: uri, Name: uri}, func(ctx context.Context) (ResourceContentResult, error) {
+			return ResourceContentResult{Text: "x"}, nil
+		})
+	}
+	srv := NewServer(registry, resources, &ServerConfig{NotificationBuffer: 2})
+	register := func(name string) {
+		registry.Register(Tool{Name: name, InputSchema: json.RawMessage(`{"type":"object"}`)},
+			func(ctx context.Context, req *ToolRequest) (Result, error) { return &ToolCallResult{}, nil })
+	}
+
+	w := &stallingWriter{BufferedResponseWriter: transport.NewBufferedResponseWriter(), stalled: make(chan struct{}), release: make(chan struct{})}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		srv.HandleMessage(ctx, buildRequest(t, 1, "subscriptions/listen", map[string]interface{}{
+			"_meta": validMeta(),
+			"notifications": map[string]interface{}{
+				"toolsListChanged":      true,
+				"resourceSubscriptions": []string{"test:///a", "test:///b", "test:///c"},
+			},
+		}), w)
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for len(w.Notifications()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for subscriptions/listen acknowledgment")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	register("t1") // taken off the queue; its write stalls
+	select {
+	case <-w.stalled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the listen stream never started writing the first list_changed")
+	}
+	register("t2")                       // queued
+	register("t3")                       // coalesced into t2's
+	resources.NotifyUpdated("test:///a") // queued; the buffer is now full
+	resources.NotifyUpdated("test:///b") // dropped: overflow
+
+	stats := srv.NotificationStats()
+	if stats.Coalesced != 1 || stats.Dropped != 1 {
+		t.Errorf("stats before release = %+v, want 1 coalesced and 1 dropped", stats)
+	}
+	close(w.release)
+
+	updated := func() map[string]bool {
+		seen := map[string]bool{}
+		for _, n := range w.Notifications() {
+			if n.Method == "notifications/resources/updated" {
+				seen[n.Params.(map[string]interface{})["uri"].(string)] = true
+			}
+		}
+		return seen
+	}
+	deadline = time.Now().Add(2 * time.Second)
+	for !updated()["test:///b"] {
+		if time.Now().After(deadline) {
+			t.Fatalf("the dropped update was never covered by a resync; got %+v", w.Notifications())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	// The resync re-announces every watched resource, not just the one that was lost.
+	if seen := updated(); !seen["test:///a"] || !seen["test:///c"] {
+		t.Errorf("resync announced %v, want every subscribed URI", seen)
+	}
+	if stats := srv.NotificationStats(); stats.Resyncs != 1 {
+		t.Errorf("stats after resync = %+v, want exactly 1 resync", stats)
+	}
+}
+
 // TestReRegisterResourceFiresListChangedAndUpdated pins the deliberate over-notification on
 // replacement: Register swaps both the metadata and the ResourceFunction, and the registry
 // cannot tell which changed, so a watcher of that URI hears about it.
@@ -920,3 +1490,1319 @@ func hasNotification(notifications []transport.BufferedNotification, method stri
 	}
 	return false
 }
+
+// newPromptTestServer is newTestServer plus a PromptRegistry holding a single "greet"
+// prompt with one required and one optional argument.
+func newPromptTestServer(t *testing.T) (*Server, *PromptRegistry) {
+	t.Helper()
+	prompts := NewPromptRegistry()
+	prompts.Register(Prompt{
+		Name:        "greet",
+		Description: "greets someone",
+		Arguments: []PromptArgument{
+			{Name: "name", Required: true},
+			{Name: "tone"},
+		},
+	}, func(ctx context.Context, req *PromptRequest) (PromptResult, error) {
+		greeting := "Hello, " + req.Argument("name")
+		if req.Argument("tone") == "loud" {
+			greeting += "!"
+		}
+		return PromptResult{Messages: []PromptMessage{UserMessage(Text(greeting))}}, nil
+	})
+	srv := NewServer(NewToolRegistry(), NewResourceRegistry(), &ServerConfig{Prompts: prompts})
+	return srv, prompts
+}
+
+func TestPromptsCapabilityOnlyWhenRegistered(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	env := call(t, srv, 1, "server/discover", map[string]interface{}{"_meta": validMeta()})
+	var discovered struct {
+		Capabilities ServerCapabilities `json:"capabilities"`
+	}
+	if err := json.Unmarshal(env.Result, &discovered); err != nil {
+		t.Fatalf("unmarshal server/discover: %v", err)
+	}
+	if discovered.Capabilities.Prompts != nil {
+		t.Error("server/discover advertises prompts with no PromptRegistry configured")
+	}
+
+	srv, prompts := newPromptTestServer(t)
+	env = call(t, srv, 2, "server/discover", map[string]interface{}{"_meta": validMeta()})
+	if err := json.Unmarshal(env.Result, &discovered); err != nil {
+		t.Fatalf("unmarshal server/discover: %v", err)
+	}
+	if discovered.Capabilities.Prompts == nil || !discovered.Capabilities.Prompts.ListChanged {
+		t.Errorf("capabilities.prompts = %+v, want {listChanged:true}", discovered.Capabilities.Prompts)
+	}
+
+	prompts.Unregister("greet")
+	env = call(t, srv, 3, "server/discover", map[string]interface{}{"_meta": validMeta()})
+	discovered.Capabilities = ServerCapabilities{}
+	if err := json.Unmarshal(env.Result, &discovered); err != nil {
+		t.Fatalf("unmarshal server/discover: %v", err)
+	}
+	if discovered.Capabilities.Prompts != nil {
+		t.Error("server/discover still advertises prompts after the last one was unregistered")
+	}
+}
+
+func TestPromptsListAndGetRoundTrip(t *testing.T) {
+	srv, _ := newPromptTestServer(t)
+
+	env := call(t, srv, 1, "prompts/list", map[string]interface{}{"_meta": validMeta()})
+	if env.Error != nil {
+		t.Fatalf("prompts/list: unexpected error %+v", env.Error)
+	}
+	var listed PromptsListResult
+	if err := json.Unmarshal(env.Result, &listed); err != nil {
+		t.Fatalf("unmarshal prompts/list: %v", err)
+	}
+	if listed.ResultType != ResultTypeComplete || listed.CacheScope == "" {
+		t.Errorf("prompts/list envelope = %+v, want a complete, cacheable result", listed.CacheableResult)
+	}
+	if len(listed.Prompts) != 1 || listed.Prompts[0].Name != "greet" || len(listed.Prompts[0].Arguments) != 2 {
+		t.Fatalf("prompts = %+v, want the single greet prompt with its two arguments", listed.Prompts)
+	}
+
+	env = call(t, srv, 2, "prompts/get", map[string]interface{}{
+		"_meta": validMeta(), "name": "greet", "arguments": map[string]string{"name": "Ada", "tone": "loud"},
+	})
+	if env.Error != nil {
+		t.Fatalf("prompts/get: unexpected error %+v", env.Error)
+	}
+	var got PromptsGetResult
+	if err := json.Unmarshal(env.Result, &got); err != nil {
+		t.Fatalf("unmarshal prompts/get: %v", err)
+	}
+	if got.Description != "greets someone" {
+		t.Errorf("description = %q, want the registered description", got.Description)
+	}
+	if len(got.Messages) != 1 || got.Messages[0].Role != RoleUser || got.Messages[0].Content.Text != "Hello, Ada!" {
+		t.Errorf("messages = %+v, want one user message \"Hello, Ada!\"", got.Messages)
+	}
+}
+
+func TestPromptsGetArgumentErrors(t *testing.T) {
+	srv, _ := newPromptTestServer(t)
+
+	env := call(t, srv, 1, "prompts/get", map[string]interface{}{
+		"_meta": validMeta(), "name": "greet", "arguments": map[string]string{"tone": "loud"},
+	})
+	if env.Error == nil || env.Error.Code != transport.InvalidParams {
+		t.Errorf("missing required argument: error = %+v, want code %d", env.Error, transport.InvalidParams)
+	}
+
+	env = call(t, srv, 2, "prompts/get", map[string]interface{}{
+		"_meta": validMeta(), "name": "nope",
+	})
+	if env.Error == nil || env.Error.Code != transport.InvalidParams {
+		t.Errorf("unknown prompt: error = %+v, want code %d", env.Error, transport.InvalidParams)
+	}
+}
+
+func TestPromptRegisterFiresListChanged(t *testing.T) {
+	srv, prompts := newPromptTestServer(t)
+
+	notifications := observeDuringMutation(t, srv,
+		map[string]interface{}{"promptsListChanged": true},
+		func() {
+			prompts.Register(Prompt{Name: "late"}, func(ctx context.Context, req *PromptRequest) (PromptResult, error) {
+				return PromptResult{}, nil
+			})
+		})
+
+	if !hasNotification(notifications, "notifications/prompts/list_changed") {
+		t.Errorf("did not observe notifications/prompts/list_changed after Register, got %+v", notifications)
+	}
+}
+
+func TestURITemplateMatch(t *testing.T) {
+	tests := []struct {
+		template string
+		uri      string
+		want     map[string]string // nil means no match
+	}{
+		// Level 1
+		{"file:///logs/{date}", "file:///logs/2026-07-28", map[string]string{"date": "2026-07-28"}},
+		{"file:///logs/{date}.log", "file:///logs/2026-07-28.log", map[string]string{"date": "2026-07-28"}},
+		{"file:///logs/{date}", "file:///logs/a/b", nil},
+		{"file:///logs/{name}", "file:///logs/hello%20world", map[string]string{"name": "hello world"}},
+		{"file:///logs/{date}", "file:///other/2026-07-28", nil},
+		// Level 2
+		{"file:///{+path}", "file:///var/log/syslog", map[string]string{"path": "var/log/syslog"}},
+		{"doc://page{#section}", "doc://page#intro/part", map[string]string{"section": "intro/part"}},
+		{"doc://page{#section}", "doc://page", map[string]string{}},
+		// Level 3
+		{"map://{x,y}", "map://1024,768", map[string]string{"x": "1024", "y": "768"}},
+		{"host://www{.domain,tld}", "host://www.example.com", map[string]string{"domain": "example", "tld": "com"}},
+		{"repo://{owner}{/repo,file}", "repo://spirilis/generic-go-mcp/README.md",
+			map[string]string{"owner": "spirilis", "repo": "generic-go-mcp", "file": "README.md"}},
+		{"api://items{;id,rev}", "api://items;id=7;rev", map[string]string{"id": "7", "rev": ""}},
+		{"api://search{?q,lang}", "api://search?lang=en&q=mcp", map[string]string{"q": "mcp", "lang": "en"}},
+		{"api://search{?q}", "api://search", map[string]string{}},
+		{"api://search{?q}", "api://search?unknown=1", nil},
+		{"api://search?fixed=1{&q}", "api://search?fixed=1&q=go", map[string]string{"q": "go"}},
+		{"file:///{+path}{?rev}", "file:///a/b?rev=3", map[string]string{"path": "a/b", "rev": "3"}},
+		// Level 4 prefix modifier bounds the value length.
+		{"id://{code:3}", "id://abc", map[string]string{"code": "abc"}},
+		{"id://{code:3}", "id://abcd", nil},
+	}
+	for _, tt := range tests {
+		tmpl, err := ParseURITemplate(tt.template)
+		if err != nil {
+			t.Fatalf("ParseURITemplate(%q): %v", tt.template, err)
+		}
+		got, ok := tmpl.Match(tt.uri)
+		if tt.want == nil {
+			if ok {
+				t.Errorf("%q.Match(%q) = %v, want no match", tt.template, tt.uri, got)
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("%q.Match(%q): no match, want %v", tt.template, tt.uri, tt.want)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%q.Match(%q) = %v, want %v", tt.template, tt.uri, got, tt.want)
+			continue
+		}
+		for k, v := range tt.want {
+			if got[k] != v {
+				t.Errorf("%q.Match(%q)[%q] = %q, want %q", tt.template, tt.uri, k, got[k], v)
+			}
+		}
+	}
+
+	for _, bad := range []string{"file:///{", "file:///}", "file:///{}", "file:///{=x}", "file:///{a b}"} {
+		if _, err := ParseURITemplate(bad); err == nil {
+			t.Errorf("ParseURITemplate(%q): expected an error", bad)
+		}
+	}
+}
+
+// newTemplateTestServer is newTestServer plus a ResourceTemplateRegistry holding a single
+// "file:///logs/{date}" template that echoes the date it was read with.
+func newTemplateTestServer(t *testing.T) (*Server, *ResourceRegistry, *ResourceTemplateRegistry) {
+	t.Helper()
+	templates := NewResourceTemplateRegistry()
+	err := templates.Register(ResourceTemplate{URITemplate: "file:///logs/{date}", Name: "daily log", MimeType: "text/x-log"},
+		func(ctx context.Context, req *ResourceRequest) (ResourceContentResult, error) {
+			return ResourceContentResult{Text: "log for " + req.Variable("date")}, nil
+		})
+	if err != nil {
+		t.Fatalf("Register template: %v", err)
+	}
+	resources := NewResourceRegistry()
+	srv := NewServer(NewToolRegistry(), resources, &ServerConfig{ResourceTemplates: templates})
+	return srv, resources, templates
+}
+
+func TestResourceTemplatesListAndRead(t *testing.T) {
+	srv, _, _ := newTemplateTestServer(t)
+
+	env := call(t, srv, 1, "resources/templates/list", map[string]interface{}{"_meta": validMeta()})
+	if env.Error != nil {
+		t.Fatalf("resources/templates/list: unexpected error %+v", env.Error)
+	}
+	var listed ResourcesTemplatesListResult
+	if err := json.Unmarshal(env.Result, &listed); err != nil {
+		t.Fatalf("unmarshal resources/templates/list: %v", err)
+	}
+	if listed.ResultType != ResultTypeComplete || listed.CacheScope == "" {
+		t.Errorf("resources/templates/list envelope = %+v, want a complete, cacheable result", listed.CacheableResult)
+	}
+	if len(listed.ResourceTemplates) != 1 || listed.ResourceTemplates[0].URITemplate != "file:///logs/{date}" {
+		t.Fatalf("resourceTemplates = %+v, want the single logs template", listed.ResourceTemplates)
+	}
+
+	env = call(t, srv, 2, "resources/read", map[string]interface{}{"_meta": validMeta(), "uri": "file:///logs/2026-07-28"})
+	if env.Error != nil {
+		t.Fatalf("resources/read via template: unexpected error %+v", env.Error)
+	}
+	var read ResourcesReadResult
+	if err := json.Unmarshal(env.Result, &read); err != nil {
+		t.Fatalf("unmarshal resources/read: %v", err)
+	}
+	if read.CacheScope == "" {
+		t.Error("templated resources/read is missing its caching hints")
+	}
+	if len(read.Contents) != 1 {
+		t.Fatalf("contents = %+v, want exactly one entry", read.Contents)
+	}
+	c := read.Contents[0]
+	if c.URI != "file:///logs/2026-07-28" || c.Name != "daily log" || c.MimeType != "text/x-log" || c.Text != "log for 2026-07-28" {
+		t.Errorf("contents[0] = %+v, want the requested URI with the template's metadata and extracted date", c)
+	}
+
+	env = call(t, srv, 3, "resources/read", map[string]interface{}{"_meta": validMeta(), "uri": "file:///other/2026-07-28"})
+	if env.Error == nil || env.Error.Code != transport.InvalidParams {
+		t.Errorf("resources/read matching no resource or template: error = %+v, want code %d", env.Error, transport.InvalidParams)
+	}
+}
+
+func TestStaticResourceTakesPrecedenceOverTemplate(t *testing.T) {
+	srv, resources, _ := newTemplateTestServer(t)
+	resources.Register(Resource{URI: "file:///logs/latest", Name: "latest"},
+		func(ctx context.Context) (ResourceContentResult, error) {
+			return ResourceContentResult{Text: "static"}, nil
+		})
+
+	env := call(t, srv, 1, "resources/read", map[string]interface{}{"_meta": validMeta(), "uri": "file:///logs/latest"})
+	var read ResourcesReadResult
+	if err := json.Unmarshal(env.Result, &read); err != nil {
+		t.Fatalf("unmarshal resources/read: %v", err)
+	}
+	if len(read.Contents) != 1 || read.Contents[0].Text != "static" {
+		t.Errorf("contents = %+v, want the exactly-registered resource to win over the template", read.Contents)
+	}
+}
+
+func TestTemplatesAloneAdvertiseResources(t *testing.T) {
+	srv, _, templates := newTemplateTestServer(t)
+
+	discoverResources := func() *ResourcesCapability {
+		env := call(t, srv, 1, "server/discover", map[string]interface{}{"_meta": validMeta()})
+		var discovered struct {
+			Capabilities ServerCapabilities `json:"capabilities"`
+		}
+		if err := json.Unmarshal(env.Result, &discovered); err != nil {
+			t.Fatalf("unmarshal server/discover: %v", err)
+		}
+		return discovered.Capabilities.Resources
+	}
+
+	if discoverResources() == nil {
+		t.Error("server/discover does not advertise resources with only a template registered")
+	}
+
+	notifications := observeDuringMutation(t, srv,
+		map[string]interface{}{"resourcesListChanged": true},
+		func() {
+			if !templates.Unregister("file:///logs/{date}") {
+				t.Error("Unregister of a registered template = false, want true")
+			}
+		})
+	if !hasNotification(notifications, "notifications/resources/list_changed") {
+		t.Errorf("did not observe notifications/resources/list_changed after unregistering a template, got %+v", notifications)
+	}
+	if discoverResources() != nil {
+		t.Error("server/discover still advertises resources after the last template was unregistered")
+	}
+}
+
+func TestCompletionCapabilityOnlyWhenProviderAttached(t *testing.T) {
+	srv, prompts := newPromptTestServer(t)
+
+	discoverCompletions := func() *CompletionsCapability {
+		env := call(t, srv, 1, "server/discover", map[string]interface{}{"_meta": validMeta()})
+		var discovered struct {
+			Capabilities ServerCapabilities `json:"capabilities"`
+		}
+		if err := json.Unmarshal(env.Result, &discovered); err != nil {
+			t.Fatalf("unmarshal server/discover: %v", err)
+		}
+		return discovered.Capabilities.Completions
+	}
+
+	if discoverCompletions() != nil {
+		t.Error("server/discover advertises completions with no provider attached")
+	}
+	prompts.RegisterCompletion("greet", "tone", CompleteFromList([]string{"loud", "quiet"}))
+	if discoverCompletions() == nil {
+		t.Error("server/discover does not advertise completions after a provider was attached")
+	}
+	if !prompts.UnregisterCompletion("greet", "tone") {
+		t.Error("UnregisterCompletion of an attached provider = false, want true")
+	}
+	if discoverCompletions() != nil {
+		t.Error("server/discover still advertises completions after the last provider was detached")
+	}
+}
+
+func TestCompletePromptArgument(t *testing.T) {
+	srv, prompts := newPromptTestServer(t)
+	prompts.RegisterCompletion("greet", "tone", CompleteFromList([]string{"loud", "lively", "quiet"}))
+
+	complete := func(id int, ref map[string]interface{}, arg, value string) rpcResponseEnvelope {
+		return call(t, srv, id, "completion/complete", map[string]interface{}{
+			"_meta":    validMeta(),
+			"ref":      ref,
+			"argument": map[string]interface{}{"name": arg, "value": value},
+		})
+	}
+
+	env := complete(1, map[string]interface{}{"type": CompletionRefPrompt, "name": "greet"}, "tone", "L")
+	if env.Error != nil {
+		t.Fatalf("completion/complete: unexpected error %+v", env.Error)
+	}
+	var got CompleteResult
+	if err := json.Unmarshal(env.Result, &got); err != nil {
+		t.Fatalf("unmarshal completion/complete: %v", err)
+	}
+	if got.ResultType != ResultTypeComplete {
+		t.Errorf("resultType = %q, want %q", got.ResultType, ResultTypeComplete)
+	}
+	if len(got.Completion.Values) != 2 || got.Completion.Values[0] != "loud" || got.Completion.Values[1] != "lively" {
+		t.Errorf("values = %v, want [loud lively]", got.Completion.Values)
+	}
+
+	// An argument with no provider has no suggestions, but is not an error.
+	env = complete(2, map[string]interface{}{"type": CompletionRefPrompt, "name": "greet"}, "name", "A")
+	if env.Error != nil {
+		t.Fatalf("completion/complete without a provider: unexpected error %+v", env.Error)
+	}
+	var empty struct {
+		Completion struct {
+			Values []string `json:"values"`
+		} `json:"completion"`
+	}
+	if err := json.Unmarshal(env.Result, &empty); err != nil || empty.Completion.Values == nil || len(empty.Completion.Values) != 0 {
+		t.Errorf("completion without a provider = %s, want an empty values array", env.Result)
+	}
+
+	env = complete(3, map[string]interface{}{"type": CompletionRefPrompt, "name": "nope"}, "tone", "")
+	if env.Error == nil || env.Error.Code != transport.InvalidParams {
+		t.Errorf("completion for an unknown prompt: error = %+v, want code %d", env.Error, transport.InvalidParams)
+	}
+	env = complete(4, map[string]interface{}{"type": "ref/bogus"}, "tone", "")
+	if env.Error == nil || env.Error.Code != transport.InvalidParams {
+		t.Errorf("completion with an invalid ref type: error = %+v, want code %d", env.Error, transport.InvalidParams)
+	}
+}
+
+func TestCompleteTemplateVariableTruncates(t *testing.T) {
+	srv, _, templates := newTemplateTestServer(t)
+	templates.RegisterCompletion("file:///logs/{date}", "date",
+		func(ctx context.Context, req *CompletionRequest) (CompletionResult, error) {
+			values := make([]string, 150)
+			for i := range values {
+				values[i] = req.Value + "-" + time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, i).Format("01-02")
+			}
+			return CompletionResult{Values: values}, nil
+		})
+
+	env := call(t, srv, 1, "completion/complete", map[string]interface{}{
+		"_meta":    validMeta(),
+		"ref":      map[string]interface{}{"type": CompletionRefResource, "uri": "file:///logs/{date}"},
+		"argument": map[string]interface{}{"name": "date", "value": "2026"},
+	})
+	if env.Error != nil {
+		t.Fatalf("completion/complete: unexpected error %+v", env.Error)
+	}
+	var got CompleteResult
+	if err := json.Unmarshal(env.Result, &got); err != nil {
+		t.Fatalf("unmarshal completion/complete: %v", err)
+	}
+	if len(got.Completion.Values) != maxCompletionValues || !got.Completion.HasMore || got.Completion.Total != 150 {
+		t.Errorf("completion = {%d values, total %d, hasMore %v}, want {%d, 150, true}",
+			len(got.Completion.Values), got.Completion.Total, got.Completion.HasMore, maxCompletionValues)
+	}
+	if got.Completion.Values[0] != "2026-01-01" {
+		t.Errorf("values[0] = %q, want \"2026-01-01\"", got.Completion.Values[0])
+	}
+}
+
+type schemaTestBase struct {
+	ID      string    `json:"id" description:"Stable identifier"`
+	Created time.Time `json:"created,omitempty"`
+}
+
+type schemaTestNode struct {
+	Value    int               `json:"value"`
+	Children []*schemaTestNode `json:"children,omitempty"`
+}
+
+type schemaTestArgs struct {
+	schemaTestBase
+	Region  string          `json:"region" jsonschema:"enum=us|eu,x-mcp-header=Region"`
+	Limit   int             `json:"limit,omitempty" jsonschema:"minimum=1,maximum=10"`
+	Note    *string         `json:"note" jsonschema:"optional"`
+	Tree    schemaTestNode  `json:"tree,omitempty"`
+	Payload []byte          `json:"payload,omitempty"`
+	Extra   json.RawMessage `json:"extra,omitempty"`
+	hidden  string
+}
+
+func TestGenerateSchema(t *testing.T) {
+	raw, err := GenerateSchema[schemaTestArgs]()
+	if err != nil {
+		t.Fatalf("GenerateSchema: %v", err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(raw, &got); err != nil {
+		t.Fatalf("unmarshal schema: %v", err)
+	}
+
+	if got["type"] != "object" {
+		t.Errorf("type = %v, want object", got["type"])
+	}
+	required, _ := got["required"].([]interface{})
+	if len(required) != 2 || required[0] != "region" || required[1] != "id" {
+		t.Errorf("required = %v, want [region id] (own fields, then promoted ones)", required)
+	}
+	props := got["properties"].(map[string]interface{})
+	if _, ok := props["hidden"]; ok {
+		t.Error("unexported field must not appear in the schema")
+	}
+	if id := props["id"].(map[string]interface{}); id["description"] != "Stable identifier" {
+		t.Errorf("promoted id = %v, want its description", id)
+	}
+	if created := props["created"].(map[string]interface{}); created["type"] != "string" || created["format"] != "date-time" {
+		t.Errorf("time.Time property = %v, want a date-time string", created)
+	}
+	region := props["region"].(map[string]interface{})
+	if region["x-mcp-header"] != "Region" || len(region["enum"].([]interface{})) != 2 {
+		t.Errorf("region = %v, want enum [us eu] and x-mcp-header Region", region)
+	}
+	if limit := props["limit"].(map[string]interface{}); limit["minimum"] != 1.0 || limit["maximum"] != 10.0 {
+		t.Errorf("limit = %v, want minimum 1 and maximum 10", limit)
+	}
+	if payload := props["payload"].(map[string]interface{}); payload["contentEncoding"] != "base64" {
+		t.Errorf("[]byte property = %v, want a base64 string", payload)
+	}
+	if extra := props["extra"].(map[string]interface{}); len(extra) != 0 {
+		t.Errorf("json.RawMessage property = %v, want an unconstrained schema", extra)
+	}
+
+	// The recursive node type is emitted once under $defs and referenced everywhere.
+	if tree := props["tree"].(map[string]interface{}); tree["$ref"] != "#/$defs/schemaTestNode" {
+		t.Errorf("tree = %v, want a $ref to the node definition", tree)
+	}
+	node := got["$defs"].(map[string]interface{})["schemaTestNode"].(map[string]interface{})
+	children := node["properties"].(map[string]interface{})["children"].(map[string]interface{})
+	items := children["items"].(map[string]interface{})["anyOf"].([]interface{})
+	if items[0].(map[string]interface{})["$ref"] != "#/$defs/schemaTestNode" || items[1].(map[string]interface{})["type"] != "null" {
+		t.Errorf("node.children = %v, want items referencing the node definition or null", children)
+	}
+	if typ, _ := children["type"].([]interface{}); len(typ) != 2 || typ[0] != "array" || typ[1] != "null" {
+		t.Errorf("node.children type = %v, want [array null] for a slice encoding/json may write as null", children["type"])
+	}
+
+	// A recursive root refers to itself as "#".
+	raw, err = GenerateSchema[schemaTestNode]()
+	if err != nil {
+		t.Fatalf("GenerateSchema(node): %v", err)
+	}
+	if !json.Valid(raw) || !bytes.Contains(raw, []byte(`"$ref":"#"`)) || bytes.Contains(raw, []byte("$defs")) {
+		t.Errorf("recursive root schema = %s, want self-references to \"#\" and no $defs", raw)
+	}
+
+	if _, err := GenerateSchema[struct{ C chan int }](); err == nil {
+		t.Error("expected a channel field to be rejected")
+	}
+}
+
+type typedTestOut struct {
+	Greeting string `json:"greeting"`
+}
+
+func TestRegisterTypedRoundTrip(t *testing.T) {
+	srv, registry, _ := newTestServer(t)
+	err := RegisterTyped(registry, Tool{Name: "greet"},
+		func(ctx context.Context, req *ToolRequest, in struct {
+			Name string `json:"name"`
+		}) (typedTestOut, error) {
+			if in.Name == "" {
+				return typedTestOut{}, ReturnResult(ErrorResultf("name is empty"), nil)
+			}
+			return typedTestOut{Greeting: "hello " + in.Name}, nil
+		})
+	if err != nil {
+		t.Fatalf("RegisterTyped: %v", err)
+	}
+
+	tool, _ := registry.Get("greet")
+	if !bytes.Contains(tool.InputSchema, []byte(`"required":["name"]`)) || !bytes.Contains(tool.OutputSchema, []byte(`"greeting"`)) {
+		t.Errorf("generated schemas = %s / %s, want them derived from the In and Out types", tool.InputSchema, tool.OutputSchema)
+	}
+
+	env := call(t, srv, 1, "tools/call", map[string]interface{}{
+		"_meta": validMeta(), "name": "greet", "arguments": map[string]interface{}{"name": "world"},
+	})
+	if env.Error != nil {
+		t.Fatalf("unexpected error: %+v", env.Error)
+	}
+	var res struct {
+		Content           []Content    `json:"content"`
+		StructuredContent typedTestOut `json:"structuredContent"`
+		IsError           bool         `json:"isError"`
+	}
+	if err := json.Unmarshal(env.Result, &res); err != nil {
+		t.Fatalf("unmarshal result: %v", err)
+	}
+	if res.StructuredContent.Greeting != "hello world" || len(res.Content) != 1 || res.Content[0].Text != `{"greeting":"hello world"}` {
+		t.Errorf("result = %+v, want the output as structuredContent and JSON text", res)
+	}
+
+	env = call(t, srv, 2, "tools/call", map[string]interface{}{
+		"_meta": validMeta(), "name": "greet", "arguments": map[string]interface{}{"name": ""},
+	})
+	if env.Error != nil || !bytes.Contains(env.Result, []byte(`"isError":true`)) {
+		t.Errorf("ReturnResult(ErrorResultf): got %s / %+v, want an isError result", env.Result, env.Error)
+	}
+
+	env = call(t, srv, 3, "tools/call", map[string]interface{}{
+		"_meta": validMeta(), "name": "greet", "arguments": map[string]interface{}{"name": 42},
+	})
+	if env.Error == nil || env.Error.Code != transport.InvalidParams {
+		t.Errorf("arguments violating the generated schema: error = %+v, want code %d", env.Error, transport.InvalidParams)
+	}
+
+	if err := RegisterTyped(registry, Tool{Name: "bad"}, func(ctx context.Context, req *ToolRequest, in string) (typedTestOut, error) {
+		return typedTestOut{}, nil
+	}); err == nil {
+		t.Error("expected a non-object input type to be rejected")
+	}
+	if _, ok := registry.Get("bad"); ok {
+		t.Error("a rejected RegisterTyped must not register the tool")
+	}
+}
+
+type typedZeroOut struct {
+	Items []string          `json:"items"`
+	Tags  map[string]string `json:"tags"`
+	Next  *schemaTestNode   `json:"next"`
+	Mode  *string           `json:"mode" jsonschema:"enum=fast|slow"`
+}
+
+func TestRegisterTypedZeroValueOutputMatchesItsSchema(t *testing.T) {
+	srv, registry, _ := newTestServer(t)
+	err := RegisterTyped(registry, Tool{Name: "zero"},
+		func(ctx context.Context, req *ToolRequest, in struct{}) (typedZeroOut, error) {
+			return typedZeroOut{}, nil
+		})
+	if err != nil {
+		t.Fatalf("RegisterTyped: %v", err)
+	}
+
+	env := call(t, srv, 1, "tools/call", map[string]interface{}{
+		"_meta": validMeta(), "name": "zero", "arguments": map[string]interface{}{},
+	})
+	if env.Error != nil {
+		t.Fatalf("zero-value output failed its own outputSchema: %+v", env.Error)
+	}
+	want := `"structuredContent":{"items":null,"tags":null,"next":null,"mode":null}`
+	if !bytes.Contains(env.Result, []byte(want)) || bytes.Contains(env.Result, []byte(`"isError":true`)) {
+		t.Errorf("result = %s, want %s", env.Result, want)
+	}
+}
+
+func TestToolsCallValidatesArgumentsAgainstInputSchema(t *testing.T) {
+	srv, registry, _ := newTestServer(t)
+	called := false
+	registry.Register(Tool{
+		Name: "bounded",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{
+			"items":{"type":"array","items":{"$ref":"#/$defs/item"}}},
+			"required":["items"],"additionalProperties":false,
+			"$defs":{"item":{"type":"object","properties":{"n":{"type":"integer","minimum":1}},"required":["n"]}}}`),
+	}, func(ctx context.Context, req *ToolRequest) (Result, error) {
+		called = true
+		return &ToolCallResult{Content: []Content{Text("ok")}}, nil
+	})
+
+	cases := []struct {
+		name string
+		args map[string]interface{}
+		path string
+	}{
+		{"missing required", map[string]interface{}{}, ""},
+		{"nested minimum via $ref", map[string]interface{}{"items": []interface{}{map[string]interface{}{"n": 2}, map[string]interface{}{"n": 0}}}, "/items/1/n"},
+		{"non-integer", map[string]interface{}{"items": []interface{}{map[string]interface{}{"n": 1.5}}}, "/items/0/n"},
+		{"additional property", map[string]interface{}{"items": []interface{}{}, "extra/key": true}, "/extra~1key"},
+	}
+	for i, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			env := call(t, srv, i+1, "tools/call", map[string]interface{}{"_meta": validMeta(), "name": "bounded", "arguments": tc.args})
+			if env.Error == nil || env.Error.Code != transport.InvalidParams {
+				t.Fatalf("error = %+v, want code %d", env.Error, transport.InvalidParams)
+			}
+			var data struct {
+				Path string `json:"path"`
+			}
+			if err := json.Unmarshal(env.Error.Data, &data); err != nil || data.Path != tc.path {
+				t.Errorf("error data = %s, want path %q", env.Error.Data, tc.path)
+			}
+		})
+	}
+	if called {
+		t.Error("the tool must not run when its arguments fail validation")
+	}
+
+	env := call(t, srv, 10, "tools/call", map[string]interface{}{
+		"_meta": validMeta(), "name": "bounded", "arguments": map[string]interface{}{"items": []interface{}{map[string]interface{}{"n": 1.0}}},
+	})
+	if env.Error != nil || !called {
+		t.Errorf("conforming arguments: error = %+v, called = %v", env.Error, called)
+	}
+}
+
+func TestHugeNumbersAreRejectedWithoutBeingParsed(t *testing.T) {
+	srv, registry, _ := newTestServer(t)
+	registry.Register(Tool{
+		Name:        "integers",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{"n":{"type":"array","items":{"type":"integer"}}}}`),
+	}, func(ctx context.Context, req *ToolRequest) (Result, error) {
+		return &ToolCallResult{Content: []Content{Text("ok")}}, nil
+	})
+
+	huge := strings.TrimSuffix(strings.Repeat("1e1000000,", 100), ",")
+	start := time.Now()
+	env := call(t, srv, 1, "tools/call", map[string]interface{}{
+		"_meta": validMeta(), "name": "integers", "arguments": json.RawMessage(`{"n":[` + huge + `]}`),
+	})
+	if env.Error == nil || env.Error.Code != transport.InvalidParams {
+		t.Errorf("100 × 1e1000000 as integers = %+v, want -32602", env.Error)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("rejecting huge numbers took %v", elapsed)
+	}
+
+	// The integer check reads the text: these are integers, whatever their notation.
+	for i, n := range []string{"15", "-0", "1.0", "1.5e1", "120e-1", "0.0e5"} {
+		env := call(t, srv, i+2, "tools/call", map[string]interface{}{
+			"_meta": validMeta(), "name": "integers", "arguments": json.RawMessage(`{"n":[` + n + `]}`),
+		})
+		if env.Error != nil {
+			t.Errorf("%s as an integer = %+v, want accepted", n, env.Error)
+		}
+	}
+	for i, n := range []string{"1.25e1", "0.5", "1e-1"} {
+		env := call(t, srv, i+10, "tools/call", map[string]interface{}{
+			"_meta": validMeta(), "name": "integers", "arguments": json.RawMessage(`{"n":[` + n + `]}`),
+		})
+		if env.Error == nil || env.Error.Code != transport.InvalidParams {
+			t.Errorf("%s as an integer = %+v, want -32602", n, env.Error)
+		}
+	}
+}
+
+func TestToolsCallReportsNonConformingStructuredContent(t *testing.T) {
+	srv, registry, _ := newTestServer(t)
+	var out interface{}
+	registry.Register(Tool{
+		Name:         "structured",
+		InputSchema:  json.RawMessage(`{"type":"object"}`),
+		OutputSchema: json.RawMessage(`{"type":"object","properties":{"count":{"type":"integer"}},"required":["count"]}`),
+	}, func(ctx context.Context, req *ToolRequest) (Result, error) {
+		return &ToolCallResult{Content: []Content{Text("x")}, StructuredContent: out}, nil
+	})
+
+	for i, tc := range []struct {
+		name    string
+		out     interface{}
+		isError bool
+	}{
+		{"conforming", map[string]interface{}{"count": 3}, false},
+		{"wrong type", map[string]interface{}{"count": "three"}, true},
+		{"missing", nil, true},
+	} {
+		out = tc.out
+		env := call(t, srv, i+1, "tools/call", map[string]interface{}{"_meta": validMeta(), "name": "structured", "arguments": map[string]interface{}{}})
+		if env.Error != nil {
+			t.Fatalf("%s: unexpected protocol error %+v", tc.name, env.Error)
+		}
+		var res ToolCallResult
+		if err := json.Unmarshal(env.Result, &res); err != nil {
+			t.Fatalf("%s: unmarshal: %v", tc.name, err)
+		}
+		if res.IsError != tc.isError {
+			t.Errorf("%s: isError = %v, want %v (result %s)", tc.name, res.IsError, tc.isError, env.Result)
+		}
+	}
+}
+
+func TestRegisterEnforcesWhatItCanOfAnUncompilableSchema(t *testing.T) {
+	srv, registry, _ := newTestServer(t)
+	called := false
+	// RE2 has no lookahead, so the pattern cannot be compiled; type and required still apply.
+	registry.Register(Tool{
+		Name: "lookahead",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{
+			"code":{"type":"string","pattern":"^(?=[A-Z])\\w+$"},"n":{"type":"integer"}},"required":["code"]}`),
+	}, func(ctx context.Context, req *ToolRequest) (Result, error) {
+		called = true
+		return &ToolCallResult{Content: []Content{Text("ok")}}, nil
+	})
+
+	for i, args := range []map[string]interface{}{
+		{},
+		{"code": 7},
+		{"code": "abc", "n": "seven"},
+	} {
+		env := call(t, srv, i+1, "tools/call", map[string]interface{}{"_meta": validMeta(), "name": "lookahead", "arguments": args})
+		if env.Error == nil || env.Error.Code != transport.InvalidParams {
+			t.Errorf("arguments %v = %+v, want -32602", args, env.Error)
+		}
+	}
+	if called {
+		t.Error("the tool ran although its arguments broke the schema's remaining keywords")
+	}
+	env := call(t, srv, 9, "tools/call", map[string]interface{}{"_meta": validMeta(), "name": "lookahead", "arguments": map[string]interface{}{"code": "abc"}})
+	if env.Error != nil || !called {
+		t.Errorf("arguments passing every compilable keyword = %+v, called = %v", env.Error, called)
+	}
+
+	registry.Register(Tool{Name: "garbled", InputSchema: json.RawMessage(`{"type":`)}, func(ctx context.Context, req *ToolRequest) (Result, error) {
+		return &ToolCallResult{}, nil
+	})
+	if env := call(t, srv, 10, "tools/call", map[string]interface{}{"_meta": validMeta(), "name": "garbled", "arguments": map[string]interface{}{}}); env.Error == nil || env.Error.Code != transport.InvalidParams {
+		t.Errorf("call to a tool whose schema is not JSON = %+v, want -32602", env.Error)
+	}
+}
+
+func TestCompileSchemaRejectsUnsupported(t *testing.T) {
+	for _, raw := range []string{
+		`{"$ref":"https://example.com/other.json"}`,
+		`{"type":"object","unevaluatedProperties":false}`,
+		`{"type":"string","pattern":"("}`,
+		`{"type":7}`,
+	} {
+		if _, err := compileSchema(json.RawMessage(raw)); err == nil {
+			t.Errorf("compileSchema(%s) succeeded, want an error", raw)
+		}
+	}
+}
+
+func TestReportProgressIsTokenedAndRateLimited(t *testing.T) {
+	srv, registry, _ := newTestServer(t)
+	registry.Register(Tool{Name: "index", InputSchema: json.RawMessage(`{"type":"object"}`)},
+		func(ctx context.Context, req *ToolRequest) (Result, error) {
+			for i := 1; i <= 5; i++ {
+				if err := req.ReportProgress(float64(i), 5, "indexing"); err != nil {
+					return nil, err
+				}
+			}
+			// Progress must increase: a stale value is dropped even once the interval passed.
+			time.Sleep(2 * defaultProgressInterval)
+			_ = req.ReportProgress(3, 5, "stale")
+			return &ToolCallResult{Content: []Content{Text("indexed")}}, nil
+		})
+
+	run := func(meta map[string]interface{}) []transport.BufferedNotification {
+		w := transport.NewBufferedResponseWriter()
+		srv.HandleMessage(context.Background(), buildRequest(t, 1, "tools/call", map[string]interface{}{
+			"_meta": meta, "name": "index", "arguments": map[string]interface{}{},
+		}), w)
+		if w.Message() == nil {
+			t.Fatal("tools/call wrote no response")
+		}
+		return w.Notifications()
+	}
+
+	if got := run(validMeta()); len(got) != 0 {
+		t.Errorf("without a progressToken: %d notifications, want none", len(got))
+	}
+
+	meta := validMeta()
+	meta[metaKeyProgressToken] = "tok-1"
+	got := run(meta)
+	// The tight loop is throttled down to the first report and the one reaching total.
+	if len(got) != 2 {
+		t.Fatalf("got %d progress notifications, want 2 (first and completion): %+v", len(got), got)
+	}
+	for i, want := range []float64{1, 5} {
+		p, ok := got[i].Params.(ProgressNotificationParams)
+		if got[i].Method != "notifications/progress" || !ok {
+			t.Fatalf("notification %d = %+v, want notifications/progress", i, got[i])
+		}
+		if string(p.ProgressToken) != `"tok-1"` || p.Progress != want || p.Total != 5 || p.Message != "indexing" {
+			t.Errorf("notification %d params = %+v, want token \"tok-1\" progress %v of 5", i, p, want)
+		}
+	}
+}
+
+func TestToolLoggerHonorsClientLogLevelAndRedacts(t *testing.T) {
+	registry := NewToolRegistry()
+	registry.Register(Tool{Name: "report", InputSchema: json.RawMessage(`{"type":"object"}`)},
+		func(ctx context.Context, req *ToolRequest) (Result, error) {
+			log := req.Logger().With("job", 7)
+			log.Debug("starting")
+			log.Info("fetching", "token", "s3cret", "err", errors.New("retrying"), "message", "from an attribute")
+			log.WithGroup("db").Warn("slow query", "ms", 900)
+			return &ToolCallResult{Content: []Content{Text("done")}}, nil
+		})
+	srv := NewServer(registry, NewResourceRegistry(), &ServerConfig{
+		LogRedactor: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == "token" {
+				a.Value = slog.StringValue("[REDACTED]")
+			}
+			return a
+		},
+	})
+
+	run := func(meta map[string]interface{}) []transport.BufferedNotification {
+		w := transport.NewBufferedResponseWriter()
+		srv.HandleMessage(context.Background(), buildRequest(t, 1, "tools/call", map[string]interface{}{
+			"_meta": meta, "name": "report", "arguments": map[string]interface{}{},
+		}), w)
+		return w.Notifications()
+	}
+
+	if got := run(validMeta()); len(got) != 0 {
+		t.Errorf("without a logLevel: %d notifications, want none", len(got))
+	}
+
+	meta := validMeta()
+	meta[metaKeyLogLevel] = "info"
+	got := run(meta)
+	if len(got) != 2 {
+		t.Fatalf("got %d notifications, want 2 (info and warning; debug is below the client's level): %+v", len(got), got)
+	}
+	info, ok := got[0].Params.(LoggingMessageParams)
+	if got[0].Method != "notifications/message" || !ok {
+		t.Fatalf("notification 0 = %+v, want notifications/message", got[0])
+	}
+	data := info.Data.(map[string]interface{})
+	if info.Level != "info" || info.Logger != "report" || data["message"] != "fetching" || data["job"] != int64(7) {
+		t.Errorf("info notification = %+v, want level info from logger report with message and job", info)
+	}
+	if data["token"] != "[REDACTED]" || data["err"] != "retrying" {
+		t.Errorf("info data = %v, want token redacted and err as its message", data)
+	}
+	if data["attr.message"] != "from an attribute" {
+		t.Errorf("info data = %v, want the message attribute kept under attr.message", data)
+	}
+	warn := got[1].Params.(LoggingMessageParams)
+	if warn.Level != "warning" || warn.Data.(map[string]interface{})["db"].(map[string]interface{})["ms"] != int64(900) {
+		t.Errorf("warning notification = %+v, want level warning with ms nested under db", warn)
+	}
+}
+
+func TestTasksRunToolsAsynchronously(t *testing.T) {
+	type principalKey struct{}
+	release := make(chan struct{})
+	registry := NewToolRegistry()
+	registry.Register(Tool{Name: "slow", InputSchema: json.RawMessage(`{"type":"object"}`)},
+		func(ctx context.Context, req *ToolRequest) (Result, error) {
+			select {
+			case <-release:
+				return &ToolCallResult{Content: []Content{Text("finished")}}, nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		})
+	srv := NewServer(registry, NewResourceRegistry(), &ServerConfig{
+		PrincipalFromContext: func(ctx context.Context) string {
+			p, _ := ctx.Value(principalKey{}).(string)
+			return p
+		},
+		Tasks: &TasksConfig{Workers: 2, PollInterval: 250 * time.Millisecond},
+	})
+	callAs := func(principal, method string, params map[string]interface{}) rpcResponseEnvelope {
+		t.Helper()
+		params["_meta"] = validMeta()
+		w := transport.NewBufferedResponseWriter()
+		ctx := context.WithValue(context.Background(), principalKey{}, principal)
+		srv.HandleMessage(ctx, buildRequest(t, 1, method, params), w)
+		var env rpcResponseEnvelope
+		if err := json.Unmarshal(w.Message(), &env); err != nil {
+			t.Fatalf("unmarshal %s response: %v", method, err)
+		}
+		return env
+	}
+	startTask := func() Task {
+		t.Helper()
+		env := callAs("alice", "tools/call", map[string]interface{}{
+			"name": "slow", "arguments": map[string]interface{}{}, "task": map[string]interface{}{"ttl": 60000},
+		})
+		var created CreateTaskResult
+		if env.Error != nil || json.Unmarshal(env.Result, &created) != nil {
+			t.Fatalf("task-augmented tools/call = %+v, %s", env.Error, env.Result)
+		}
+		if created.Task.TaskID == "" || created.Task.Status != TaskStatusWorking || created.Task.TTL != 60000 || created.Task.PollInterval != 250 {
+			t.Fatalf("created task = %+v, want working with the requested ttl and configured pollInterval", created.Task)
+		}
+		return created.Task
+	}
+
+	discover := callAs("alice", "server/discover", map[string]interface{}{})
+	var caps struct {
+		Capabilities ServerCapabilities `json:"capabilities"`
+	}
+	_ = json.Unmarshal(discover.Result, &caps)
+	if _, ok := caps.Capabilities.Extensions[ExtensionTasks]; !ok {
+		t.Errorf("capabilities.extensions = %v, want %s advertised", caps.Capabilities.Extensions, ExtensionTasks)
+	}
+
+	task := startTask()
+	if env := callAs("mallory", "tasks/get", map[string]interface{}{"taskId": task.TaskID}); env.Error == nil || env.Error.Code != transport.InvalidParams {
+		t.Errorf("tasks/get by another principal = %+v, want -32602 (unknown task)", env.Error)
+	}
+	close(release)
+	env := callAs("alice", "tasks/result", map[string]interface{}{"taskId": task.TaskID})
+	var result ToolCallResult
+	if env.Error != nil || json.Unmarshal(env.Result, &result) != nil || len(result.Content) != 1 || result.Content[0].Text != "finished" {
+		t.Fatalf("tasks/result = %+v, %s; want the tool's result", env.Error, env.Result)
+	}
+	var status TaskStatusResult
+	_ = json.Unmarshal(callAs("alice", "tasks/get", map[string]interface{}{"taskId": task.TaskID}).Result, &status)
+	if status.Status != TaskStatusCompleted {
+		t.Errorf("status after tasks/result = %q, want completed", status.Status)
+	}
+
+	// release is closed now; re-register slow so the next task runs until cancelled.
+	block := make(chan struct{})
+	defer close(block)
+	registry.Register(Tool{Name: "slow", InputSchema: json.RawMessage(`{"type":"object"}`)},
+		func(ctx context.Context, req *ToolRequest) (Result, error) {
+			select {
+			case <-block:
+			case <-ctx.Done():
+			}
+			return nil, ctx.Err()
+		})
+	task = startTask()
+	env = callAs("alice", "tasks/cancel", map[string]interface{}{"taskId": task.TaskID})
+	if env.Error != nil || json.Unmarshal(env.Result, &status) != nil || status.Status != TaskStatusCancelled {
+		t.Fatalf("tasks/cancel = %+v, %s; want status cancelled", env.Error, env.Result)
+	}
+	if env := callAs("alice", "tasks/cancel", map[string]interface{}{"taskId": task.TaskID}); env.Error == nil || env.Error.Code != transport.InvalidParams {
+		t.Errorf("second tasks/cancel = %+v, want -32602 (already terminal)", env.Error)
+	}
+	if env := callAs("alice", "tasks/result", map[string]interface{}{"taskId": task.TaskID}); env.Error == nil {
+		t.Errorf("tasks/result of a cancelled task = %s, want an error", env.Result)
+	}
+}
+
+func TestTaskTTLIsClampedToMaxTTL(t *testing.T) {
+	registry := NewToolRegistry()
+	registry.Register(Tool{Name: "noop", InputSchema: json.RawMessage(`{"type":"object"}`)},
+		func(ctx context.Context, req *ToolRequest) (Result, error) {
+			return &ToolCallResult{}, nil
+		})
+	srv := NewServer(registry, NewResourceRegistry(), &ServerConfig{Tasks: &TasksConfig{MaxTTL: time.Hour}})
+	defer srv.Shutdown(context.Background())
+	// math.MaxInt64 milliseconds overflows time.Duration if converted before clamping.
+	env := call(t, srv, 1, "tools/call", map[string]interface{}{
+		"_meta": validMeta(), "name": "noop", "arguments": map[string]interface{}{}, "task": map[string]interface{}{"ttl": int64(math.MaxInt64)},
+	})
+	var created CreateTaskResult
+	if env.Error != nil || json.Unmarshal(env.Result, &created) != nil || created.Task.TTL != time.Hour.Milliseconds() {
+		t.Errorf("task with a huge ttl = %+v, %s; want ttl clamped to MaxTTL (%d)", env.Error, env.Result, time.Hour.Milliseconds())
+	}
+}
+
+func TestShutdownStopsTaskWorkers(t *testing.T) {
+	registry := NewToolRegistry()
+	registry.Register(Tool{Name: "forever", InputSchema: json.RawMessage(`{"type":"object"}`)},
+		func(ctx context.Context, req *ToolRequest) (Result, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+	srv := NewServer(registry, NewResourceRegistry(), &ServerConfig{Tasks: &TasksConfig{Workers: 1}})
+	startTask := func(id int) rpcResponseEnvelope {
+		return call(t, srv, id, "tools/call", map[string]interface{}{
+			"_meta": validMeta(), "name": "forever", "arguments": map[string]interface{}{}, "task": map[string]interface{}{},
+		})
+	}
+	var created CreateTaskResult
+	if env := startTask(1); env.Error != nil || json.Unmarshal(env.Result, &created) != nil {
+		t.Fatalf("task-augmented tools/call = %+v, %s", env.Error, env.Result)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown with a running task = %v, want the workers stopped", err)
+	}
+	var status TaskStatusResult
+	env := call(t, srv, 2, "tasks/get", map[string]interface{}{"_meta": validMeta(), "taskId": created.Task.TaskID})
+	if env.Error != nil || json.Unmarshal(env.Result, &status) != nil || status.Status != TaskStatusCancelled {
+		t.Errorf("tasks/get after Shutdown = %+v, %s; want cancelled", env.Error, env.Result)
+	}
+	if env := startTask(3); env.Error == nil || env.Error.Code != transport.InternalError {
+		t.Errorf("task-augmented tools/call after Shutdown = %+v, want -32603", env.Error)
+	}
+}
+
+// stuckWriter acknowledges a subscriptions/listen but cannot write its final result until
+// release is closed, so the listen never finishes draining before then.
+type stuckWriter struct {
+	acked   chan struct{}
+	once    sync.Once
+	release chan struct{}
+}
+
+func (w *stuckWriter) WriteNotification(string, interface{}) error {
+	w.once.Do(func() { close(w.acked) })
+	return nil
+}
+
+func (w *stuckWriter) WriteMessage([]byte) error {
+	<-w.release
+	return nil
+}
+
+func TestShutdownStopsTaskWorkersEvenWhenListensOutlastTheDeadline(t *testing.T) {
+	registry := NewToolRegistry()
+	registry.Register(Tool{Name: "forever", InputSchema: json.RawMessage(`{"type":"object"}`)},
+		func(ctx context.Context, req *ToolRequest) (Result, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+	srv := NewServer(registry, NewResourceRegistry(), &ServerConfig{Tasks: &TasksConfig{Workers: 1}})
+	startTask := func(id int) rpcResponseEnvelope {
+		return call(t, srv, id, "tools/call", map[string]interface{}{
+			"_meta": validMeta(), "name": "forever", "arguments": map[string]interface{}{}, "task": map[string]interface{}{},
+		})
+	}
+	var created CreateTaskResult
+	if env := startTask(1); env.Error != nil || json.Unmarshal(env.Result, &created) != nil {
+		t.Fatalf("task-augmented tools/call = %+v, %s", env.Error, env.Result)
+	}
+
+	w := &stuckWriter{acked: make(chan struct{}), release: make(chan struct{})}
+	defer close(w.release)
+	go srv.HandleMessage(context.Background(), buildRequest(t, 2, "subscriptions/listen", map[string]interface{}{
+		"_meta": validMeta(), "notifications": map[string]interface{}{"toolsListChanged": true},
+	}), w)
+	select {
+	case <-w.acked:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for subscriptions/listen acknowledgment")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := srv.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown with a listen stuck writing = %v, want the deadline's error", err)
+	}
+	var status TaskStatusResult
+	env := call(t, srv, 3, "tasks/get", map[string]interface{}{"_meta": validMeta(), "taskId": created.Task.TaskID})
+	if env.Error != nil || json.Unmarshal(env.Result, &status) != nil || status.Status != TaskStatusCancelled {
+		t.Errorf("tasks/get after a timed-out Shutdown = %+v, %s; want cancelled", env.Error, env.Result)
+	}
+	if env := startTask(4); env.Error == nil || env.Error.Code != transport.InternalError {
+		t.Errorf("task-augmented tools/call after a timed-out Shutdown = %+v, want -32603", env.Error)
+	}
+}
+
+func TestTasksDisabledByDefault(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	env := call(t, srv, 1, "tools/call", map[string]interface{}{
+		"_meta": validMeta(), "name": "echo", "arguments": map[string]interface{}{"text": "hi"}, "task": map[string]interface{}{},
+	})
+	var result ToolCallResult
+	if env.Error != nil || json.Unmarshal(env.Result, &result) != nil || len(result.Content) != 1 || result.Content[0].Text != "hi" {
+		t.Errorf("tools/call with task on a server without Tasks = %+v, %s; want it run synchronously", env.Error, env.Result)
+	}
+	if env := call(t, srv, 2, "tasks/get", map[string]interface{}{"_meta": validMeta(), "taskId": "x"}); env.Error == nil || env.Error.Code != transport.MethodNotFound {
+		t.Errorf("tasks/get without Tasks = %+v, want method not found", env.Error)
+	}
+}
+
+func TestMiddlewareOrderShortCircuitAndErrors(t *testing.T) {
+	var trace []string
+	record := func(name string) Middleware {
+		return func(next RequestHandler) RequestHandler {
+			return func(ctx context.Context, req *Request) (Result, *transport.RPCError) {
+				trace = append(trace, name+">"+req.Method)
+				result, rerr := next(ctx, req)
+				outcome := "ok"
+				if rerr != nil {
+					outcome = "error"
+				}
+				trace = append(trace, name+"<"+outcome)
+				return result, rerr
+			}
+		}
+	}
+	deny := func(next RequestHandler) RequestHandler {
+		return func(ctx context.Context, req *Request) (Result, *transport.RPCError) {
+			if req.Method == "tools/call" {
+				var p ToolsCallParams
+				_ = json.Unmarshal(req.Params, &p)
+				if p.Name == "fail" {
+					return nil, &transport.RPCError{Code: -32001, Message: "forbidden"}
+				}
+			}
+			return next(ctx, req)
+		}
+	}
+	registry := NewToolRegistry()
+	registry.Register(Tool{Name: "echo", InputSchema: json.RawMessage(`{"type":"object"}`)},
+		func(ctx context.Context, req *ToolRequest) (Result, error) {
+			trace = append(trace, "tool")
+			return &ToolCallResult{Content: []Content{Text("ok")}}, nil
+		})
+	registry.Register(Tool{Name: "fail", InputSchema: json.RawMessage(`{"type":"object"}`)},
+		func(ctx context.Context, req *ToolRequest) (Result, error) {
+			trace = append(trace, "fail ran")
+			return nil, nil
+		})
+	srv := NewServer(registry, NewResourceRegistry(), &ServerConfig{
+		Middleware: []Middleware{record("outer"), record("inner"), deny},
+	})
+	check := func(want ...string) {
+		t.Helper()
+		if len(trace) != len(want) {
+			t.Fatalf("trace = %v, want %v", trace, want)
+		}
+		for i := range want {
+			if trace[i] != want[i] {
+				t.Fatalf("trace = %v, want %v", trace, want)
+			}
+		}
+		trace = nil
+	}
+
+	env := call(t, srv, 1, "tools/call", map[string]interface{}{"_meta": validMeta(), "name": "echo", "arguments": map[string]interface{}{}})
+	if env.Error != nil {
+		t.Fatalf("echo through the chain: %+v", env.Error)
+	}
+	check("outer>tools/call", "inner>tools/call", "tool", "inner<ok", "outer<ok")
+
+	env = call(t, srv, 2, "tools/call", map[string]interface{}{"_meta": validMeta(), "name": "fail", "arguments": map[string]interface{}{}})
+	if env.Error == nil || env.Error.Code != -32001 {
+		t.Fatalf("short-circuited call = %+v, want the middleware's -32001", env.Error)
+	}
+	check("outer>tools/call", "inner>tools/call", "inner<error", "outer<error")
+
+	env = call(t, srv, 3, "no/such/method", map[string]interface{}{"_meta": validMeta()})
+	if env.Error == nil || env.Error.Code != transport.MethodNotFound {
+		t.Fatalf("unknown method = %+v, want method not found", env.Error)
+	}
+	check("outer>no/such/method", "inner>no/such/method", "inner<error", "outer<error")
+
+	// Requests rejected before routing never enter the chain.
+	_ = call(t, srv, 4, "tools/list", map[string]interface{}{})
+	check()
+}
+
+func TestToolMiddlewareWrapsToolFunctions(t *testing.T) {
+	srv, registry, _ := newTestServer(t)
+	var trace []string
+	tag := func(name string) ToolMiddleware {
+		return func(next ToolFunction) ToolFunction {
+			return func(ctx context.Context, req *ToolRequest) (Result, error) {
+				trace = append(trace, name+">"+req.Name)
+				result, err := next(ctx, req)
+				trace = append(trace, name+"<")
+				return result, err
+			}
+		}
+	}
+	registry.Use(tag("a"), tag("b"))
+	registry.Use(func(next ToolFunction) ToolFunction {
+		return func(ctx context.Context, req *ToolRequest) (Result, error) {
+			if req.Name == "fail" {
+				return nil, errors.New("blocked by policy")
+			}
+			return next(ctx, req)
+		}
+	})
+
+	env := call(t, srv, 1, "tools/call", map[string]interface{}{"_meta": validMeta(), "name": "echo", "arguments": map[string]interface{}{"text": "hi"}})
+	if env.Error != nil {
+		t.Fatalf("echo: %+v", env.Error)
+	}
+	if got := fmt.Sprint(trace); got != "[a>echo b>echo b< a<]" {
+		t.Errorf("trace = %s, want a outermost around b", got)
+	}
+
+	trace = nil
+	env = call(t, srv, 2, "tools/call", map[string]interface{}{"_meta": validMeta(), "name": "echo", "arguments": map[string]interface{}{}})
+	if env.Error == nil || env.Error.Code != transport.InvalidParams || len(trace) != 0 {
+		t.Errorf("invalid arguments = %+v with trace %v, want -32602 before any ToolMiddleware runs", env.Error, trace)
+	}
+
+	env = call(t, srv, 3, "tools/call", map[string]interface{}{"_meta": validMeta(), "name": "fail", "arguments": map[string]interface{}{}})
+	if env.Error == nil || env.Error.Code != transport.InternalError {
+		t.Errorf("blocked tool = %+v, want the ToolMiddleware's error as -32603", env.Error)
+	}
+}
+
+func TestVisibilityFiltersCatalogPerPrincipal(t *testing.T) {
+	type principalKey struct{}
+	registry := NewToolRegistry()
+	for _, name := range []string{"public_tool", "admin_tool"} {
+		registry.Register(Tool{Name: name, InputSchema: json.RawMessage(`{"type":"object"}`)},
+			func(ctx context.Context, req *ToolRequest) (Result, error) {
+				return &ToolCallResult{Content: []Content{Text(req.Name)}}, nil
+			})
+	}
+	resources := NewResourceRegistry()
+	resources.Register(Resource{URI: "test:///admin", Name: "admin"}, func(ctx context.Context) (ResourceContentResult, error) {
+		return ResourceContentResult{Text: "secret"}, nil
+	})
+	var seenPrincipals []string
+	srv := NewServer(registry, resources, &ServerConfig{
+		PrincipalFromContext: func(ctx context.Context) string {
+			p, _ := ctx.Value(principalKey{}).(string)
+			return p
+		},
+		ToolVisible: func(ctx context.Context, principal string, tool Tool) bool {
+			seenPrincipals = append(seenPrincipals, principal)
+			return principal == "admin" || !strings.HasPrefix(tool.Name, "admin_")
+		},
+		ResourceVisible: func(ctx context.Context, principal string, res Resource) bool {
+			return principal == "admin"
+		},
+	})
+	callAs := func(principal, method string, params map[string]interface{}) rpcResponseEnvelope {
+		t.Helper()
+		params["_meta"] = validMeta()
+		w := transport.NewBufferedResponseWriter()
+		ctx := context.WithValue(context.Background(), principalKey{}, principal)
+		srv.HandleMessage(ctx, buildRequest(t, 1, method, params), w)
+		var env rpcResponseEnvelope
+		if err := json.Unmarshal(w.Message(), &env); err != nil {
+			t.Fatalf("unmarshal %s response: %v", method, err)
+		}
+		return env
+	}
+	toolNames := func(principal string) []string {
+		t.Helper()
+		var res ToolsListResult
+		env := callAs(principal, "tools/list", map[string]interface{}{})
+		if env.Error != nil || json.Unmarshal(env.Result, &res) != nil {
+			t.Fatalf("tools/list as %s = %+v", principal, env.Error)
+		}
+		if res.CacheScope != CacheScopePrivate {
+			t.Errorf("tools/list cacheScope = %q, want private while filtering", res.CacheScope)
+		}
+		var names []string
+		for _, tool := range res.Tools {
+			names = append(names, tool.Name)
+		}
+		return names
+	}
+
+	if got := fmt.Sprint(toolNames("admin")); got != "[public_tool admin_tool]" {
+		t.Errorf("admin sees %s, want both tools", got)
+	}
+	if got := fmt.Sprint(toolNames("guest")); got != "[public_tool]" {
+		t.Errorf("guest sees %s, want only public_tool", got)
+	}
+	if len(seenPrincipals) == 0 || seenPrincipals[len(seenPrincipals)-1] != "guest" {
+		t.Errorf("ToolVisible saw principals %v, want PrincipalFromContext's", seenPrincipals)
+	}
+
+	hidden := callAs("guest", "tools/call", map[string]interface{}{"name": "admin_tool", "arguments": map[string]interface{}{}})
+	unknown := callAs("guest", "tools/call", map[string]interface{}{"name": "no_such_tool", "arguments": map[string]interface{}{}})
+	if hidden.Error == nil || unknown.Error == nil || hidden.Error.Code != unknown.Error.Code ||
+		strings.Replace(hidden.Error.Message, "admin_tool", "no_such_tool", 1) != unknown.Error.Message {
+		t.Errorf("hidden tool call = %+v, want it indistinguishable from an unknown tool (%+v)", hidden.Error, unknown.Error)
+	}
+	if env := callAs("admin", "tools/call", map[string]interface{}{"name": "admin_tool", "arguments": map[string]interface{}{}}); env.Error != nil {
+		t.Errorf("admin tools/call admin_tool = %+v", env.Error)
+	}
+
+	if env := callAs("guest", "resources/read", map[string]interface{}{"uri": "test:///admin"}); env.Error == nil || env.Error.Code != transport.InvalidParams {
+		t.Errorf("guest resources/read of a hidden resource = %+v, want -32602", env.Error)
+	}
+	if env := callAs("admin", "resources/read", map[string]interface{}{"uri": "test:///admin"}); env.Error != nil {
+		t.Errorf("admin resources/read = %+v", env.Error)
+	}
+
+	var disc DiscoverResult
+	if env := callAs("guest", "server/discover", map[string]interface{}{}); env.Error != nil || json.Unmarshal(env.Result, &disc) != nil {
+		t.Fatalf("server/discover = %+v", env.Error)
+	}
+	if disc.Capabilities.Tools == nil || disc.Capabilities.Resources != nil {
+		t.Errorf("guest capabilities = %+v, want tools but no resources", disc.Capabilities)
+	}
+}
@@ -22,7 +22,7 @@ func (s *Server) handleDiscover(ctx context.Context, meta *RequestMeta) (Result,
 	return &DiscoverResult{
 		CacheableResult:   NewCacheableResult(s.listTTLMs, s.cacheScope()),
 		SupportedVersions: SupportedVersions,
-		Capabilities:      s.capabilities(),
+		Capabilities:      s.capabilities(ctx),
 		Instructions:      s.config.Instructions,
 	}, nil
 }
@@ -13,12 +13,34 @@ func invalidParamsErr(format string, args ...interface{}) *transport.RPCError {
 	return &transport.RPCError{Code: transport.InvalidParams, Message: fmt.Sprintf(format, args...)}
 }
 
+// invalidArgumentsErr builds the -32602 error for tools/call arguments that do not conform
+// to the tool's inputSchema, carrying the JSON Pointer to the offending value as data.path.
+func invalidArgumentsErr(verr *ValidationError) *transport.RPCError {
+	return &transport.RPCError{
+		Code:    transport.InvalidParams,
+		Message: "Invalid arguments: " + verr.Error(),
+		Data:    map[string]interface{}{"path": verr.Path},
+	}
+}
+
 // internalErr wraps an unexpected Go error (as opposed to a tool execution error, which
 // is reported as isError:true in a normal result, not a JSON-RPC error) as -32603.
 func internalErr(err error) *transport.RPCError {
 	return &transport.RPCError{Code: transport.InternalError, Message: err.Error()}
 }
 
+// shuttingDownErr is the -32603 a subscriptions/listen gets once Server.Shutdown has been
+// called.
+func shuttingDownErr() *transport.RPCError {
+	return &transport.RPCError{Code: transport.InternalError, Message: "Server is shutting down"}
+}
+
+// resourceTooLargeErr is the -32603 a resources/read gets when its content exceeds
+// ServerConfig.MaxResourceSize.
+func resourceTooLargeErr(uri string, limit int64) *transport.RPCError {
+	return &transport.RPCError{Code: transport.InternalError, Message: fmt.Sprintf("Resource %s exceeds the %d-byte size limit", uri, limit)}
+}
+
 // unsupportedProtocolVersionErr builds the -32022 error a request gets when it declares a
 // protocol version this server does not implement.
 func unsupportedProtocolVersionErr(requested string) *transport.RPCError {
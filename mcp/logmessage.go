@@ -0,0 +1,233 @@
+package mcp
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/spirilis/generic-go-mcp/logging"
+)
+
+// LoggingMessageParams is the params of a notifications/message notification. Data is
+// an object holding the record's message, under "message", and its attributes. An
+// attribute that is itself named "message" is kept under "attr.message".
+type LoggingMessageParams struct {
+	Level  string      `json:"level"`
+	Logger string      `json:"logger,omitempty"`
+	Data   interface{} `json:"data"`
+}
+
+// mcpLogLevels maps the RFC 5424 severities MCP uses (the values of
+// io.modelcontextprotocol/logLevel and of LoggingMessageParams.Level) onto slog levels.
+// debug, info, warning and error are slog's own; the rest sit between and above them.
+var mcpLogLevels = []struct {
+	name  string
+	level slog.Level
+}{
+	{"debug", slog.LevelDebug},
+	{"info", slog.LevelInfo},
+	{"notice", slog.LevelInfo + 2},
+	{"warning", slog.LevelWarn},
+	{"error", slog.LevelError},
+	{"critical", slog.LevelError + 4},
+	{"alert", slog.LevelError + 8},
+	{"emergency", slog.LevelError + 12},
+}
+
+// slogLevelFor returns the slog level of an MCP log level name.
+func slogLevelFor(name string) (slog.Level, bool) {
+	for _, l := range mcpLogLevels {
+		if l.name == name {
+			return l.level, true
+		}
+	}
+	return 0, false
+}
+
+// mcpLevelName returns the MCP log level a slog level is reported as: the highest MCP
+// level at or below it, with anything below debug (logging.LevelTrace) reported as debug.
+func mcpLevelName(level slog.Level) string {
+	name := mcpLogLevels[0].name
+	for _, l := range mcpLogLevels {
+		if level >= l.level {
+			name = l.name
+		}
+	}
+	return name
+}
+
+// requestLogHandler is the slog.Handler behind ToolRequest.Logger. Every record goes to
+// the global logging handler (stderr) as usual; records at or above the level the client
+// asked for in io.modelcontextprotocol/logLevel are also sent to the client as
+// notifications/message on the request's own response stream. Attributes pass through the
+// server's LogRedactor first, for both destinations.
+type requestLogHandler struct {
+	base     slog.Handler
+	n        *requestNotifier
+	logger   string
+	toClient bool
+	minLevel slog.Level
+	redact   func(groups []string, a slog.Attr) slog.Attr
+	groups   []string
+	data     map[string]interface{} // WithAttrs attributes, already redacted, nested by group
+}
+
+func newRequestLogger(n *requestNotifier, name, clientLevel string, redact func([]string, slog.Attr) slog.Attr) *slog.Logger {
+	h := &requestLogHandler{
+		base:   logging.Handler().WithAttrs([]slog.Attr{slog.String("tool", name)}),
+		n:      n,
+		logger: name,
+		redact: redact,
+		data:   map[string]interface{}{},
+	}
+	h.minLevel, h.toClient = slogLevelFor(clientLevel)
+	return slog.New(h)
+}
+
+func (h *requestLogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return (h.toClient && level >= h.minLevel) || h.base.Enabled(ctx, level)
+}
+
+func (h *requestLogHandler) Handle(ctx context.Context, r slog.Record) error {
+	out := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	var data map[string]interface{}
+	if h.toClient && r.Level >= h.minLevel {
+		data = cloneLogData(h.data)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		a = h.redactAttr(h.groups, a)
+		if a.Key == "" {
+			return true
+		}
+		out.AddAttrs(a)
+		if data != nil {
+			addLogData(data, h.groups, a)
+		}
+		return true
+	})
+
+	var err error
+	if h.base.Enabled(ctx, r.Level) {
+		err = h.base.Handle(ctx, out)
+	}
+	if data != nil {
+		shiftLogData(data, "message")
+		data["message"] = r.Message
+		if nerr := h.n.notify("notifications/message", LoggingMessageParams{
+			Level:  mcpLevelName(r.Level),
+			Logger: h.logger,
+			Data:   data,
+		}); err == nil {
+			err = nerr
+		}
+	}
+	return err
+}
+
+func (h *requestLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.data = cloneLogData(h.data)
+	redacted := make([]slog.Attr, 0, len(attrs))
+	for _, a := range attrs {
+		a = h.redactAttr(h.groups, a)
+		if a.Key == "" {
+			continue
+		}
+		redacted = append(redacted, a)
+		addLogData(h2.data, h.groups, a)
+	}
+	h2.base = h.base.WithAttrs(redacted)
+	return &h2
+}
+
+func (h *requestLogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.base = h.base.WithGroup(name)
+	h2.groups = append(append([]string{}, h.groups...), name)
+	return &h2
+}
+
+// redactAttr applies the redaction hook to a and, for a group, to each of its members,
+// with the same groups argument slog.HandlerOptions.ReplaceAttr gets.
+func (h *requestLogHandler) redactAttr(groups []string, a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() == slog.KindGroup {
+		members := a.Value.Group()
+		inner := append(append([]string{}, groups...), a.Key)
+		redacted := make([]slog.Attr, 0, len(members))
+		for _, m := range members {
+			if m = h.redactAttr(inner, m); m.Key != "" {
+				redacted = append(redacted, m)
+			}
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(redacted...)}
+	}
+	if h.redact == nil {
+		return a
+	}
+	return h.redact(groups, a)
+}
+
+// addLogData stores a in data under the nested map for groups.
+// shiftLogData moves an attribute out of data[key], if one is there, to "attr."+key, first
+// shifting whatever holds that key the same way, so the record's own field can take key
+// without losing it.
+func shiftLogData(data map[string]interface{}, key string) {
+	v, ok := data[key]
+	if !ok {
+		return
+	}
+	next := "attr." + key
+	shiftLogData(data, next)
+	data[next] = v
+	delete(data, key)
+}
+
+func addLogData(data map[string]interface{}, groups []string, a slog.Attr) {
+	for _, g := range groups {
+		inner, ok := data[g].(map[string]interface{})
+		if !ok {
+			inner = map[string]interface{}{}
+			data[g] = inner
+		}
+		data = inner
+	}
+	data[a.Key] = logDataValue(a.Value)
+}
+
+// logDataValue converts an attribute value into something that marshals to the JSON a
+// client would expect: errors as their message, times and durations as strings, groups as
+// objects.
+func logDataValue(v slog.Value) interface{} {
+	switch v.Kind() {
+	case slog.KindGroup:
+		m := map[string]interface{}{}
+		for _, a := range v.Group() {
+			m[a.Key] = logDataValue(a.Value.Resolve())
+		}
+		return m
+	case slog.KindTime:
+		return v.Time().Format(time.RFC3339Nano)
+	case slog.KindDuration:
+		return v.Duration().String()
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok {
+			return err.Error()
+		}
+	}
+	return v.Any()
+}
+
+func cloneLogData(data map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		if m, ok := v.(map[string]interface{}); ok {
+			v = cloneLogData(m)
+		}
+		out[k] = v
+	}
+	return out
+}
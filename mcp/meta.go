@@ -40,6 +40,25 @@ type ClientCapabilities struct {
 	Extensions  map[string]json.RawMessage `json:"extensions,omitempty"`
 }
 
+// MarshalJSON keeps a declared-but-empty capability such as "elicitation": {}, which
+// omitempty would drop — and declaring it is all a server checks for.
+func (c ClientCapabilities) MarshalJSON() ([]byte, error) {
+	out := map[string]interface{}{}
+	if c.Roots != nil {
+		out["roots"] = c.Roots
+	}
+	if c.Sampling != nil {
+		out["sampling"] = c.Sampling
+	}
+	if c.Elicitation != nil {
+		out["elicitation"] = c.Elicitation
+	}
+	if c.Extensions != nil {
+		out["extensions"] = c.Extensions
+	}
+	return json.Marshal(out)
+}
+
 // HasElicitation reports whether the client declared support for elicitation on this
 // request — required before a tool may send an elicitation/create MRTR inputRequest.
 func (c *ClientCapabilities) HasElicitation() bool {
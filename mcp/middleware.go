@@ -0,0 +1,65 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/spirilis/generic-go-mcp/transport"
+)
+
+// Request is one parsed JSON-RPC request as the Middleware chain sees it: its method,
+// validated per-request metadata, and raw params (still including _meta).
+type Request struct {
+	Method string
+	ID     json.RawMessage
+	Meta   *RequestMeta
+	Params json.RawMessage
+
+	w transport.ResponseWriter // for request-scoped notifications; kept by a *req copy
+}
+
+// RequestHandler handles one Request, returning its result or its JSON-RPC error.
+type RequestHandler func(ctx context.Context, req *Request) (Result, *transport.RPCError)
+
+// Middleware wraps a RequestHandler. It may inspect or rewrite the request before calling
+// next (to change params, pass a modified copy: r := *req), inspect or replace what next
+// returns, or short-circuit by returning without calling next at all — to reject a
+// request, for instance:
+//
+//	func(next mcp.RequestHandler) mcp.RequestHandler {
+//	    return func(ctx context.Context, req *mcp.Request) (mcp.Result, *transport.RPCError) {
+//	        start := time.Now()
+//	        result, rerr := next(ctx, req)
+//	        metrics.Observe(req.Method, time.Since(start), rerr)
+//	        return result, rerr
+//	    }
+//	}
+//
+// Every request and method reaching the router passes through the chain, including one
+// that turns out to be Method not found. Requests rejected before routing (unparseable
+// JSON, invalid _meta, the legacy initialize) and the long-lived subscriptions/listen
+// stream do not.
+type Middleware func(next RequestHandler) RequestHandler
+
+// ToolMiddleware wraps the ToolFunction of every tool in a ToolRegistry (see
+// ToolRegistry.Use). It runs once the call's arguments have passed InputSchema
+// validation, and what it returns is what the OutputSchema check sees. Like Middleware it
+// may short-circuit by not calling next.
+type ToolMiddleware func(next ToolFunction) ToolFunction
+
+// chainMiddleware composes mw around h. mw[0] is outermost: it sees the request first and
+// the outcome last.
+func chainMiddleware(h RequestHandler, mw []Middleware) RequestHandler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
+
+// chainToolMiddleware composes mw around fn, mw[0] outermost.
+func chainToolMiddleware(fn ToolFunction, mw []ToolMiddleware) ToolFunction {
+	for i := len(mw) - 1; i >= 0; i-- {
+		fn = mw[i](fn)
+	}
+	return fn
+}
@@ -76,30 +76,44 @@ func newInputRequiredResult(reqs InputRequests, state string) *InputRequiredResu
 	return r
 }
 
+// NewInputRequiredResult builds an InputRequiredResult carrying reqs and an opaque
+// requestState issued by someone else: it is for a RegisterForwarded tool relaying another
+// server's round trip unchanged. A tool asking for input itself uses ToolRequest.NeedInput,
+// which signs the state.
+func NewInputRequiredResult(reqs InputRequests, requestState string) *InputRequiredResult {
+	return newInputRequiredResult(reqs, requestState)
+}
+
 // requestStatePayload is the signed content of a requestState blob: the caller identity
-// it was issued to, an expiry, and a digest binding it to the exact tool call it was
-// issued for, so it cannot be replayed against a different call or a different caller.
+// it was issued to, an expiry, and a digest binding it to the exact request it was issued
+// for, so it cannot be replayed against a different call or a different caller.
 type requestStatePayload struct {
 	Principal string `json:"p"`
 	Expiry    int64  `json:"exp"`
 	Digest    string `json:"d"`
 }
 
-func digestMethodArgs(name string, arguments json.RawMessage) string {
+// digestMethodArgs binds a requestState to one request: the method, the name of what it
+// targets (a tool name for tools/call, a URI for resources/read), and its arguments, if
+// any. The method is part of the digest so a blob issued for one method can never verify
+// against another that happens to share a name.
+func digestMethodArgs(method, name string, arguments json.RawMessage) string {
 	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{0})
 	h.Write([]byte(name))
 	h.Write([]byte{0})
 	h.Write(arguments)
 	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
 }
 
-// signRequestState signs an opaque requestState blob for a call to tool name with
-// arguments, bound to principal and expiring after requestStateTTL.
-func (s *Server) signRequestState(principal, name string, arguments json.RawMessage) string {
+// signRequestState signs an opaque requestState blob for a method request targeting name
+// with arguments, bound to principal and expiring after requestStateTTL.
+func (s *Server) signRequestState(principal, method, name string, arguments json.RawMessage) string {
 	payload := requestStatePayload{
 		Principal: principal,
 		Expiry:    time.Now().Add(requestStateTTL).Unix(),
-		Digest:    digestMethodArgs(name, arguments),
+		Digest:    digestMethodArgs(method, name, arguments),
 	}
 	body, _ := json.Marshal(payload)
 	mac := hmac.New(sha256.New, s.config.RequestStateKey)
@@ -109,11 +123,11 @@ func (s *Server) signRequestState(principal, name string, arguments json.RawMess
 }
 
 // verifyRequestState checks a requestState blob echoed back on a retry: signature,
-// expiry, calling principal, and that it was issued for this exact tool call.
+// expiry, calling principal, and that it was issued for this exact request.
 // requestState is attacker-controlled (it passes through the client), so every check
 // here matters — a tampered, expired, cross-principal, or cross-request blob is
 // rejected rather than trusted.
-func (s *Server) verifyRequestState(state, principal, name string, arguments json.RawMessage) error {
+func (s *Server) verifyRequestState(state, principal, method, name string, arguments json.RawMessage) error {
 	parts := strings.SplitN(state, ".", 2)
 	if len(parts) != 2 {
 		return fmt.Errorf("malformed requestState")
@@ -142,7 +156,7 @@ func (s *Server) verifyRequestState(state, principal, name string, arguments jso
 	if payload.Principal != principal {
 		return fmt.Errorf("requestState principal mismatch")
 	}
-	if payload.Digest != digestMethodArgs(name, arguments) {
+	if payload.Digest != digestMethodArgs(method, name, arguments) {
 		return fmt.Errorf("requestState does not match the originating request")
 	}
 	return nil
@@ -1,26 +1,35 @@
 package mcp
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"strconv"
+	"strings"
 )
 
-// defaultPageSize bounds how many entries tools/list and resources/list return per page.
+// defaultPageSize bounds how many entries a list method returns per page, unless
+// ServerConfig.PageSize or PageSizes says otherwise.
 const defaultPageSize = 50
 
 var errInvalidCursor = errors.New("invalid cursor")
 
-// EncodeCursor and DecodeCursor implement a simple opaque offset-based pagination cursor.
-// Clients MUST treat cursor values as opaque; base64-encoding a decimal offset lets it
-// round-trip safely as a JSON string while giving callers no reason to try to parse it
-// themselves.
+// EncodeCursor and DecodeCursor implement the offset-based cursor the list methods used
+// before they switched to signed keyset cursors.
+//
+// Deprecated: the server neither issues nor accepts these cursors any more; list cursors
+// are opaque and only the server can produce or read them. The functions are kept so
+// existing callers still compile.
 func EncodeCursor(offset int) string {
 	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
 }
 
 // DecodeCursor reverses EncodeCursor. An empty cursor decodes to offset 0 (the first
 // page).
+//
+// Deprecated: see EncodeCursor.
 func DecodeCursor(cursor string) (int, error) {
 	if cursor == "" {
 		return 0, nil
@@ -36,20 +45,154 @@ func DecodeCursor(cursor string) (int, error) {
 	return offset, nil
 }
 
-// paginate slices items starting at cursor's offset, returning at most pageSize items and
-// the cursor for the next page (empty string if this was the last page).
-func paginate[T any](items []T, cursor string, pageSize int) (page []T, nextCursor string, err error) {
-	offset, err := DecodeCursor(cursor)
-	if err != nil || offset > len(items) {
-		return nil, "", errInvalidCursor
+// keyset gives every entry of a registry a sequence number, issued in registration order
+// and never reused, so a list can be resumed after the last entry a client saw even if
+// entries before or after it have since been removed. Re-registering a key issues it a new
+// number, matching its move to the end of the list. The zero value is ready to use; the
+// owning registry's lock guards it.
+type keyset struct {
+	issued uint64            // last sequence number issued
+	gen    uint64            // bumped by every add and remove
+	seq    map[string]uint64 // live key -> its sequence number
+}
+
+func (k *keyset) add(key string) {
+	if k.seq == nil {
+		k.seq = make(map[string]uint64)
+	}
+	k.issued++
+	k.gen++
+	k.seq[key] = k.issued
+}
+
+func (k *keyset) remove(key string) {
+	delete(k.seq, key)
+	k.gen++
+}
+
+// listing is a registry's entries as of one instant, in list order, each with its key
+// and sequence number, ready to paginate.
+type listing[T any] struct {
+	items  []T
+	keys   []string
+	seqs   []uint64
+	gen    uint64
+	issued uint64
+}
+
+// newListing snapshots items, whose keys key extracts, against ks. Callers must hold the
+// registry's lock.
+func newListing[T any](items []T, key func(T) string, ks *keyset) listing[T] {
+	l := listing[T]{
+		items:  make([]T, len(items)),
+		keys:   make([]string, len(items)),
+		seqs:   make([]uint64, len(items)),
+		gen:    ks.gen,
+		issued: ks.issued,
+	}
+	copy(l.items, items)
+	for i, item := range items {
+		l.keys[i] = key(item)
+		l.seqs[i] = ks.seq[l.keys[i]]
+	}
+	return l
+}
+
+// filter returns the listing with only the entries keep accepts.
+func (l listing[T]) filter(keep func(T) bool) listing[T] {
+	out := listing[T]{gen: l.gen, issued: l.issued}
+	for i, item := range l.items {
+		if keep(item) {
+			out.items = append(out.items, item)
+			out.keys = append(out.keys, l.keys[i])
+			out.seqs = append(out.seqs, l.seqs[i])
+		}
+	}
+	return out
+}
+
+// cursorPayload is what a list cursor encodes: the method it pages, the registry
+// generation it was issued at, and the sequence number and key of the last entry
+// returned. It travels HMAC-signed with ServerConfig.RequestStateKey, like requestState.
+type cursorPayload struct {
+	Method string `json:"m"`
+	Gen    uint64 `json:"g"`
+	Seq    uint64 `json:"s"`
+	Key    string `json:"k"`
+}
+
+// paginate returns the page of l that follows cursor (the first page if cursor is empty),
+// at most the method's page size long, and the cursor for the page after it (empty if this
+// was the last page).
+//
+// A cursor resumes after the last entry it saw, by sequence number, so it stays correct
+// whatever was registered or unregistered in between: removed entries are simply gone, and
+// new ones (including re-registered ones, which moved to the end) are still to come. A
+// cursor that fails its signature, belongs to another method, or names a generation or
+// position this registry never reached (e.g. one issued before a server restart) is
+// rejected with errInvalidCursor.
+func paginate[T any](s *Server, method string, l listing[T], cursor string) (page []T, nextCursor string, err error) {
+	start := 0
+	if cursor != "" {
+		c, err := s.openCursor(cursor)
+		if err != nil || c.Method != method || c.Gen > l.gen || c.Seq > l.issued {
+			return nil, "", errInvalidCursor
+		}
+		for start < len(l.items) && l.seqs[start] <= c.Seq {
+			if l.seqs[start] == c.Seq && c.Gen == l.gen && l.keys[start] != c.Key {
+				return nil, "", errInvalidCursor
+			}
+			start++
+		}
+	}
+	end := start + s.pageSize(method)
+	if end > len(l.items) {
+		end = len(l.items)
+	}
+	if end < len(l.items) {
+		nextCursor = s.sealCursor(cursorPayload{Method: method, Gen: l.gen, Seq: l.seqs[end-1], Key: l.keys[end-1]})
+	}
+	return l.items[start:end], nextCursor, nil
+}
+
+// pageSize is how many entries one page of method holds.
+func (s *Server) pageSize(method string) int {
+	if n := s.config.PageSizes[method]; n > 0 {
+		return n
+	}
+	return s.config.PageSize
+}
+
+func (s *Server) sealCursor(c cursorPayload) string {
+	body, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(body) + "." + base64.RawURLEncoding.EncodeToString(s.cursorMAC(body))
+}
+
+func (s *Server) openCursor(cursor string) (cursorPayload, error) {
+	var c cursorPayload
+	b64Body, b64Sig, ok := strings.Cut(cursor, ".")
+	if !ok {
+		return c, errInvalidCursor
 	}
-	end := offset + pageSize
-	if end > len(items) {
-		end = len(items)
+	body, err := base64.RawURLEncoding.DecodeString(b64Body)
+	if err != nil {
+		return c, errInvalidCursor
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(b64Sig)
+	if err != nil || !hmac.Equal(sig, s.cursorMAC(body)) {
+		return c, errInvalidCursor
 	}
-	page = items[offset:end]
-	if end < len(items) {
-		nextCursor = EncodeCursor(end)
+	if err := json.Unmarshal(body, &c); err != nil {
+		return c, errInvalidCursor
 	}
-	return page, nextCursor, nil
+	return c, nil
+}
+
+// cursorMAC signs a cursor body. The domain prefix keeps a cursor and a requestState,
+// which share the key, from ever being mistaken for one another.
+func (s *Server) cursorMAC(body []byte) []byte {
+	mac := hmac.New(sha256.New, s.config.RequestStateKey)
+	mac.Write([]byte("cursor\x00"))
+	mac.Write(body)
+	return mac.Sum(nil)
 }
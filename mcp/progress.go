@@ -0,0 +1,106 @@
+package mcp
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/spirilis/generic-go-mcp/transport"
+)
+
+// defaultProgressInterval is the minimum spacing between two notifications/progress for
+// the same request unless ServerConfig.ProgressInterval says otherwise.
+const defaultProgressInterval = 100 * time.Millisecond
+
+// ProgressNotificationParams is the params of a notifications/progress notification.
+// Total is omitted when zero (unknown).
+type ProgressNotificationParams struct {
+	ProgressToken json.RawMessage `json:"progressToken"`
+	Progress      float64         `json:"progress"`
+	Total         float64         `json:"total,omitempty"`
+	Message       string          `json:"message,omitempty"`
+}
+
+// requestNotifier writes request-scoped notifications (progress, log messages) to one
+// request's ResponseWriter until closed. It is closed just before the request's final
+// response is written, since nothing may follow that on the response stream; a tool
+// goroutine that outlives its call then has its notifications silently dropped.
+type requestNotifier struct {
+	mu     sync.Mutex
+	w      transport.ResponseWriter
+	closed bool
+}
+
+func newRequestNotifier(w transport.ResponseWriter) *requestNotifier {
+	return &requestNotifier{w: w}
+}
+
+func (n *requestNotifier) notify(method string, params interface{}) error {
+	if n == nil || n.w == nil {
+		return nil
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return nil
+	}
+	return n.w.WriteNotification(method, params)
+}
+
+func (n *requestNotifier) close() {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	n.closed = true
+	n.mu.Unlock()
+}
+
+// progressReporter emits notifications/progress for one request, through that request's
+// requestNotifier. It enforces the spec's rule that progress must increase, and a minimum
+// interval between notifications so a tool reporting from a tight loop cannot flood the
+// connection — stdio in particular has one pipe shared by every in-flight request.
+type progressReporter struct {
+	mu       sync.Mutex
+	n        *requestNotifier
+	token    json.RawMessage
+	interval time.Duration
+	last     time.Time
+	progress float64
+	sent     bool
+}
+
+// newProgressReporter returns nil, a reporter that reports nothing, when the client sent
+// no progress token: progress is strictly opt-in per request.
+func newProgressReporter(n *requestNotifier, token json.RawMessage, interval time.Duration) *progressReporter {
+	if len(token) == 0 || string(token) == "null" {
+		return nil
+	}
+	return &progressReporter{n: n, token: token, interval: interval}
+}
+
+// report sends one notifications/progress unless it is suppressed: a progress value that
+// doesn't exceed the last one sent, or one arriving within interval of the last — except
+// that reaching total is always sent, so the client sees completion.
+func (p *progressReporter) report(progress, total float64, message string) error {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sent && progress <= p.progress {
+		return nil
+	}
+	now := time.Now()
+	done := total > 0 && progress >= total
+	if p.sent && !done && now.Sub(p.last) < p.interval {
+		return nil
+	}
+	p.sent, p.last, p.progress = true, now, progress
+	return p.n.notify("notifications/progress", ProgressNotificationParams{
+		ProgressToken: p.token,
+		Progress:      progress,
+		Total:         total,
+		Message:       message,
+	})
+}
@@ -0,0 +1,315 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/spirilis/generic-go-mcp/transport"
+)
+
+// PromptArgument describes one argument a prompt template accepts. Prompt arguments are
+// always strings on the wire.
+type PromptArgument struct {
+	Name        string `json:"name"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// Prompt describes one prompt template a client may retrieve via prompts/get.
+type Prompt struct {
+	Name        string                 `json:"name"`
+	Title       string                 `json:"title,omitempty"`
+	Description string                 `json:"description,omitempty"`
+	Arguments   []PromptArgument       `json:"arguments,omitempty"`
+	Icons       []Icon                 `json:"icons,omitempty"`
+	Meta        map[string]interface{} `json:"_meta,omitempty"`
+}
+
+// Prompt message roles.
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// PromptMessage is one message of a rendered prompt: a role and a single Content block,
+// built with the same constructors (Text, Image, EmbeddedResourceContent, ...) a tool
+// result uses.
+type PromptMessage struct {
+	Role    string  `json:"role"`
+	Content Content `json:"content"`
+}
+
+// UserMessage builds a PromptMessage with role "user".
+func UserMessage(c Content) PromptMessage {
+	return PromptMessage{Role: RoleUser, Content: c}
+}
+
+// AssistantMessage builds a PromptMessage with role "assistant".
+func AssistantMessage(c Content) PromptMessage {
+	return PromptMessage{Role: RoleAssistant, Content: c}
+}
+
+// PromptRequest carries everything a PromptFunction needs about the prompts/get in
+// progress.
+type PromptRequest struct {
+	Name               string
+	Arguments          map[string]string
+	Meta               *RequestMeta
+	ClientCapabilities *ClientCapabilities
+}
+
+// Argument returns the value supplied for the named argument, or "" if the client didn't
+// send one.
+func (r *PromptRequest) Argument(name string) string {
+	return r.Arguments[name]
+}
+
+// PromptResult is what a PromptFunction returns: the rendered messages, plus an optional
+// description overriding the one registered on the Prompt for this particular rendering.
+type PromptResult struct {
+	Description string
+	Messages    []PromptMessage
+}
+
+// PromptFunction renders a prompt for one prompts/get call. Required arguments have
+// already been checked for presence by the time it runs; validating their values is up
+// to the function. A non-nil error is a protocol-level failure (-32603).
+type PromptFunction func(ctx context.Context, req *PromptRequest) (PromptResult, error)
+
+// PromptRegistry manages available prompts, safe for concurrent registration and lookup
+// in the same way as ToolRegistry.
+type PromptRegistry struct {
+	mu          sync.RWMutex
+	prompts     []Prompt
+	functions   map[string]PromptFunction
+	completions completionProviders
+	keys        keyset // positions for prompts/list cursors
+	onChange    func()
+}
+
+// NewPromptRegistry creates a new prompt registry
+func NewPromptRegistry() *PromptRegistry {
+	return &PromptRegistry{
+		prompts:     make([]Prompt, 0),
+		functions:   make(map[string]PromptFunction),
+		completions: make(completionProviders),
+	}
+}
+
+// Register adds a prompt to the registry. Registering a name that is already present
+// replaces it and moves it to the end of the list, exactly as ToolRegistry.Register does.
+// If the registry is already attached to a running Server, this fires a
+// notifications/prompts/list_changed to any subscribed clients.
+func (r *PromptRegistry) Register(prompt Prompt, fn PromptFunction) {
+	r.mu.Lock()
+	r.removeLocked(prompt.Name)
+	r.prompts = append(r.prompts, prompt)
+	r.functions[prompt.Name] = fn
+	r.keys.add(prompt.Name)
+	notify := r.onChange
+	r.mu.Unlock()
+	if notify != nil {
+		notify()
+	}
+}
+
+// Unregister removes the prompt registered under name, reporting whether one was found.
+// Only an actual removal fires notifications/prompts/list_changed; unregistering an
+// absent name is a no-op and notifies nobody.
+func (r *PromptRegistry) Unregister(name string) bool {
+	r.mu.Lock()
+	removed := r.removeLocked(name)
+	notify := r.onChange
+	r.mu.Unlock()
+	if removed && notify != nil {
+		notify()
+	}
+	return removed
+}
+
+// removeLocked drops any entry for name, reporting whether one existed. Callers must hold
+// r.mu; see ToolRegistry.removeLocked for why it doesn't notify.
+func (r *PromptRegistry) removeLocked(name string) bool {
+	if _, ok := r.functions[name]; !ok {
+		return false
+	}
+	delete(r.functions, name)
+	r.keys.remove(name)
+	for i, p := range r.prompts {
+		if p.Name == name {
+			r.prompts = append(r.prompts[:i], r.prompts[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// List returns all registered prompts, in registration order.
+func (r *PromptRegistry) List() []Prompt {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]Prompt, len(r.prompts))
+	copy(out, r.prompts)
+	return out
+}
+
+// listing snapshots the prompts for paginating prompts/list.
+func (r *PromptRegistry) listing() listing[Prompt] {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return newListing(r.prompts, func(p Prompt) string { return p.Name }, &r.keys)
+}
+
+// Get returns the Prompt definition for name.
+func (r *PromptRegistry) Get(name string) (Prompt, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, p := range r.prompts {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Prompt{}, false
+}
+
+// HasPrompts reports whether any prompt is registered.
+func (r *PromptRegistry) HasPrompts() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.prompts) > 0
+}
+
+// RegisterCompletion attaches fn as the completion/complete provider for argument of the
+// prompt named name, replacing any provider already attached there. Providers are keyed
+// by name rather than bound to the registered Prompt, so they survive re-registering it,
+// and may be attached before the prompt itself is registered.
+func (r *PromptRegistry) RegisterCompletion(name, argument string, fn CompletionFunction) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.completions.set(name, argument, fn)
+}
+
+// UnregisterCompletion detaches the completion provider for argument of the prompt named
+// name, reporting whether one was attached.
+func (r *PromptRegistry) UnregisterCompletion(name, argument string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.completions.remove(name, argument)
+}
+
+// HasCompletions reports whether any completion provider is attached.
+func (r *PromptRegistry) HasCompletions() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.completions) > 0
+}
+
+func (r *PromptRegistry) completion(name, argument string) CompletionFunction {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.completions.get(name, argument)
+}
+
+// errPromptNotFound is returned by render when the prompt was unregistered between the
+// handler's Get and the call itself.
+var errPromptNotFound = errors.New("prompt not found")
+
+func (r *PromptRegistry) render(ctx context.Context, req *PromptRequest) (PromptResult, error) {
+	r.mu.RLock()
+	fn, ok := r.functions[req.Name]
+	r.mu.RUnlock()
+	if !ok {
+		return PromptResult{}, errPromptNotFound
+	}
+	return fn(ctx, req)
+}
+
+// PromptsListResult is the result of prompts/list.
+type PromptsListResult struct {
+	CacheableResult
+	Prompts    []Prompt `json:"prompts"`
+	NextCursor string   `json:"nextCursor,omitempty"`
+}
+
+func (s *Server) handlePromptsList(ctx context.Context, params json.RawMessage) (Result, *transport.RPCError) {
+	var p struct {
+		Cursor string `json:"cursor"`
+	}
+	if len(params) > 0 {
+		_ = json.Unmarshal(params, &p)
+	}
+
+	page, next, err := paginate(s, "prompts/list", s.promptRegistry.listing(), p.Cursor)
+	if err != nil {
+		return nil, invalidParamsErr("invalid cursor")
+	}
+
+	return &PromptsListResult{
+		CacheableResult: NewCacheableResult(s.listTTLMs, s.cacheScope()),
+		Prompts:         page,
+		NextCursor:      next,
+	}, nil
+}
+
+// PromptsGetParams is the params of a prompts/get request.
+type PromptsGetParams struct {
+	Name      string            `json:"name"`
+	Arguments map[string]string `json:"arguments,omitempty"`
+}
+
+// PromptsGetResult is the result of prompts/get. Unlike prompts/list it carries no
+// caching hints: a rendering depends on its arguments.
+type PromptsGetResult struct {
+	BaseResult
+	Description string          `json:"description,omitempty"`
+	Messages    []PromptMessage `json:"messages"`
+}
+
+func (s *Server) handlePromptsGet(ctx context.Context, meta *RequestMeta, params json.RawMessage) (Result, *transport.RPCError) {
+	var p PromptsGetParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, invalidParamsErr("invalid prompts/get params: %v", err)
+	}
+
+	prompt, ok := s.promptRegistry.Get(p.Name)
+	if !ok {
+		return nil, invalidParamsErr("Unknown prompt: %s", p.Name)
+	}
+	for _, arg := range prompt.Arguments {
+		if _, present := p.Arguments[arg.Name]; arg.Required && !present {
+			return nil, invalidParamsErr("missing required argument %q for prompt %s", arg.Name, p.Name)
+		}
+	}
+
+	req := &PromptRequest{
+		Name:               p.Name,
+		Arguments:          p.Arguments,
+		Meta:               meta,
+		ClientCapabilities: meta.ClientCapabilities,
+	}
+
+	rendered, err := s.promptRegistry.render(ctx, req)
+	if err != nil {
+		if errors.Is(err, errPromptNotFound) {
+			return nil, invalidParamsErr("Unknown prompt: %s", p.Name)
+		}
+		return nil, internalErr(err)
+	}
+
+	description := prompt.Description
+	if rendered.Description != "" {
+		description = rendered.Description
+	}
+	messages := rendered.Messages
+	if messages == nil {
+		messages = []PromptMessage{}
+	}
+
+	return &PromptsGetResult{
+		Description: description,
+		Messages:    messages,
+	}, nil
+}
@@ -3,8 +3,11 @@ package mcp
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"sync"
+	"time"
 
 	"github.com/spirilis/generic-go-mcp/transport"
 )
@@ -24,22 +27,138 @@ type Resource struct {
 
 // ResourceContentResult is what a ResourceFunction returns: exactly one of Text or Blob
 // (base64-encoded binary) should be set. MimeType, if non-empty, overrides the mime type
-// registered on the Resource for this particular read.
+// registered on the Resource for this particular read. For a read with several entries,
+// or one read from an io.Reader, build it with MultiContent or StreamContent instead.
 type ResourceContentResult struct {
 	Text     string
 	Blob     string
 	MimeType string
+
+	// Version, if set, identifies this content, like an HTTP ETag: it is sent in the
+	// result's _meta under MetaKeyResourceVersion, and a client that sends it back gets a
+	// not-modified result until it changes (see ResourceRequest.KnownVersion).
+	Version string
+
+	// inputRequired is set by ResourceRequest.NeedInput, turning this read into an
+	// InputRequiredResult instead of content.
+	inputRequired *InputRequiredResult
+
+	multi  bool              // set by MultiContent, even for no parts at all
+	parts  []ResourceContent // set by MultiContent
+	stream *ResourceStream   // set by StreamContent
+}
+
+// InputRequiredContent returns a ResourceContentResult that the server sends as r, for a
+// RegisterForwarded function relaying another server's MRTR round trip.
+func InputRequiredContent(r *InputRequiredResult) ResourceContentResult {
+	return ResourceContentResult{inputRequired: r}
+}
+
+// MultiContent returns a ResourceContentResult whose resources/read result holds every
+// part as its own contents entry, e.g. one per file of a directory-style resource. A part
+// without a URI gets the URI that was read, and one without a MimeType the registered mime
+// type. Size is always set from the content, replacing any value a part declares.
+func MultiContent(parts ...ResourceContent) ResourceContentResult {
+	return ResourceContentResult{multi: true, parts: parts}
+}
+
+// StreamContent returns a ResourceContentResult whose content the server reads from
+// stream.Reader when it answers the read, base64-encoding it as it goes unless stream.Text
+// is set. The response is not streamed: the encoded content is built whole in memory
+// before it is sent; set ServerConfig.MaxResourceSize to bound a large one.
+func StreamContent(stream *ResourceStream) ResourceContentResult {
+	return ResourceContentResult{stream: stream}
 }
 
+// ResourceStream is content to be read from Reader as a resources/read is answered.
+// Reading stops with an error once it passes ServerConfig.MaxResourceSize. If Reader is an
+// io.Closer it is closed afterwards, whether or not the read succeeded; if it has a
+// Stat method (an *os.File, or any fs.File), the file's modification time stands in for
+// an unset LastModified, and a regular file already over the limit is refused unread.
+type ResourceStream struct {
+	Reader       io.Reader
+	MimeType     string    // overrides the registered mime type, like ResourceContentResult.MimeType
+	Text         bool      // send the content as text rather than a base64 blob
+	LastModified time.Time // reported as annotations.lastModified, if not zero
+}
+
+// ResourceContentsFunction produces a resource's content as several contents entries; see
+// MultiContent. Register one with ResourceRegistry.RegisterContents.
+type ResourceContentsFunction func(ctx context.Context, req *ResourceRequest) ([]ResourceContent, error)
+
+// ResourceStreamFunction produces a resource's content as a stream; see StreamContent.
+// Register one with ResourceRegistry.RegisterStream.
+type ResourceStreamFunction func(ctx context.Context, req *ResourceRequest) (*ResourceStream, error)
+
 // ResourceFunction produces the content of a resource when read.
 type ResourceFunction func(ctx context.Context) (ResourceContentResult, error)
 
+// ResourceReadFunction produces the content of a resource when read, with access to the
+// resources/read in progress: its meta, the caller's client capabilities, and the MRTR
+// round trip (NeedInput/ElicitResponse). Register one with ResourceRegistry.RegisterReader.
+type ResourceReadFunction func(ctx context.Context, req *ResourceRequest) (ResourceContentResult, error)
+
+// ResourceRequest carries everything a ResourceReadFunction or ResourceTemplateFunction
+// needs about the resources/read in progress.
+type ResourceRequest struct {
+	URI                string
+	Variables          map[string]string
+	KnownVersion       string // the Version of the content the client already has, if any
+	Meta               *RequestMeta
+	ClientCapabilities *ClientCapabilities
+	InputResponses     InputResponses
+	RequestState       string
+
+	ctx    context.Context
+	server *Server
+}
+
+// Variable returns the value the requested URI supplied for the named template variable,
+// or "" if the expansion left it undefined.
+func (r *ResourceRequest) Variable(name string) string {
+	return r.Variables[name]
+}
+
+// ElicitResponse returns the client's answer to a previously requested elicitation named
+// key (as set via NeedInput on an earlier attempt at this same read), if present.
+func (r *ResourceRequest) ElicitResponse(key string) (*ElicitResult, bool) {
+	raw, ok := r.InputResponses[key]
+	if !ok {
+		return nil, false
+	}
+	var res ElicitResult
+	if err := json.Unmarshal(raw, &res); err != nil {
+		return nil, false
+	}
+	return &res, true
+}
+
+// NeedInput returns a ResourceContentResult that the server sends as an
+// InputRequiredResult asking the client to fulfill reqs, exactly as ToolRequest.NeedInput
+// does for tools/call. The signed requestState is bound to this URI, so the client's retry
+// must read the same resource. Returns a *MissingCapabilityError if reqs includes a method
+// the caller's declared ClientCapabilities does not cover.
+func (r *ResourceRequest) NeedInput(reqs InputRequests) (ResourceContentResult, error) {
+	if r.server == nil {
+		return ResourceContentResult{}, errors.New("NeedInput is only available within a resources/read request")
+	}
+	if missing := missingCapabilitiesFor(reqs, r.ClientCapabilities); len(missing) > 0 {
+		return ResourceContentResult{}, &MissingCapabilityError{Capabilities: missing}
+	}
+	principal := r.server.config.PrincipalFromContext(r.ctx)
+	state := r.server.signRequestState(principal, "resources/read", r.URI, nil)
+	return ResourceContentResult{inputRequired: newInputRequiredResult(reqs, state)}, nil
+}
+
 // ResourceRegistry manages available resources, safe for concurrent registration, lookup,
 // and reads.
 type ResourceRegistry struct {
 	mu        sync.RWMutex
 	resources []Resource
-	functions map[string]ResourceFunction // keyed by URI
+	functions map[string]ResourceReadFunction // keyed by URI
+	forwarded map[string]bool                 // URIs registered with RegisterForwarded
+	caches    map[string]*contentCache        // URIs registered with RegisterCached
+	keys      keyset                          // positions for resources/list cursors
 	onChange  func()
 	onUpdate  func(string)
 }
@@ -48,7 +167,9 @@ type ResourceRegistry struct {
 func NewResourceRegistry() *ResourceRegistry {
 	return &ResourceRegistry{
 		resources: []Resource{},
-		functions: make(map[string]ResourceFunction),
+		functions: make(map[string]ResourceReadFunction),
+		forwarded: make(map[string]bool),
+		caches:    make(map[string]*contentCache),
 	}
 }
 
@@ -64,10 +185,75 @@ func NewResourceRegistry() *ResourceRegistry {
 // a metadata edit from a content swap. Announcing the update is the safe side of that
 // ambiguity. A brand-new URI is a catalog addition, which list_changed already covers.
 func (r *ResourceRegistry) Register(res Resource, fn ResourceFunction) {
+	r.RegisterReader(res, func(ctx context.Context, _ *ResourceRequest) (ResourceContentResult, error) {
+		return fn(ctx)
+	})
+}
+
+// RegisterReader is Register for a ResourceReadFunction, for resources that need to see the
+// request they are serving — most notably to ask the client for input via NeedInput before
+// producing content. Replacement and notification behave exactly as for Register.
+func (r *ResourceRegistry) RegisterReader(res Resource, fn ResourceReadFunction) {
+	r.register(res, fn, false, nil)
+}
+
+// RegisterContents is RegisterReader for a resource whose read returns several contents
+// entries (see MultiContent).
+func (r *ResourceRegistry) RegisterContents(res Resource, fn ResourceContentsFunction) {
+	r.RegisterReader(res, func(ctx context.Context, req *ResourceRequest) (ResourceContentResult, error) {
+		parts, err := fn(ctx, req)
+		if err != nil {
+			return ResourceContentResult{}, err
+		}
+		return MultiContent(parts...), nil
+	})
+}
+
+// RegisterStream is RegisterReader for a resource whose content is streamed from an
+// io.Reader (see StreamContent).
+func (r *ResourceRegistry) RegisterStream(res Resource, fn ResourceStreamFunction) {
+	r.RegisterReader(res, func(ctx context.Context, req *ResourceRequest) (ResourceContentResult, error) {
+		stream, err := fn(ctx, req)
+		if err != nil {
+			return ResourceContentResult{}, err
+		}
+		return StreamContent(stream), nil
+	})
+}
+
+// RegisterCached is RegisterReader for a resource whose content is kept in memory after
+// the first successful read and served from there until NotifyUpdated is called for its
+// URI (or it is registered again or unregistered). A cached content without a Version is
+// given one derived from the content itself, so conditional reads work unaided. Only use
+// it for content that is the same for every caller; a read that returns NeedInput or a
+// StreamContent is passed through uncached.
+func (r *ResourceRegistry) RegisterCached(res Resource, fn ResourceReadFunction) {
+	cache := &contentCache{}
+	r.register(res, func(ctx context.Context, req *ResourceRequest) (ResourceContentResult, error) {
+		return cache.read(ctx, req, fn)
+	}, false, cache)
+}
+
+// RegisterForwarded is RegisterReader for a resource served by another MCP server, which
+// fn forwards each read to. As with ToolRegistry.RegisterForwarded, the MRTR round trip is
+// the upstream's: requestState reaches fn unverified, and fn returns the upstream's
+// input_required with InputRequiredContent.
+func (r *ResourceRegistry) RegisterForwarded(res Resource, fn ResourceReadFunction) {
+	r.register(res, fn, true, nil)
+}
+
+func (r *ResourceRegistry) register(res Resource, fn ResourceReadFunction, forwarded bool, cache *contentCache) {
 	r.mu.Lock()
 	replaced := r.removeLocked(res.URI)
 	r.resources = append(r.resources, res)
 	r.functions[res.URI] = fn
+	r.keys.add(res.URI)
+	if forwarded {
+		r.forwarded[res.URI] = true
+	}
+	if cache != nil {
+		r.caches[res.URI] = cache
+	}
 	notify, update := r.onChange, r.onUpdate
 	r.mu.Unlock()
 	if notify != nil {
@@ -82,10 +268,6 @@ func (r *ResourceRegistry) Register(res Resource, fn ResourceFunction) {
 // If the registry is attached to a running Server and something was actually removed, this
 // fires a notifications/resources/list_changed to any subscribed clients; unregistering an
 // absent URI is a no-op and notifies nobody.
-//
-// Note for paginating clients: resources/list cursors are opaque offsets, so a removal
-// between two page fetches shifts later entries and can cause one to be skipped. That is
-// what list_changed is for — a client that sees it should restart pagination.
 func (r *ResourceRegistry) Unregister(uri string) bool {
 	r.mu.Lock()
 	removed := r.removeLocked(uri)
@@ -104,10 +286,14 @@ func (r *ResourceRegistry) Unregister(uri string) bool {
 //
 // Unlike list_changed, the library cannot detect this on its own: a ResourceFunction is
 // called on demand and its output is opaque to the registry, so only the consumer knows when
-// the underlying thing changed. This is that explicit signal.
+// the underlying thing changed. This is that explicit signal. It also drops the content a
+// RegisterCached resource is holding, so the next read calls its function again.
 func (r *ResourceRegistry) NotifyUpdated(uri string) bool {
 	r.mu.Lock()
 	_, known := r.functions[uri]
+	if cache := r.caches[uri]; cache != nil {
+		cache.invalidate()
+	}
 	update := r.onUpdate
 	r.mu.Unlock()
 	if known && update != nil {
@@ -124,6 +310,9 @@ func (r *ResourceRegistry) removeLocked(uri string) bool {
 		return false
 	}
 	delete(r.functions, uri)
+	delete(r.forwarded, uri)
+	delete(r.caches, uri)
+	r.keys.remove(uri)
 	for i, res := range r.resources {
 		if res.URI == uri {
 			r.resources = append(r.resources[:i], r.resources[i+1:]...)
@@ -142,6 +331,13 @@ func (r *ResourceRegistry) List() []Resource {
 	return result
 }
 
+// listing snapshots the resources for paginating resources/list.
+func (r *ResourceRegistry) listing() listing[Resource] {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return newListing(r.resources, func(res Resource) string { return res.URI }, &r.keys)
+}
+
 // Get returns the Resource metadata for the given URI
 func (r *ResourceRegistry) Get(uri string) (Resource, bool) {
 	r.mu.RLock()
@@ -154,16 +350,29 @@ func (r *ResourceRegistry) Get(uri string) (Resource, bool) {
 	return Resource{}, false
 }
 
-// Read executes the function for the given resource URI and returns its content.
+// Read executes the function for the given resource URI and returns its content. It runs
+// outside of any resources/read, so a ResourceReadFunction that calls NeedInput gets an
+// error back.
 func (r *ResourceRegistry) Read(ctx context.Context, uri string) (ResourceContentResult, error) {
+	return r.read(ctx, &ResourceRequest{URI: uri})
+}
+
+func (r *ResourceRegistry) read(ctx context.Context, req *ResourceRequest) (ResourceContentResult, error) {
 	r.mu.RLock()
-	fn, exists := r.functions[uri]
+	fn, exists := r.functions[req.URI]
 	r.mu.RUnlock()
 
 	if !exists {
-		return ResourceContentResult{}, fmt.Errorf("resource not found: %s", uri)
+		return ResourceContentResult{}, fmt.Errorf("resource not found: %s", req.URI)
 	}
-	return fn(ctx)
+	return fn(ctx, req)
+}
+
+// isForwarded reports whether uri was registered with RegisterForwarded.
+func (r *ResourceRegistry) isForwarded(uri string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.forwarded[uri]
 }
 
 // HasResources returns true if the registry has any resources
@@ -181,6 +390,7 @@ type ResourceContent struct {
 	MimeType    string                 `json:"mimeType,omitempty"`
 	Text        string                 `json:"text,omitempty"`
 	Blob        string                 `json:"blob,omitempty"`
+	Size        *int64                 `json:"size,omitempty"` // bytes of Text, or of Blob once decoded
 	Annotations *Annotations           `json:"annotations,omitempty"`
 	Meta        map[string]interface{} `json:"_meta,omitempty"`
 }
@@ -200,8 +410,7 @@ func (s *Server) handleResourcesList(ctx context.Context, params json.RawMessage
 		_ = json.Unmarshal(params, &p)
 	}
 
-	all := s.resourceRegistry.List()
-	page, next, err := paginate(all, p.Cursor, defaultPageSize)
+	page, next, err := paginate(s, "resources/list", s.resourceListing(ctx), p.Cursor)
 	if err != nil {
 		return nil, invalidParamsErr("invalid cursor")
 	}
@@ -219,43 +428,150 @@ type ResourcesReadResult struct {
 	Contents []ResourceContent `json:"contents"`
 }
 
-func (s *Server) handleResourcesRead(ctx context.Context, params json.RawMessage) (Result, *transport.RPCError) {
-	var p struct {
-		URI string `json:"uri"`
-	}
+// ResourcesReadParams is the params of a resources/read request, including the optional
+// MRTR retry fields (inputResponses, requestState).
+type ResourcesReadParams struct {
+	URI            string         `json:"uri"`
+	InputResponses InputResponses `json:"inputResponses,omitempty"`
+	RequestState   string         `json:"requestState,omitempty"`
+}
+
+func (s *Server) handleResourcesRead(ctx context.Context, meta *RequestMeta, params json.RawMessage) (Result, *transport.RPCError) {
+	var p ResourcesReadParams
 	if err := json.Unmarshal(params, &p); err != nil {
 		return nil, invalidParamsErr("invalid resources/read params: %v", err)
 	}
 
+	if p.RequestState != "" && !s.resourceRegistry.isForwarded(p.URI) {
+		principal := s.config.PrincipalFromContext(ctx)
+		if err := s.verifyRequestState(p.RequestState, principal, "resources/read", p.URI, nil); err != nil {
+			return nil, invalidParamsErr("invalid requestState: %v", err)
+		}
+	}
+
+	req := &ResourceRequest{
+		URI:                p.URI,
+		KnownVersion:       knownVersion(ctx, params),
+		Meta:               meta,
+		ClientCapabilities: meta.ClientCapabilities,
+		InputResponses:     p.InputResponses,
+		RequestState:       p.RequestState,
+		ctx:                ctx,
+		server:             s,
+	}
+
 	res, ok := s.resourceRegistry.Get(p.URI)
 	if !ok {
+		// Not a static resource: fall back to the first template the URI expands.
+		return s.readTemplatedResource(ctx, req)
+	}
+	if !s.resourceVisible(ctx, res) {
+		// Answered as if it didn't exist, without falling back to a template.
 		return nil, invalidParamsErr("Unknown resource: %s", p.URI)
 	}
 
-	content, err := s.resourceRegistry.Read(ctx, p.URI)
+	content, err := s.resourceRegistry.read(ctx, req)
 	if err != nil {
-		return nil, internalErr(err)
+		return nil, resourceReadErr(err)
 	}
 
-	mimeType := res.MimeType
+	return s.resourcesReadResult(ResourceContent{URI: p.URI, Name: res.Name, Title: res.Title, MimeType: res.MimeType}, content, req.KnownVersion)
+}
+
+func (s *Server) readTemplatedResource(ctx context.Context, req *ResourceRequest) (Result, *transport.RPCError) {
+	tmpl, content, err := s.templateRegistry.read(ctx, req)
+	if err != nil {
+		if errors.Is(err, errTemplateNotFound) {
+			return nil, invalidParamsErr("Unknown resource: %s", req.URI)
+		}
+		return nil, resourceReadErr(err)
+	}
+
+	return s.resourcesReadResult(ResourceContent{URI: req.URI, Name: tmpl.Name, Title: tmpl.Title, MimeType: tmpl.MimeType}, content, req.KnownVersion)
+}
+
+// resourceReadErr maps an error from a resource function to its JSON-RPC error: a
+// NeedInput the client can't satisfy is -32021, a *transport.RPCError is sent as-is, and
+// anything else is -32603.
+func resourceReadErr(err error) *transport.RPCError {
+	var mc *MissingCapabilityError
+	if errors.As(err, &mc) {
+		return missingClientCapabilityErr(mc.Capabilities...)
+	}
+	var rpcErr *transport.RPCError
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+	return internalErr(err)
+}
+
+// resourcesReadResult builds the resources/read result shared by static and templated
+// resources: entry carries the registered metadata, and content the read itself, whose
+// MimeType (if set) overrides the registered one. A content that came from NeedInput
+// becomes its InputRequiredResult instead; one from MultiContent becomes an entry per part,
+// and one from StreamContent is read here. Every entry's Size is set, and the total
+// is held to ServerConfig.MaxResourceSize. A content whose Version is the one the client
+// said it already has (known) becomes a not-modified result instead, unread.
+func (s *Server) resourcesReadResult(entry ResourceContent, content ResourceContentResult, known string) (Result, *transport.RPCError) {
+	if content.inputRequired != nil {
+		return content.inputRequired, nil
+	}
+	if content.Version != "" && content.Version == known {
+		if c, ok := content.stream.readerCloser(); ok {
+			c.Close()
+		}
+		return s.notModifiedResult(content.Version), nil
+	}
 	if content.MimeType != "" {
-		mimeType = content.MimeType
+		entry.MimeType = content.MimeType
+	}
+	if entry.MimeType == "" {
+		entry.MimeType = "text/plain"
 	}
-	if mimeType == "" {
-		mimeType = "text/plain"
+
+	var contents []ResourceContent
+	switch {
+	case content.stream != nil:
+		c, err := s.readResourceStream(entry, content.stream)
+		if err != nil {
+			return nil, err
+		}
+		contents = []ResourceContent{c}
+	case content.multi:
+		contents = make([]ResourceContent, len(content.parts))
+		for i, part := range content.parts {
+			if part.URI == "" {
+				part.URI = entry.URI
+			}
+			if part.MimeType == "" {
+				part.MimeType = entry.MimeType
+			}
+			contents[i] = part
+		}
+	default:
+		entry.Text = content.Text
+		entry.Blob = content.Blob
+		contents = []ResourceContent{entry}
 	}
 
-	return &ResourcesReadResult{
+	// Size is always taken from the content itself, never from what a part declared, so
+	// that the limit counts what is actually sent.
+	var total int64
+	for i := range contents {
+		n := contentSize(contents[i])
+		contents[i].Size = &n
+		total += n
+	}
+	if limit := s.config.MaxResourceSize; limit > 0 && total > limit {
+		return nil, resourceTooLargeErr(entry.URI, limit)
+	}
+
+	result := &ResourcesReadResult{
 		CacheableResult: NewCacheableResult(s.readTTLMs, s.cacheScope()),
-		Contents: []ResourceContent{
-			{
-				URI:      p.URI,
-				Name:     res.Name,
-				Title:    res.Title,
-				MimeType: mimeType,
-				Text:     content.Text,
-				Blob:     content.Blob,
-			},
-		},
-	}, nil
+		Contents:        contents,
+	}
+	if content.Version != "" {
+		result.Meta = map[string]interface{}{MetaKeyResourceVersion: content.Version}
+	}
+	return result, nil
 }
@@ -0,0 +1,89 @@
+package mcp
+
+import (
+	"encoding/base64"
+	"io"
+	"io/fs"
+	"strings"
+	"time"
+
+	"github.com/spirilis/generic-go-mcp/transport"
+)
+
+// readResourceStream reads st into entry, as text or base64 blob, recording its Size and
+// lastModified annotation.
+func (s *Server) readResourceStream(entry ResourceContent, st *ResourceStream) (ResourceContent, *transport.RPCError) {
+	if c, ok := st.readerCloser(); ok {
+		defer c.Close()
+	}
+	if st.MimeType != "" {
+		entry.MimeType = st.MimeType
+	}
+	limit := s.config.MaxResourceSize
+
+	modTime := st.LastModified
+	if f, ok := st.Reader.(interface{ Stat() (fs.FileInfo, error) }); ok {
+		if fi, err := f.Stat(); err == nil {
+			if limit > 0 && fi.Mode().IsRegular() && fi.Size() > limit {
+				return entry, resourceTooLargeErr(entry.URI, limit)
+			}
+			if modTime.IsZero() {
+				modTime = fi.ModTime()
+			}
+		}
+	}
+
+	r := st.Reader
+	if limit > 0 {
+		// One byte past the limit is enough to tell that it was passed.
+		r = io.LimitReader(r, limit+1)
+	}
+	var b strings.Builder
+	var n int64
+	var err error
+	if st.Text {
+		n, err = io.Copy(&b, r)
+		entry.Text = b.String()
+	} else {
+		enc := base64.NewEncoder(base64.StdEncoding, &b)
+		if n, err = io.Copy(enc, r); err == nil {
+			err = enc.Close()
+		}
+		entry.Blob = b.String()
+	}
+	if err != nil {
+		return entry, internalErr(err)
+	}
+	if limit > 0 && n > limit {
+		return entry, resourceTooLargeErr(entry.URI, limit)
+	}
+
+	entry.Size = &n
+	if !modTime.IsZero() {
+		var ann Annotations
+		if entry.Annotations != nil {
+			ann = *entry.Annotations
+		}
+		ann.LastModified = modTime.UTC().Format(time.RFC3339)
+		entry.Annotations = &ann
+	}
+	return entry, nil
+}
+
+// readerCloser returns st's Reader as an io.Closer, if it is one.
+func (st *ResourceStream) readerCloser() (io.Closer, bool) {
+	if st == nil {
+		return nil, false
+	}
+	c, ok := st.Reader.(io.Closer)
+	return c, ok
+}
+
+// contentSize is the size in bytes of c's content: its text, or its blob once decoded.
+func contentSize(c ResourceContent) int64 {
+	if c.Blob == "" {
+		return int64(len(c.Text))
+	}
+	// Every base64 character carries 6 bits; padding carries none.
+	return int64(len(strings.TrimRight(c.Blob, "=")) * 6 / 8)
+}
@@ -0,0 +1,105 @@
+package mcp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/spirilis/generic-go-mcp/transport"
+)
+
+// _meta keys of conditional resources/read. The spec defines none, so these live under
+// this library's own prefix.
+const (
+	// MetaKeyResourceVersion carries, on a resources/read result, the Version of the
+	// content read, and on a resources/read request, the Version the client already has.
+	MetaKeyResourceVersion = transport.MetaKeyResourceVersion
+
+	// MetaKeyNotModified is true on a resources/read result that carries no contents
+	// because the content is still at the Version the request named.
+	MetaKeyNotModified = "io.github.spirilis/notModified"
+)
+
+// knownVersion is the Version a resources/read says its client already has: params'
+// _meta[MetaKeyResourceVersion] or, failing that, an If-None-Match header on Streamable
+// HTTP. Only the first entity tag of the header counts, and a weak one is compared as if
+// it were strong, since Versions are only ever compared for equality.
+func knownVersion(ctx context.Context, params json.RawMessage) string {
+	var env paramsMetaEnvelope
+	_ = json.Unmarshal(params, &env)
+	if v, ok := stringFromRaw(env.Meta[MetaKeyResourceVersion]); ok {
+		return v
+	}
+	h, _ := transport.HeadersFromContext(ctx)
+	tag, ok := h.Get(transport.IfNoneMatchHeader)
+	if !ok {
+		return ""
+	}
+	tag, _, _ = strings.Cut(tag, ",")
+	tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+	return strings.Trim(tag, `"`)
+}
+
+// notModifiedResult is the resources/read result for content still at version: no
+// contents, just the version and the not-modified flag.
+func (s *Server) notModifiedResult(version string) *ResourcesReadResult {
+	result := &ResourcesReadResult{
+		CacheableResult: NewCacheableResult(s.readTTLMs, s.cacheScope()),
+		Contents:        []ResourceContent{},
+	}
+	result.Meta = map[string]interface{}{MetaKeyResourceVersion: version, MetaKeyNotModified: true}
+	return result
+}
+
+// contentCache holds a RegisterCached resource's content between reads.
+type contentCache struct {
+	mu      sync.Mutex
+	gen     uint64 // bumped by invalidate, so a read racing it doesn't store stale content
+	content *ResourceContentResult
+}
+
+func (c *contentCache) invalidate() {
+	c.mu.Lock()
+	c.gen++
+	c.content = nil
+	c.mu.Unlock()
+}
+
+func (c *contentCache) read(ctx context.Context, req *ResourceRequest, fn ResourceReadFunction) (ResourceContentResult, error) {
+	c.mu.Lock()
+	if c.content != nil {
+		content := *c.content
+		c.mu.Unlock()
+		return content, nil
+	}
+	gen := c.gen
+	c.mu.Unlock()
+
+	content, err := fn(ctx, req)
+	if err != nil || content.inputRequired != nil || content.stream != nil {
+		return content, err
+	}
+	if content.Version == "" {
+		content.Version = contentVersion(content)
+	}
+	c.mu.Lock()
+	if c.gen == gen {
+		c.content = &content
+	}
+	c.mu.Unlock()
+	return content, nil
+}
+
+// contentVersion derives a Version from content itself.
+func contentVersion(content ResourceContentResult) string {
+	h := sha256.New()
+	if content.multi {
+		_ = json.NewEncoder(h).Encode(content.parts)
+	} else {
+		_ = json.NewEncoder(h).Encode([]string{content.MimeType, content.Text, content.Blob})
+	}
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:16])
+}
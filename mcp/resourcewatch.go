@@ -0,0 +1,101 @@
+package mcp
+
+import (
+	"context"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// resourceWatch reports whether one resourceSubscriptions entry covers a resource URI,
+// i.e. whether a change to that URI is announced to the subscriber.
+type resourceWatch func(uri string) bool
+
+// resourceWatches compiles the resourceSubscriptions of a subscriptions/listen into one
+// resourceWatch per entry. An entry that is the URITemplate of a registered resource
+// template covers every URI the template expands to; any other entry covers itself and,
+// as the spec allows, every sub-resource beneath it (see uriCovers). Templates are looked
+// up once, here: one registered later does not widen a listen that is already open.
+//
+// While ResourceVisible is set, a watch never covers a registered resource the caller
+// behind ctx may not see, however broad the entry that would otherwise cover it.
+func (s *Server) resourceWatches(ctx context.Context, entries []string) []resourceWatch {
+	watches := make([]resourceWatch, 0, len(entries))
+	for _, entry := range entries {
+		var w resourceWatch
+		if tmpl, ok := s.templateRegistry.parsed(entry); ok {
+			w = func(uri string) bool {
+				_, ok := tmpl.Match(uri)
+				return ok
+			}
+		} else {
+			w = func(uri string) bool { return uriCovers(entry, uri) }
+		}
+		if s.config.ResourceVisible != nil {
+			covers := w
+			w = func(uri string) bool {
+				if !covers(uri) {
+					return false
+				}
+				res, ok := s.resourceRegistry.Get(uri)
+				return !ok || s.resourceVisible(ctx, res)
+			}
+		}
+		watches = append(watches, w)
+	}
+	return watches
+}
+
+// uriCovers reports whether a subscription to parent covers uri: either they are the same
+// URI, or uri lies beneath parent in the same hierarchy. Both are compared normalized —
+// scheme and host case-folded, "." and ".." resolved, empty segments and a trailing "/"
+// ignored — and then segment by segment, so "file:///proj" covers "file:///proj/a.txt"
+// but not "file:///project". A parent carrying a query or fragment, or one that is not
+// hierarchical (e.g. "urn:isbn:123"), covers only itself.
+func uriCovers(parent, uri string) bool {
+	if parent == uri {
+		return true
+	}
+	p, ok := normalizeURI(parent)
+	if !ok || p.leaf {
+		return false
+	}
+	u, ok := normalizeURI(uri)
+	if !ok || u.scheme != p.scheme || u.host != p.host || len(u.segments) < len(p.segments) {
+		return false
+	}
+	for i, seg := range p.segments {
+		if u.segments[i] != seg {
+			return false
+		}
+	}
+	return true
+}
+
+type normalizedURI struct {
+	scheme, host string
+	segments     []string
+	leaf         bool // has a query or fragment, or no hierarchy: nothing lies beneath it
+}
+
+func normalizeURI(raw string) (normalizedURI, bool) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" {
+		return normalizedURI{}, false
+	}
+	n := normalizedURI{
+		scheme: strings.ToLower(u.Scheme),
+		host:   strings.ToLower(u.Host),
+		leaf:   u.Opaque != "" || u.RawQuery != "" || u.Fragment != "",
+	}
+	if u.Opaque != "" {
+		n.segments = []string{u.Opaque}
+		return n, true
+	}
+	for _, seg := range strings.Split(path.Clean("/"+u.Path), "/") {
+		if seg != "" {
+			n.segments = append(n.segments, seg)
+		}
+	}
+	return n, true
+}
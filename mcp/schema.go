@@ -0,0 +1,389 @@
+package mcp
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GenerateSchema derives a JSON Schema (2020-12) for T from its Go type and struct tags,
+// for use as a Tool's InputSchema or OutputSchema. RegisterTyped calls it for you; it is
+// exported for hand-registered tools that want the same schema without the typed wrapper.
+//
+// Struct fields are named and skipped exactly as encoding/json would (the json tag, "-",
+// unexported fields, promoted fields of embedded structs), and a field is required unless
+// its json tag says omitempty. Two further tags refine a property:
+//
+//	description:"Free text, commas and all"
+//	jsonschema:"required,enum=a|b|c,minimum=0,maximum=10,x-mcp-header=Region"
+//
+// The jsonschema tag is a comma-separated list of: required or optional (overriding the
+// omitempty default), enum=v1|v2|..., minimum=, maximum=, minLength=, maxLength=,
+// minItems=, maxItems=, format=, and x-mcp-header=.
+//
+// time.Time becomes a date-time string, []byte a base64 string, and json.RawMessage or
+// interface{} an unconstrained schema. A pointer, slice or map may also be null, as
+// encoding/json writes a nil one. A struct type that contains itself is emitted once
+// under $defs and referenced by $ref. Channels, funcs, complex numbers, and maps keyed by
+// anything but strings or integers are rejected.
+func GenerateSchema[T any]() (json.RawMessage, error) {
+	return generateSchema(reflect.TypeOf((*T)(nil)).Elem())
+}
+
+// jsonSchema is the subset of JSON Schema the generator emits. Field order here is the
+// order keywords appear in the marshalled schema.
+type jsonSchema struct {
+	Ref                  string                 `json:"$ref,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	ContentEncoding      string                 `json:"contentEncoding,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Enum                 []interface{}          `json:"enum,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	Maximum              *float64               `json:"maximum,omitempty"`
+	MinLength            *int                   `json:"minLength,omitempty"`
+	MaxLength            *int                   `json:"maxLength,omitempty"`
+	MinItems             *int                   `json:"minItems,omitempty"`
+	MaxItems             *int                   `json:"maxItems,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *jsonSchema            `json:"additionalProperties,omitempty"`
+	XMCPHeader           string                 `json:"x-mcp-header,omitempty"`
+	AnyOf                []*jsonSchema          `json:"anyOf,omitempty"`
+	Defs                 map[string]*jsonSchema `json:"$defs,omitempty"`
+
+	nullable bool // Type is emitted as [Type, "null"]
+}
+
+func (s *jsonSchema) MarshalJSON() ([]byte, error) {
+	type plain jsonSchema
+	if !s.nullable {
+		return json.Marshal((*plain)(s))
+	}
+	return json.Marshal(struct {
+		Type []string `json:"type"`
+		*plain
+	}{[]string{s.Type, "null"}, (*plain)(s)})
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	rawMessageType    = reflect.TypeOf(json.RawMessage(nil))
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// schemaGenerator carries the state of one GenerateSchema call: which struct types are
+// being expanded right now (to detect recursion) and the $defs collected along the way.
+type schemaGenerator struct {
+	root       reflect.Type
+	expanding  map[reflect.Type]bool
+	recursive  map[reflect.Type]bool
+	defs       map[string]*jsonSchema
+	defNames   map[reflect.Type]string
+	usedDefIDs map[string]bool
+}
+
+func generateSchema(t reflect.Type) (json.RawMessage, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	g := &schemaGenerator{
+		root:       t,
+		expanding:  map[reflect.Type]bool{},
+		recursive:  map[reflect.Type]bool{},
+		defs:       map[string]*jsonSchema{},
+		defNames:   map[reflect.Type]string{},
+		usedDefIDs: map[string]bool{},
+	}
+	s, err := g.typeSchema(t)
+	if err != nil {
+		return nil, err
+	}
+	if len(g.defs) > 0 {
+		s.Defs = g.defs
+	}
+	return json.Marshal(s)
+}
+
+// schemaFor is the schema of a value of type t: typeSchema's, also admitting null if t is
+// a pointer, slice or map, which encoding/json writes as null when nil.
+func (g *schemaGenerator) schemaFor(t reflect.Type) (*jsonSchema, error) {
+	s, err := g.typeSchema(t)
+	if err != nil {
+		return nil, err
+	}
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Map:
+		switch {
+		case s.Type != "":
+			s.nullable = true
+		case s.Ref != "":
+			s = &jsonSchema{AnyOf: []*jsonSchema{s, {Type: "null"}}}
+		}
+	}
+	return s, nil
+}
+
+// typeSchema is the schema of t's non-null values.
+func (g *schemaGenerator) typeSchema(t reflect.Type) (*jsonSchema, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t {
+	case timeType:
+		return &jsonSchema{Type: "string", Format: "date-time"}, nil
+	case rawMessageType:
+		return &jsonSchema{}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &jsonSchema{Type: "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &jsonSchema{Type: "integer"}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		zero := 0.0
+		return &jsonSchema{Type: "integer", Minimum: &zero}, nil
+	case reflect.Float32, reflect.Float64:
+		return &jsonSchema{Type: "number"}, nil
+	case reflect.String:
+		return &jsonSchema{Type: "string"}, nil
+	case reflect.Interface:
+		return &jsonSchema{}, nil
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return &jsonSchema{Type: "string", ContentEncoding: "base64"}, nil
+		}
+		items, err := g.schemaFor(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		s := &jsonSchema{Type: "array", Items: items}
+		if t.Kind() == reflect.Array {
+			n := t.Len()
+			s.MinItems, s.MaxItems = &n, &n
+		}
+		return s, nil
+	case reflect.Map:
+		switch t.Key().Kind() {
+		case reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		default:
+			if !t.Key().Implements(textMarshalerType) {
+				return nil, fmt.Errorf("schema for %s: map key type %s cannot be a JSON object key", t, t.Key())
+			}
+		}
+		values, err := g.schemaFor(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &jsonSchema{Type: "object", AdditionalProperties: values}, nil
+	case reflect.Struct:
+		return g.structSchema(t)
+	default:
+		return nil, fmt.Errorf("schema for %s: kind %s has no JSON representation", t, t.Kind())
+	}
+}
+
+// structSchema expands a struct type into an object schema. A type reached again while it
+// is still being expanded is recursive: the inner occurrence becomes a $ref, and once the
+// outer expansion finishes the schema moves into $defs (or, for the root type, stays
+// inline with the $ref pointing at "#").
+func (g *schemaGenerator) structSchema(t reflect.Type) (*jsonSchema, error) {
+	if g.expanding[t] {
+		g.recursive[t] = true
+		return &jsonSchema{Ref: g.refFor(t)}, nil
+	}
+	if name, ok := g.defNames[t]; ok && g.defs[name] != nil {
+		return &jsonSchema{Ref: g.refFor(t)}, nil
+	}
+	g.expanding[t] = true
+	defer delete(g.expanding, t)
+
+	s := &jsonSchema{Type: "object", Properties: map[string]*jsonSchema{}}
+	if err := g.addFields(t, s); err != nil {
+		return nil, err
+	}
+	if len(s.Properties) == 0 {
+		s.Properties = nil
+	}
+
+	if g.recursive[t] && t != g.root {
+		g.defs[g.defNames[t]] = s
+		return &jsonSchema{Ref: g.refFor(t)}, nil
+	}
+	return s, nil
+}
+
+func (g *schemaGenerator) refFor(t reflect.Type) string {
+	if t == g.root {
+		return "#"
+	}
+	name, ok := g.defNames[t]
+	if !ok {
+		base := t.Name()
+		if base == "" {
+			base = "anonymous"
+		}
+		name = base
+		for i := 2; g.usedDefIDs[name]; i++ {
+			name = base + strconv.Itoa(i)
+		}
+		g.usedDefIDs[name] = true
+		g.defNames[t] = name
+	}
+	return "#/$defs/" + name
+}
+
+// addFields adds t's fields to s, promoting the fields of untagged embedded structs the
+// way encoding/json does: breadth-first, so a field already named at a shallower depth
+// wins over one of the same name further down.
+func (g *schemaGenerator) addFields(t reflect.Type, s *jsonSchema) error {
+	seen := map[string]bool{}
+	visited := map[reflect.Type]bool{t: true}
+	for level := []reflect.Type{t}; len(level) > 0; {
+		var next []reflect.Type
+		for _, lt := range level {
+			for i := 0; i < lt.NumField(); i++ {
+				f := lt.Field(i)
+				tag := f.Tag.Get("json")
+				if tag == "-" {
+					continue
+				}
+				name, opts, _ := strings.Cut(tag, ",")
+
+				if f.Anonymous && name == "" {
+					ft := f.Type
+					if ft.Kind() == reflect.Pointer {
+						ft = ft.Elem()
+					}
+					if ft.Kind() == reflect.Struct {
+						if !visited[ft] {
+							visited[ft] = true
+							next = append(next, ft)
+						}
+						continue
+					}
+				}
+				if !f.IsExported() {
+					continue
+				}
+				if name == "" {
+					name = f.Name
+				}
+				if seen[name] {
+					continue
+				}
+				seen[name] = true
+
+				prop, err := g.schemaFor(f.Type)
+				if err != nil {
+					return err
+				}
+				prop.Description = f.Tag.Get("description")
+				required := !strings.Contains(","+opts+",", ",omitempty,")
+				if required, err = applySchemaTag(prop, f.Tag.Get("jsonschema"), required); err != nil {
+					return fmt.Errorf("schema for %s.%s: %w", lt, f.Name, err)
+				}
+				if prop.nullable && len(prop.Enum) > 0 {
+					prop.Enum = append(prop.Enum, nil)
+				}
+				s.Properties[name] = prop
+				if required {
+					s.Required = append(s.Required, name)
+				}
+			}
+		}
+		level = next
+	}
+	return nil
+}
+
+// applySchemaTag applies a jsonschema struct tag to prop, returning whether the property
+// is required after any required/optional override.
+func applySchemaTag(prop *jsonSchema, tag string, required bool) (bool, error) {
+	if tag == "" {
+		return required, nil
+	}
+	for _, item := range strings.Split(tag, ",") {
+		key, value, _ := strings.Cut(item, "=")
+		switch key {
+		case "required":
+			required = true
+		case "optional":
+			required = false
+		case "enum":
+			for _, v := range strings.Split(value, "|") {
+				ev, err := enumValue(prop.Type, v)
+				if err != nil {
+					return required, err
+				}
+				prop.Enum = append(prop.Enum, ev)
+			}
+		case "minimum", "maximum":
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return required, fmt.Errorf("invalid %s %q", key, value)
+			}
+			if key == "minimum" {
+				prop.Minimum = &n
+			} else {
+				prop.Maximum = &n
+			}
+		case "minLength", "maxLength", "minItems", "maxItems":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return required, fmt.Errorf("invalid %s %q", key, value)
+			}
+			switch key {
+			case "minLength":
+				prop.MinLength = &n
+			case "maxLength":
+				prop.MaxLength = &n
+			case "minItems":
+				prop.MinItems = &n
+			case "maxItems":
+				prop.MaxItems = &n
+			}
+		case "format":
+			prop.Format = value
+		case "x-mcp-header":
+			prop.XMCPHeader = value
+		default:
+			return required, fmt.Errorf("unknown jsonschema tag option %q", key)
+		}
+	}
+	return required, nil
+}
+
+// enumValue converts one enum tag entry to the JSON type of the property it constrains, so
+// an integer field's enum=1|2 is [1,2] rather than ["1","2"].
+func enumValue(typ, v string) (interface{}, error) {
+	switch typ {
+	case "integer":
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer enum value %q", v)
+		}
+		return n, nil
+	case "number":
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number enum value %q", v)
+		}
+		return n, nil
+	case "boolean":
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid boolean enum value %q", v)
+		}
+		return b, nil
+	default:
+		return v, nil
+	}
+}
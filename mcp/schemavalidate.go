@@ -0,0 +1,917 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ValidationError reports the first place a JSON instance fails its schema. Path is an
+// RFC 6901 JSON Pointer to the offending value within the instance ("" for the instance
+// itself).
+type ValidationError struct {
+	Path    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// compiledSchema is a JSON Schema (2020-12) compiled for repeated validation. It covers
+// the assertion vocabulary tools actually use — type, enum/const, the numeric, string,
+// array and object keywords, the applicators (allOf/anyOf/oneOf/not, if/then/else,
+// dependentSchemas) and local $ref into the same document. format is an annotation, as
+// the 2020-12 default dialect has it, and unevaluatedProperties/unevaluatedItems,
+// $dynamicRef and references to other documents are not supported: compiling a schema that
+// uses them fails rather than silently under-validating.
+type compiledSchema struct {
+	boolean *bool // set for the boolean schemas true and false
+
+	ref   string
+	refTo *compiledSchema
+
+	types     []string
+	enum      []interface{}
+	hasConst  bool
+	constVal  interface{}
+	minimum   *big.Rat
+	maximum   *big.Rat
+	exclMin   *big.Rat
+	exclMax   *big.Rat
+	multOf    *big.Rat
+	minLength *int
+	maxLength *int
+	pattern   *regexp.Regexp
+
+	prefixItems []*compiledSchema
+	items       *compiledSchema
+	minItems    *int
+	maxItems    *int
+	uniqueItems bool
+	contains    *compiledSchema
+	minContains *int
+	maxContains *int
+
+	properties        map[string]*compiledSchema
+	patternProperties []patternSchema
+	additional        *compiledSchema
+	propertyNames     *compiledSchema
+	required          []string
+	minProperties     *int
+	maxProperties     *int
+	dependentRequired map[string][]string
+	dependentSchemas  map[string]*compiledSchema
+
+	allOf []*compiledSchema
+	anyOf []*compiledSchema
+	oneOf []*compiledSchema
+	not   *compiledSchema
+	ifS   *compiledSchema
+	thenS *compiledSchema
+	elseS *compiledSchema
+}
+
+type patternSchema struct {
+	re     *regexp.Regexp
+	schema *compiledSchema
+}
+
+// schemaCompiler compiles one schema document. Subschemas are cached by JSON Pointer so a
+// $ref cycle (a recursive schema) compiles to a cycle of *compiledSchema rather than
+// recursing forever.
+//
+// A lenient compiler does not stop at a keyword it cannot compile: it records the problem
+// in dropped and leaves that one keyword out, so the rest of the schema is still enforced.
+type schemaCompiler struct {
+	root    interface{}
+	cache   map[string]*compiledSchema
+	lenient bool
+	dropped []error
+}
+
+// compileSchema compiles raw for validation. An empty raw compiles to nil, which
+// validates everything.
+func compileSchema(raw json.RawMessage) (*compiledSchema, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	root, err := decodeJSONValue(raw)
+	if err != nil {
+		return nil, fmt.Errorf("schema is not valid JSON: %w", err)
+	}
+	c := &schemaCompiler{root: root, cache: map[string]*compiledSchema{}}
+	return c.compile(root, "")
+}
+
+// compileSchemaLenient is compileSchema for a schema that must be enforced even if parts
+// of it cannot be: each keyword that fails to compile is left out and reported in dropped,
+// and everything else is kept. A raw that is not JSON at all compiles to a schema that
+// rejects every value, so that nothing goes unchecked.
+func compileSchemaLenient(raw json.RawMessage) (s *compiledSchema, dropped []error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	root, err := decodeJSONValue(raw)
+	if err != nil {
+		reject := false
+		return &compiledSchema{boolean: &reject}, []error{fmt.Errorf("schema is not valid JSON: %w", err)}
+	}
+	c := &schemaCompiler{root: root, cache: map[string]*compiledSchema{}, lenient: true}
+	s, _ = c.compile(root, "")
+	return s, c.dropped
+}
+
+// drop reports a keyword that cannot be compiled: as the compile error, or, for a lenient
+// compiler, by recording it and returning nil so the caller carries on without it.
+func (c *schemaCompiler) drop(err error) error {
+	if !c.lenient {
+		return err
+	}
+	c.dropped = append(c.dropped, err)
+	return nil
+}
+
+// decodeJSONValue decodes raw into the generic form the validator works on, keeping numbers
+// as json.Number so that integers and decimals compare exactly.
+func decodeJSONValue(raw []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("trailing data after JSON value")
+	}
+	return v, nil
+}
+
+func (c *schemaCompiler) compile(node interface{}, ptr string) (*compiledSchema, error) {
+	if s, ok := c.cache[ptr]; ok {
+		return s, nil
+	}
+	s := &compiledSchema{}
+	c.cache[ptr] = s
+
+	if b, ok := node.(bool); ok {
+		s.boolean = &b
+		return s, nil
+	}
+	obj, ok := node.(map[string]interface{})
+	if !ok {
+		if err := c.drop(fmt.Errorf("schema at %q is not an object or boolean", "#"+ptr)); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+
+	var err error
+	sub := func(key string) (*compiledSchema, error) {
+		v, ok := obj[key]
+		if !ok {
+			return nil, nil
+		}
+		return c.compile(v, ptr+"/"+escapeJSONPointer(key))
+	}
+	subList := func(key string) ([]*compiledSchema, error) {
+		v, ok := obj[key]
+		if !ok {
+			return nil, nil
+		}
+		list, ok := v.([]interface{})
+		if !ok || len(list) == 0 {
+			return nil, c.drop(fmt.Errorf("%s at %q must be a non-empty array", key, "#"+ptr))
+		}
+		out := make([]*compiledSchema, len(list))
+		for i, item := range list {
+			if out[i], err = c.compile(item, ptr+"/"+key+"/"+strconv.Itoa(i)); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	}
+	subMap := func(key string) (map[string]*compiledSchema, error) {
+		v, ok := obj[key]
+		if !ok {
+			return nil, nil
+		}
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, c.drop(fmt.Errorf("%s at %q must be an object", key, "#"+ptr))
+		}
+		out := make(map[string]*compiledSchema, len(m))
+		for name, item := range m {
+			if out[name], err = c.compile(item, ptr+"/"+key+"/"+escapeJSONPointer(name)); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	}
+
+	for _, unsupported := range []string{"$dynamicRef", "$recursiveRef", "unevaluatedProperties", "unevaluatedItems"} {
+		if _, ok := obj[unsupported]; ok {
+			if err := c.drop(fmt.Errorf("schema at %q: %s is not supported", "#"+ptr, unsupported)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if v, ok := obj["$ref"]; ok {
+		ref, _ := v.(string)
+		target, err := c.resolveRef(ref)
+		if err != nil {
+			if err := c.drop(fmt.Errorf("schema at %q: %w", "#"+ptr, err)); err != nil {
+				return nil, err
+			}
+		} else {
+			s.ref = ref
+			if s.refTo, err = c.compile(target, refPointer(ref)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	badType := false
+	switch t := obj["type"].(type) {
+	case nil:
+	case string:
+		s.types = []string{t}
+	case []interface{}:
+		for _, item := range t {
+			name, ok := item.(string)
+			if !ok {
+				badType = true
+				break
+			}
+			s.types = append(s.types, name)
+		}
+	default:
+		badType = true
+	}
+	if badType {
+		s.types = nil
+		if err := c.drop(fmt.Errorf("type at %q must be a string or array of strings", "#"+ptr)); err != nil {
+			return nil, err
+		}
+	}
+	if v, ok := obj["enum"]; ok {
+		list, ok := v.([]interface{})
+		if !ok {
+			if err := c.drop(fmt.Errorf("enum at %q must be an array", "#"+ptr)); err != nil {
+				return nil, err
+			}
+		} else {
+			s.enum = list
+		}
+	}
+	if v, ok := obj["const"]; ok {
+		s.hasConst, s.constVal = true, v
+	}
+
+	for key, dst := range map[string]**big.Rat{
+		"minimum": &s.minimum, "maximum": &s.maximum,
+		"exclusiveMinimum": &s.exclMin, "exclusiveMaximum": &s.exclMax, "multipleOf": &s.multOf,
+	} {
+		if v, ok := obj[key]; ok {
+			r, ok := jsonRat(v)
+			if !ok {
+				if err := c.drop(fmt.Errorf("%s at %q must be a number", key, "#"+ptr)); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			*dst = r
+		}
+	}
+	if s.multOf != nil && s.multOf.Sign() <= 0 {
+		s.multOf = nil
+		if err := c.drop(fmt.Errorf("multipleOf at %q must be greater than 0", "#"+ptr)); err != nil {
+			return nil, err
+		}
+	}
+	for key, dst := range map[string]**int{
+		"minLength": &s.minLength, "maxLength": &s.maxLength,
+		"minItems": &s.minItems, "maxItems": &s.maxItems,
+		"minContains": &s.minContains, "maxContains": &s.maxContains,
+		"minProperties": &s.minProperties, "maxProperties": &s.maxProperties,
+	} {
+		if v, ok := obj[key]; ok {
+			n, ok := jsonNonNegativeInt(v)
+			if !ok {
+				if err := c.drop(fmt.Errorf("%s at %q must be a non-negative integer", key, "#"+ptr)); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			*dst = &n
+		}
+	}
+	if v, ok := obj["pattern"]; ok {
+		p, _ := v.(string)
+		if s.pattern, err = regexp.Compile(p); err != nil {
+			if err := c.drop(fmt.Errorf("pattern at %q: %w", "#"+ptr, err)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if s.prefixItems, err = subList("prefixItems"); err != nil {
+		return nil, err
+	}
+	if s.items, err = sub("items"); err != nil {
+		return nil, err
+	}
+	if s.contains, err = sub("contains"); err != nil {
+		return nil, err
+	}
+	s.uniqueItems, _ = obj["uniqueItems"].(bool)
+
+	if s.properties, err = subMap("properties"); err != nil {
+		return nil, err
+	}
+	if v, ok := obj["patternProperties"]; ok {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			if err := c.drop(fmt.Errorf("patternProperties at %q must be an object", "#"+ptr)); err != nil {
+				return nil, err
+			}
+		}
+		for _, p := range sortedJSONKeys(m) {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				if err := c.drop(fmt.Errorf("patternProperties at %q: %w", "#"+ptr, err)); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			ps, err := c.compile(m[p], ptr+"/patternProperties/"+escapeJSONPointer(p))
+			if err != nil {
+				return nil, err
+			}
+			s.patternProperties = append(s.patternProperties, patternSchema{re: re, schema: ps})
+		}
+	}
+	if s.additional, err = sub("additionalProperties"); err != nil {
+		return nil, err
+	}
+	if s.propertyNames, err = sub("propertyNames"); err != nil {
+		return nil, err
+	}
+	if v, ok := obj["required"]; ok {
+		list, ok := v.([]interface{})
+		if !ok {
+			if err := c.drop(fmt.Errorf("required at %q must be an array of strings", "#"+ptr)); err != nil {
+				return nil, err
+			}
+		}
+		for _, item := range list {
+			name, ok := item.(string)
+			if !ok {
+				if err := c.drop(fmt.Errorf("required at %q must be an array of strings", "#"+ptr)); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			s.required = append(s.required, name)
+		}
+	}
+	if v, ok := obj["dependentRequired"]; ok {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			if err := c.drop(fmt.Errorf("dependentRequired at %q must be an object", "#"+ptr)); err != nil {
+				return nil, err
+			}
+		}
+		s.dependentRequired = map[string][]string{}
+		for name, deps := range m {
+			list, _ := deps.([]interface{})
+			for _, d := range list {
+				if ds, ok := d.(string); ok {
+					s.dependentRequired[name] = append(s.dependentRequired[name], ds)
+				}
+			}
+		}
+	}
+	if s.dependentSchemas, err = subMap("dependentSchemas"); err != nil {
+		return nil, err
+	}
+
+	if s.allOf, err = subList("allOf"); err != nil {
+		return nil, err
+	}
+	if s.anyOf, err = subList("anyOf"); err != nil {
+		return nil, err
+	}
+	if s.oneOf, err = subList("oneOf"); err != nil {
+		return nil, err
+	}
+	if s.not, err = sub("not"); err != nil {
+		return nil, err
+	}
+	if s.ifS, err = sub("if"); err != nil {
+		return nil, err
+	}
+	if s.thenS, err = sub("then"); err != nil {
+		return nil, err
+	}
+	if s.elseS, err = sub("else"); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// resolveRef finds the node a local reference ("#", "#/$defs/x") points at.
+func (c *schemaCompiler) resolveRef(ref string) (interface{}, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("$ref %q: only references within the same schema are supported", ref)
+	}
+	node := c.root
+	ptr := refPointer(ref)
+	if ptr == "" {
+		return node, nil
+	}
+	if !strings.HasPrefix(ptr, "/") {
+		return nil, fmt.Errorf("$ref %q: anchors are not supported", ref)
+	}
+	for _, tok := range strings.Split(ptr[1:], "/") {
+		tok = strings.ReplaceAll(strings.ReplaceAll(tok, "~1", "/"), "~0", "~")
+		switch n := node.(type) {
+		case map[string]interface{}:
+			v, ok := n[tok]
+			if !ok {
+				return nil, fmt.Errorf("$ref %q does not resolve", ref)
+			}
+			node = v
+		case []interface{}:
+			i, err := strconv.Atoi(tok)
+			if err != nil || i < 0 || i >= len(n) {
+				return nil, fmt.Errorf("$ref %q does not resolve", ref)
+			}
+			node = n[i]
+		default:
+			return nil, fmt.Errorf("$ref %q does not resolve", ref)
+		}
+	}
+	return node, nil
+}
+
+// refPointer is the JSON Pointer part of a local reference, with the URI fragment's
+// percent-encoding undone.
+func refPointer(ref string) string {
+	frag := strings.TrimPrefix(ref, "#")
+	if unescaped, err := url.PathUnescape(frag); err == nil {
+		return unescaped
+	}
+	return frag
+}
+
+func escapeJSONPointer(tok string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(tok, "~", "~0"), "/", "~1")
+}
+
+// validate checks instance (in decodeJSONValue's generic form) against s. A nil s
+// accepts everything.
+func (s *compiledSchema) validate(instance interface{}) *ValidationError {
+	if s == nil {
+		return nil
+	}
+	return s.check(instance, "")
+}
+
+func (s *compiledSchema) check(v interface{}, path string) *ValidationError {
+	fail := func(format string, args ...interface{}) *ValidationError {
+		return &ValidationError{Path: path, Message: fmt.Sprintf(format, args...)}
+	}
+
+	if s.boolean != nil {
+		if !*s.boolean {
+			return fail("no value is allowed here")
+		}
+		return nil
+	}
+	if s.refTo != nil {
+		if err := s.refTo.check(v, path); err != nil {
+			return err
+		}
+	}
+
+	if len(s.types) > 0 {
+		matched := false
+		for _, t := range s.types {
+			if jsonTypeMatches(t, v) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fail("expected %s, got %s", strings.Join(s.types, " or "), jsonTypeName(v))
+		}
+	}
+	if s.enum != nil {
+		found := false
+		for _, e := range s.enum {
+			if jsonEqual(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fail("value is not one of the allowed values")
+		}
+	}
+	if s.hasConst && !jsonEqual(s.constVal, v) {
+		return fail("value does not equal the required constant")
+	}
+
+	switch val := v.(type) {
+	case json.Number:
+		if err := s.checkNumber(val, fail); err != nil {
+			return err
+		}
+	case string:
+		n := utf8.RuneCountInString(val)
+		if s.minLength != nil && n < *s.minLength {
+			return fail("string is shorter than %d characters", *s.minLength)
+		}
+		if s.maxLength != nil && n > *s.maxLength {
+			return fail("string is longer than %d characters", *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(val) {
+			return fail("string does not match pattern %q", s.pattern.String())
+		}
+	case []interface{}:
+		if err := s.checkArray(val, path, fail); err != nil {
+			return err
+		}
+	case map[string]interface{}:
+		if err := s.checkObject(val, path, fail); err != nil {
+			return err
+		}
+	}
+
+	for _, sub := range s.allOf {
+		if err := sub.check(v, path); err != nil {
+			return err
+		}
+	}
+	if s.anyOf != nil {
+		ok := false
+		for _, sub := range s.anyOf {
+			if sub.check(v, path) == nil {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fail("value does not match any of the anyOf schemas")
+		}
+	}
+	if s.oneOf != nil {
+		matches := 0
+		for _, sub := range s.oneOf {
+			if sub.check(v, path) == nil {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return fail("value matches %d of the oneOf schemas, want exactly 1", matches)
+		}
+	}
+	if s.not != nil && s.not.check(v, path) == nil {
+		return fail("value matches a schema it must not")
+	}
+	if s.ifS != nil {
+		if s.ifS.check(v, path) == nil {
+			if s.thenS != nil {
+				if err := s.thenS.check(v, path); err != nil {
+					return err
+				}
+			}
+		} else if s.elseS != nil {
+			if err := s.elseS.check(v, path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *compiledSchema) checkNumber(n json.Number, fail func(string, ...interface{}) *ValidationError) *ValidationError {
+	r, ok := numberRat(n)
+	if !ok {
+		return fail("number is malformed, or too large or too precise to validate")
+	}
+	if s.minimum != nil && r.Cmp(s.minimum) < 0 {
+		return fail("%s is less than the minimum %s", n, s.minimum.RatString())
+	}
+	if s.maximum != nil && r.Cmp(s.maximum) > 0 {
+		return fail("%s is greater than the maximum %s", n, s.maximum.RatString())
+	}
+	if s.exclMin != nil && r.Cmp(s.exclMin) <= 0 {
+		return fail("%s is not greater than the exclusive minimum %s", n, s.exclMin.RatString())
+	}
+	if s.exclMax != nil && r.Cmp(s.exclMax) >= 0 {
+		return fail("%s is not less than the exclusive maximum %s", n, s.exclMax.RatString())
+	}
+	if s.multOf != nil && !new(big.Rat).Quo(r, s.multOf).IsInt() {
+		return fail("%s is not a multiple of %s", n, s.multOf.RatString())
+	}
+	return nil
+}
+
+func (s *compiledSchema) checkArray(arr []interface{}, path string, fail func(string, ...interface{}) *ValidationError) *ValidationError {
+	if s.minItems != nil && len(arr) < *s.minItems {
+		return fail("array has fewer than %d items", *s.minItems)
+	}
+	if s.maxItems != nil && len(arr) > *s.maxItems {
+		return fail("array has more than %d items", *s.maxItems)
+	}
+	for i, item := range arr {
+		itemPath := path + "/" + strconv.Itoa(i)
+		if i < len(s.prefixItems) {
+			if err := s.prefixItems[i].check(item, itemPath); err != nil {
+				return err
+			}
+		} else if s.items != nil {
+			if err := s.items.check(item, itemPath); err != nil {
+				return err
+			}
+		}
+	}
+	if s.uniqueItems {
+		for i := range arr {
+			for j := i + 1; j < len(arr); j++ {
+				if jsonEqual(arr[i], arr[j]) {
+					return fail("items %d and %d are equal, but items must be unique", i, j)
+				}
+			}
+		}
+	}
+	if s.contains != nil {
+		matches := 0
+		for i, item := range arr {
+			if s.contains.check(item, path+"/"+strconv.Itoa(i)) == nil {
+				matches++
+			}
+		}
+		min := 1
+		if s.minContains != nil {
+			min = *s.minContains
+		}
+		if matches < min {
+			return fail("array contains %d matching items, want at least %d", matches, min)
+		}
+		if s.maxContains != nil && matches > *s.maxContains {
+			return fail("array contains %d matching items, want at most %d", matches, *s.maxContains)
+		}
+	}
+	return nil
+}
+
+func (s *compiledSchema) checkObject(obj map[string]interface{}, path string, fail func(string, ...interface{}) *ValidationError) *ValidationError {
+	if s.minProperties != nil && len(obj) < *s.minProperties {
+		return fail("object has fewer than %d properties", *s.minProperties)
+	}
+	if s.maxProperties != nil && len(obj) > *s.maxProperties {
+		return fail("object has more than %d properties", *s.maxProperties)
+	}
+	for _, name := range s.required {
+		if _, ok := obj[name]; !ok {
+			return fail("missing required property %q", name)
+		}
+	}
+	for name, deps := range s.dependentRequired {
+		if _, ok := obj[name]; !ok {
+			continue
+		}
+		for _, d := range deps {
+			if _, ok := obj[d]; !ok {
+				return fail("property %q requires property %q", name, d)
+			}
+		}
+	}
+
+	// Check properties in a fixed order so the reported error is deterministic.
+	for _, name := range sortedJSONKeys(obj) {
+		value := obj[name]
+		propPath := path + "/" + escapeJSONPointer(name)
+		if s.propertyNames != nil {
+			if err := s.propertyNames.check(name, propPath); err != nil {
+				return fail("invalid property name %q: %s", name, err.Message)
+			}
+		}
+		matched := false
+		if sub, ok := s.properties[name]; ok {
+			matched = true
+			if err := sub.check(value, propPath); err != nil {
+				return err
+			}
+		}
+		for _, pp := range s.patternProperties {
+			if pp.re.MatchString(name) {
+				matched = true
+				if err := pp.schema.check(value, propPath); err != nil {
+					return err
+				}
+			}
+		}
+		if !matched && s.additional != nil {
+			if s.additional.boolean != nil && !*s.additional.boolean {
+				return &ValidationError{Path: propPath, Message: fmt.Sprintf("property %q is not allowed", name)}
+			}
+			if err := s.additional.check(value, propPath); err != nil {
+				return err
+			}
+		}
+		if sub, ok := s.dependentSchemas[name]; ok {
+			if err := sub.check(obj, path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func jsonTypeMatches(t string, v interface{}) bool {
+	switch t {
+	case "null":
+		return v == nil
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "array":
+		_, ok := v.([]interface{})
+		return ok
+	case "object":
+		_, ok := v.(map[string]interface{})
+		return ok
+	case "number":
+		_, ok := v.(json.Number)
+		return ok
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return false
+		}
+		digits, exp, ok := numberParts(string(n))
+		return ok && (digits == "" || exp >= 0)
+	}
+	return false
+}
+
+func jsonTypeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	case json.Number:
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// jsonEqual is JSON value equality as JSON Schema defines it for enum, const and
+// uniqueItems: numbers compare by value (1 equals 1.0), everything else structurally.
+func jsonEqual(a, b interface{}) bool {
+	switch av := a.(type) {
+	case json.Number:
+		bv, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		ar, aok := numberRat(av)
+		br, bok := numberRat(bv)
+		return aok && bok && ar.Cmp(br) == 0
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !jsonEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for k, x := range av {
+			y, ok := bv[k]
+			if !ok || !jsonEqual(x, y) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b
+	}
+}
+
+func jsonRat(v interface{}) (*big.Rat, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return nil, false
+	}
+	return numberRat(n)
+}
+
+// maxNumberDigits and maxNumberExponent bound the numbers the validator will convert to
+// a big.Rat. Parsing a literal like 1e1000000 takes tens of milliseconds, and one request
+// can carry hundreds of them, so a number past either bound is refused from its text
+// alone. Both are far beyond anything a float64 or int64 argument can hold.
+const (
+	maxNumberDigits   = 400
+	maxNumberExponent = 400
+)
+
+// numberRat converts n to a big.Rat, unless numberParts refuses it.
+func numberRat(n json.Number) (*big.Rat, bool) {
+	if _, _, ok := numberParts(string(n)); !ok {
+		return nil, false
+	}
+	return new(big.Rat).SetString(string(n))
+}
+
+// numberParts reads a JSON number's text as ±digits × 10^exp, with digits stripped of
+// leading and trailing zeros ("" for zero). ok is false if the text is not a JSON number,
+// has more than maxNumberDigits digits, or an exponent beyond ±maxNumberExponent.
+func numberParts(s string) (digits string, exp int, ok bool) {
+	s = strings.TrimPrefix(s, "-")
+	mant, expText, hasExp := strings.Cut(strings.ToLower(s), "e")
+	if hasExp {
+		expText = strings.TrimLeft(strings.TrimPrefix(strings.TrimPrefix(expText, "+"), "-"), "0")
+		if len(expText) > len(strconv.Itoa(maxNumberExponent)) || !allDigits(expText) {
+			return "", 0, false
+		}
+		if expText != "" {
+			exp, _ = strconv.Atoi(expText)
+		}
+		if exp > maxNumberExponent {
+			return "", 0, false
+		}
+		if strings.Contains(s[len(mant)+1:], "-") {
+			exp = -exp
+		}
+	}
+	intPart, frac, _ := strings.Cut(mant, ".")
+	if intPart == "" || !allDigits(intPart) || !allDigits(frac) || len(intPart)+len(frac) > maxNumberDigits {
+		return "", 0, false
+	}
+	digits = strings.TrimLeft(intPart+frac, "0")
+	exp -= len(frac)
+	for strings.HasSuffix(digits, "0") {
+		digits = digits[:len(digits)-1]
+		exp++
+	}
+	return digits, exp, true
+}
+
+func allDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func jsonNonNegativeInt(v interface{}) (int, bool) {
+	r, ok := jsonRat(v)
+	if !ok || !r.IsInt() || r.Sign() < 0 || !r.Num().IsInt64() {
+		return 0, false
+	}
+	return int(r.Num().Int64()), true
+}
+
+func sortedJSONKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
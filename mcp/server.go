@@ -4,6 +4,9 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
 
 	"github.com/spirilis/generic-go-mcp/logging"
 	"github.com/spirilis/generic-go-mcp/transport"
@@ -36,9 +39,23 @@ type ServerConfig struct {
 
 	// DefaultCacheScope is used for every CacheableResult this server produces. Defaults
 	// to "public"; set to "private" if served tools/resources vary by caller (e.g. an
-	// authenticated, per-user catalog).
+	// authenticated, per-user catalog). Setting ToolVisible or ResourceVisible forces
+	// "private".
 	DefaultCacheScope string
 
+	// ToolVisible, if set, decides per request whether the caller may see tool, given the
+	// request's context and the principal PrincipalFromContext extracted from it. Over
+	// HTTP with auth enabled, the context also carries the authenticated user (see
+	// auth.GetUserFromContext) with their GitHub organization and team memberships. A
+	// hidden tool is left out of tools/list, a tools/call of it fails exactly as for an
+	// unknown tool, and a caller who can see no tools is advertised no tools capability.
+	ToolVisible func(ctx context.Context, principal string, tool Tool) bool
+
+	// ResourceVisible is ToolVisible for the static resources of the ResourceRegistry,
+	// applied to resources/list, resources/read, and the resourceSubscriptions of
+	// subscriptions/listen. Resource templates are not filtered.
+	ResourceVisible func(ctx context.Context, principal string, res Resource) bool
+
 	// ListTTLMs is the ttlMs hint on server/discover, tools/list, and resources/list
 	// results. Defaults to 300000 (5 minutes) if nil.
 	ListTTLMs *int64
@@ -46,17 +63,74 @@ type ServerConfig struct {
 	// ReadTTLMs is the ttlMs hint on resources/read results. Defaults to 0 (always
 	// stale) if nil.
 	ReadTTLMs *int64
+
+	// Prompts is the registry served over prompts/list and prompts/get. Optional: a nil
+	// registry is replaced by an empty one, so the server simply advertises no prompts
+	// capability until something is registered.
+	Prompts *PromptRegistry
+
+	// ResourceTemplates is the registry served over resources/templates/list, and the
+	// fallback resources/read consults for a URI no static resource is registered under.
+	// Optional, like Prompts: a nil registry is replaced by an empty one.
+	ResourceTemplates *ResourceTemplateRegistry
+
+	// ProgressInterval is the minimum spacing between two notifications/progress sent for
+	// the same request (see ToolRequest.ReportProgress); reports arriving faster are
+	// dropped. Defaults to 100ms if zero.
+	ProgressInterval time.Duration
+
+	// LogRedactor, if set, rewrites every attribute logged through a ToolRequest.Logger
+	// before it reaches stderr or the client, with the same contract as
+	// slog.HandlerOptions.ReplaceAttr: return the attribute with its value replaced (e.g.
+	// by "[REDACTED]") to mask it, or an empty Attr to drop it.
+	LogRedactor func(groups []string, a slog.Attr) slog.Attr
+
+	// Tasks enables the Tasks extension (see TasksConfig): a tools/call may then ask to run
+	// asynchronously and be polled with tasks/get, tasks/result, and tasks/cancel. Nil
+	// leaves it disabled and unadvertised, and a tools/call's "task" param is ignored.
+	Tasks *TasksConfig
+
+	// PageSize is how many entries tools/list, resources/list, resources/templates/list
+	// and prompts/list return per page. Defaults to 50. PageSizes overrides it per method,
+	// keyed by method name (e.g. "tools/list").
+	PageSize  int
+	PageSizes map[string]int
+
+	// MaxResourceSize bounds the content of one resources/read, in bytes of text or
+	// decoded blob summed over every contents entry; a read over it fails with -32603. A
+	// streamed resource (see StreamContent) stops being read as soon as it passes the
+	// limit. Zero or negative means no limit.
+	MaxResourceSize int64
+
+	// NotificationBuffer is how many notifications each subscriptions/listen stream may
+	// fall behind by before it overflows and is resynced (see Broker). Defaults to 16.
+	NotificationBuffer int
+
+	// Middleware wraps every routed request, Middleware[0] outermost (see Middleware), for
+	// cross-cutting concerns such as auditing, metrics, or authorization checks. For
+	// interceptors around individual tool calls, see ToolRegistry.Use.
+	Middleware []Middleware
 }
 
 // Server implements the MCP protocol (2026-07-28): a stateless request router over a
-// ToolRegistry and a ResourceRegistry.
+// ToolRegistry, a ResourceRegistry (plus its ResourceTemplateRegistry), and a
+// PromptRegistry.
 type Server struct {
 	registry         *ToolRegistry
 	resourceRegistry *ResourceRegistry
+	templateRegistry *ResourceTemplateRegistry
+	promptRegistry   *PromptRegistry
 	config           ServerConfig
 	broker           *Broker
+	tasks            *taskManager
+	handler          RequestHandler // route wrapped in config.Middleware
 	listTTLMs        int64
 	readTTLMs        int64
+
+	listenMu sync.Mutex
+	closed   bool           // set by Shutdown; no new subscriptions/listen from then on
+	closing  chan struct{}  // closed by Shutdown, telling live listens to end
+	listens  sync.WaitGroup // live subscriptions/listen handlers
 }
 
 // NewServer creates a new MCP server with the given registry, resource registry, and
@@ -79,8 +153,20 @@ func NewServer(registry *ToolRegistry, resourceRegistry *ResourceRegistry, confi
 		cfg.RequestStateKey = config.RequestStateKey
 		cfg.PrincipalFromContext = config.PrincipalFromContext
 		cfg.DefaultCacheScope = config.DefaultCacheScope
+		cfg.ToolVisible = config.ToolVisible
+		cfg.ResourceVisible = config.ResourceVisible
 		cfg.ListTTLMs = config.ListTTLMs
 		cfg.ReadTTLMs = config.ReadTTLMs
+		cfg.Prompts = config.Prompts
+		cfg.ResourceTemplates = config.ResourceTemplates
+		cfg.ProgressInterval = config.ProgressInterval
+		cfg.LogRedactor = config.LogRedactor
+		cfg.Tasks = config.Tasks
+		cfg.Middleware = append([]Middleware(nil), config.Middleware...)
+		cfg.PageSize = config.PageSize
+		cfg.PageSizes = config.PageSizes
+		cfg.NotificationBuffer = config.NotificationBuffer
+		cfg.MaxResourceSize = config.MaxResourceSize
 	}
 	if len(cfg.RequestStateKey) == 0 {
 		key := make([]byte, 32)
@@ -93,6 +179,21 @@ func NewServer(registry *ToolRegistry, resourceRegistry *ResourceRegistry, confi
 	if cfg.DefaultCacheScope == "" {
 		cfg.DefaultCacheScope = CacheScopePublic
 	}
+	if cfg.Prompts == nil {
+		cfg.Prompts = NewPromptRegistry()
+	}
+	if cfg.ResourceTemplates == nil {
+		cfg.ResourceTemplates = NewResourceTemplateRegistry()
+	}
+	if cfg.PageSize <= 0 {
+		cfg.PageSize = defaultPageSize
+	}
+	if cfg.NotificationBuffer <= 0 {
+		cfg.NotificationBuffer = defaultNotificationBuffer
+	}
+	if cfg.ProgressInterval <= 0 {
+		cfg.ProgressInterval = defaultProgressInterval
+	}
 
 	listTTL := defaultListTTLMs
 	if cfg.ListTTLMs != nil {
@@ -103,19 +204,30 @@ func NewServer(registry *ToolRegistry, resourceRegistry *ResourceRegistry, confi
 		readTTL = *cfg.ReadTTLMs
 	}
 
-	broker := newBroker()
+	broker := newBroker(cfg.NotificationBuffer)
 	registry.onChange = broker.notifyToolsListChanged
 	resourceRegistry.onChange = broker.notifyResourcesListChanged
 	resourceRegistry.onUpdate = broker.notifyResourceUpdated
+	cfg.ResourceTemplates.onChange = broker.notifyResourcesListChanged
+	cfg.ResourceTemplates.onUpdate = broker.notifyResourceUpdated
+	cfg.Prompts.onChange = broker.notifyPromptsListChanged
 
-	return &Server{
+	srv := &Server{
 		registry:         registry,
 		resourceRegistry: resourceRegistry,
+		templateRegistry: cfg.ResourceTemplates,
+		promptRegistry:   cfg.Prompts,
 		config:           cfg,
 		broker:           broker,
 		listTTLMs:        listTTL,
 		readTTLMs:        readTTL,
+		closing:          make(chan struct{}),
 	}
+	if cfg.Tasks != nil {
+		srv.tasks = newTaskManager(*cfg.Tasks, srv.serverInfo())
+	}
+	srv.handler = chainMiddleware(srv.route, cfg.Middleware)
+	return srv
 }
 
 func (s *Server) serverInfo() *Implementation {
@@ -123,20 +235,36 @@ func (s *Server) serverInfo() *Implementation {
 }
 
 func (s *Server) cacheScope() string {
+	if s.filtering() {
+		// A shared cache would hand one caller's catalog to another.
+		return CacheScopePrivate
+	}
 	return s.config.DefaultCacheScope
 }
 
-// capabilities reports which of tools/resources/prompts this server actually serves: a
-// registry with no entries declares no capability for it, rather than an always-present
-// empty object.
-func (s *Server) capabilities() ServerCapabilities {
+// capabilities reports which of tools/resources/prompts this server actually serves to
+// the caller behind ctx: a registry with no entries (or none the caller may see) declares
+// no capability for it, rather than an always-present empty object. Templates count
+// toward resources: a server serving only templated resources still serves resources.
+func (s *Server) capabilities(ctx context.Context) ServerCapabilities {
 	var caps ServerCapabilities
-	if s.registry.HasTools() {
+	if len(s.toolListing(ctx).items) > 0 {
 		caps.Tools = &ToolsCapability{ListChanged: true}
+		// Any tool may log through its ToolRequest.Logger.
+		caps.Logging = &LoggingCapability{}
 	}
-	if s.resourceRegistry.HasResources() {
+	if len(s.resourceListing(ctx).items) > 0 || s.templateRegistry.HasTemplates() {
 		caps.Resources = &ResourcesCapability{ListChanged: true}
 	}
+	if s.promptRegistry.HasPrompts() {
+		caps.Prompts = &PromptsCapability{ListChanged: true}
+	}
+	if s.promptRegistry.HasCompletions() || s.templateRegistry.HasCompletions() {
+		caps.Completions = &CompletionsCapability{}
+	}
+	if s.tasks != nil {
+		caps.Extensions = map[string]json.RawMessage{ExtensionTasks: tasksCapability}
+	}
 	return caps
 }
 
@@ -187,24 +315,11 @@ func (s *Server) HandleMessage(ctx context.Context, data []byte, w transport.Res
 		return
 	}
 
-	var result Result
-	switch req.Method {
-	case "server/discover":
-		result, rerr = s.handleDiscover(ctx, meta)
-	case "tools/list":
-		result, rerr = s.handleToolsList(ctx, req.Params)
-	case "tools/call":
-		result, rerr = s.handleToolsCall(ctx, meta, req.Params)
-	case "resources/list":
-		result, rerr = s.handleResourcesList(ctx, req.Params)
-	case "resources/read":
-		result, rerr = s.handleResourcesRead(ctx, req.Params)
-	default:
-		logging.Debug("JSON-RPC method not found", "method", req.Method)
-		w.WriteMessage(transport.NewErrorResponse(req.ID, &transport.RPCError{Code: transport.MethodNotFound, Message: "Method not found"}))
-		return
+	result, rerr := s.handler(ctx, &Request{Method: req.Method, ID: req.ID, Meta: meta, Params: req.Params, w: w})
+	if rerr == nil && result == nil {
+		// Only a misbehaving Middleware can get here; every handler returns one or the other.
+		rerr = &transport.RPCError{Code: transport.InternalError, Message: "Internal error: no result"}
 	}
-
 	if rerr != nil {
 		logging.Debug("JSON-RPC error", "method", req.Method, "error", rerr.Message)
 		w.WriteMessage(transport.NewErrorResponse(req.ID, rerr))
@@ -221,3 +336,37 @@ func (s *Server) HandleMessage(ctx context.Context, data []byte, w transport.Res
 
 	w.WriteMessage(transport.NewSuccessResponse(req.ID, result))
 }
+
+// route dispatches a request to its method's handler; it is the innermost RequestHandler
+// of the Middleware chain.
+func (s *Server) route(ctx context.Context, req *Request) (Result, *transport.RPCError) {
+	switch req.Method {
+	case "server/discover":
+		return s.handleDiscover(ctx, req.Meta)
+	case "tools/list":
+		return s.handleToolsList(ctx, req.Params)
+	case "tools/call":
+		return s.handleToolsCall(ctx, req.Meta, req.Params, req.w)
+	case "resources/list":
+		return s.handleResourcesList(ctx, req.Params)
+	case "resources/read":
+		return s.handleResourcesRead(ctx, req.Meta, req.Params)
+	case "resources/templates/list":
+		return s.handleResourcesTemplatesList(ctx, req.Params)
+	case "prompts/list":
+		return s.handlePromptsList(ctx, req.Params)
+	case "prompts/get":
+		return s.handlePromptsGet(ctx, req.Meta, req.Params)
+	case "completion/complete":
+		return s.handleComplete(ctx, req.Meta, req.Params)
+	case "tasks/get":
+		return s.handleTasksGet(ctx, req.Params)
+	case "tasks/result":
+		return s.handleTasksResult(ctx, req.Params)
+	case "tasks/cancel":
+		return s.handleTasksCancel(ctx, req.Params)
+	default:
+		logging.Debug("JSON-RPC method not found", "method", req.Method)
+		return nil, &transport.RPCError{Code: transport.MethodNotFound, Message: "Method not found"}
+	}
+}
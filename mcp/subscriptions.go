@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"slices"
 	"sync"
+	"sync/atomic"
 
+	"github.com/spirilis/generic-go-mcp/logging"
 	"github.com/spirilis/generic-go-mcp/transport"
 )
 
@@ -23,29 +25,106 @@ type subscriptionsListenParams struct {
 	Notifications NotificationFilter `json:"notifications"`
 }
 
+// defaultNotificationBuffer is how many notifications a subscriptions/listen stream may
+// fall behind by before it overflows, unless ServerConfig.NotificationBuffer says otherwise.
+const defaultNotificationBuffer = 16
+
 type pendingNotification struct {
 	method string
 	params map[string]interface{}
+	key    string // coalescing key; see coalesceKey
+}
+
+// coalesceKey identifies notifications that say the same thing: two list_changed of one
+// kind, or two resources/updated for one URI. While one is still queued for a subscriber,
+// another with the same key adds nothing, since the client will re-list or re-read once
+// either way.
+func coalesceKey(method string, params map[string]interface{}) string {
+	if uri, ok := params["uri"].(string); ok {
+		return method + "\x00" + uri
+	}
+	return method
 }
 
 type subscription struct {
-	filter NotificationFilter
-	ch     chan pendingNotification
+	filter  NotificationFilter
+	watches []resourceWatch // one per filter.ResourceSubscriptions entry
+	ch      chan pendingNotification
+
+	mu       sync.Mutex
+	queued   map[string]bool // coalescing keys of the notifications in ch
+	overflow chan struct{}   // signalled when a notification could not be queued
+}
+
+// next records that n has left the queue, so the next one like it is queued again.
+func (sub *subscription) next(n pendingNotification) {
+	sub.mu.Lock()
+	delete(sub.queued, n.key)
+	sub.mu.Unlock()
+}
+
+// drain empties the queue, returning how many notifications it discarded.
+func (sub *subscription) drain() int {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	n := 0
+	for {
+		select {
+		case <-sub.ch:
+			n++
+		default:
+			clear(sub.queued)
+			return n
+		}
+	}
+}
+
+// NotificationStats counts what the Broker did with the notifications it could not simply
+// deliver, for export as metrics (see Server.NotificationStats). The counts only grow.
+type NotificationStats struct {
+	// Coalesced counts notifications not queued because an identical one was already
+	// waiting for the same subscriber.
+	Coalesced uint64
+
+	// Dropped counts notifications lost because a subscriber's buffer was full, including
+	// those discarded from its queue when it was resynced.
+	Dropped uint64
+
+	// Resyncs counts overflowed subscribers that were told to resync.
+	Resyncs uint64
 }
 
 // Broker fans registry-mutation notifications out to every live subscriptions/listen
 // stream that opted into them. A Server owns exactly one Broker.
+//
+// A registry mutation never waits on a slow subscriber. Each subscriber has a buffer of
+// its own; duplicates are coalesced while queued, and a notification that still finds the
+// buffer full is dropped and the subscriber marked as overflowed. Its listen stream then
+// discards whatever is still queued and resyncs the client instead: one list_changed for
+// every list it watches and one resources/updated for every resource it watches, so the
+// client re-lists and re-reads, and no change is silently lost.
 type Broker struct {
-	mu   sync.Mutex
-	subs map[*subscription]struct{}
+	mu     sync.Mutex
+	subs   map[*subscription]struct{}
+	buffer int
+
+	coalesced atomic.Uint64
+	dropped   atomic.Uint64
+	resyncs   atomic.Uint64
 }
 
-func newBroker() *Broker {
-	return &Broker{subs: make(map[*subscription]struct{})}
+func newBroker(buffer int) *Broker {
+	return &Broker{subs: make(map[*subscription]struct{}), buffer: buffer}
 }
 
-func (b *Broker) subscribe(filter NotificationFilter) *subscription {
-	sub := &subscription{filter: filter, ch: make(chan pendingNotification, 16)}
+func (b *Broker) subscribe(filter NotificationFilter, watches []resourceWatch) *subscription {
+	sub := &subscription{
+		filter:   filter,
+		watches:  watches,
+		ch:       make(chan pendingNotification, b.buffer),
+		queued:   make(map[string]bool),
+		overflow: make(chan struct{}, 1),
+	}
 	b.mu.Lock()
 	b.subs[sub] = struct{}{}
 	b.mu.Unlock()
@@ -58,41 +137,99 @@ func (b *Broker) unsubscribe(sub *subscription) {
 	b.mu.Unlock()
 }
 
-func (b *Broker) broadcast(want func(NotificationFilter) bool, method string, params map[string]interface{}) {
+func (b *Broker) broadcast(want func(*subscription) bool, method string, params map[string]interface{}) {
+	n := pendingNotification{method: method, params: params, key: coalesceKey(method, params)}
 	b.mu.Lock()
 	defer b.mu.Unlock()
 	for sub := range b.subs {
-		if !want(sub.filter) {
-			continue
+		if want(sub) {
+			b.enqueue(sub, n)
 		}
+	}
+}
+
+func (b *Broker) enqueue(sub *subscription, n pendingNotification) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if sub.queued[n.key] {
+		b.coalesced.Add(1)
+		return
+	}
+	select {
+	case sub.ch <- n:
+		sub.queued[n.key] = true
+	default:
+		b.dropped.Add(1)
 		select {
-		case sub.ch <- pendingNotification{method: method, params: params}:
+		case sub.overflow <- struct{}{}:
+			logging.Warn("Subscriber fell behind; notification dropped, resync scheduled", "method", n.method, "buffer", cap(sub.ch))
 		default:
-			// Slow subscriber: drop rather than block the registry mutation that
-			// triggered this notification.
+			// A resync is already pending and will cover this one too.
 		}
 	}
 }
 
+// resync discards sub's queue and writes the notifications that tell its client to
+// re-list and re-read everything it watches (see Broker).
+func (b *Broker) resync(sub *subscription, id json.RawMessage, w transport.ResponseWriter) {
+	b.dropped.Add(uint64(sub.drain()))
+	b.resyncs.Add(1)
+	f := sub.filter
+	for _, lc := range []struct {
+		on     bool
+		method string
+	}{
+		{f.ToolsListChanged, "notifications/tools/list_changed"},
+		{f.PromptsListChanged, "notifications/prompts/list_changed"},
+		{f.ResourcesListChanged, "notifications/resources/list_changed"},
+	} {
+		if lc.on {
+			_ = w.WriteNotification(lc.method, withSubscriptionMeta(nil, id))
+		}
+	}
+	for _, uri := range f.ResourceSubscriptions {
+		_ = w.WriteNotification("notifications/resources/updated", withSubscriptionMeta(map[string]interface{}{"uri": uri}, id))
+	}
+}
+
+func (b *Broker) stats() NotificationStats {
+	return NotificationStats{
+		Coalesced: b.coalesced.Load(),
+		Dropped:   b.dropped.Load(),
+		Resyncs:   b.resyncs.Load(),
+	}
+}
+
+// NotificationStats reports the broker's coalesce, drop, and resync counts since the
+// server was created.
+func (s *Server) NotificationStats() NotificationStats {
+	return s.broker.stats()
+}
+
 func (b *Broker) notifyToolsListChanged() {
-	b.broadcast(func(f NotificationFilter) bool { return f.ToolsListChanged }, "notifications/tools/list_changed", nil)
+	b.broadcast(func(sub *subscription) bool { return sub.filter.ToolsListChanged }, "notifications/tools/list_changed", nil)
+}
+
+func (b *Broker) notifyPromptsListChanged() {
+	b.broadcast(func(sub *subscription) bool { return sub.filter.PromptsListChanged }, "notifications/prompts/list_changed", nil)
 }
 
 func (b *Broker) notifyResourcesListChanged() {
-	b.broadcast(func(f NotificationFilter) bool { return f.ResourcesListChanged }, "notifications/resources/list_changed", nil)
+	b.broadcast(func(sub *subscription) bool { return sub.filter.ResourcesListChanged }, "notifications/resources/list_changed", nil)
 }
 
-// notifyResourceUpdated announces a content change on uri to every listener that named that
-// exact URI in its resourceSubscriptions. Matching is exact: the spec permits a server to
-// announce a sub-resource of a subscribed URI, but this registry has no URI hierarchy to
-// derive one from.
+// notifyResourceUpdated announces a content change on uri to every listener with a
+// resourceSubscriptions entry covering it (see resourceWatches): the URI itself, one of its
+// ancestors, or a template it expands.
 //
 // Unlike the two list_changed broadcasts, this carries params. The map is shared across every
 // matching subscriber, which is safe because withSubscriptionMeta copies into a fresh map per
 // delivery rather than mutating what it is handed.
 func (b *Broker) notifyResourceUpdated(uri string) {
 	b.broadcast(
-		func(f NotificationFilter) bool { return slices.Contains(f.ResourceSubscriptions, uri) },
+		func(sub *subscription) bool {
+			return slices.ContainsFunc(sub.watches, func(w resourceWatch) bool { return w(uri) })
+		},
 		"notifications/resources/updated",
 		map[string]interface{}{"uri": uri},
 	)
@@ -116,23 +253,35 @@ func withSubscriptionMeta(params map[string]interface{}, id json.RawMessage) map
 
 // handleSubscriptionsListen implements subscriptions/listen: it acknowledges the
 // subscription, then blocks relaying matching notifications until ctx is cancelled
-// (the client closed its stream on HTTP, or sent notifications/cancelled on stdio/UNIX).
+// (the client closed its stream on HTTP, or sent notifications/cancelled on stdio/UNIX)
+// or the server shuts down.
 //
 // This is a long-lived request handled outside the uniform Result-returning dispatch in
 // HandleMessage, since it needs to write directly through the ResponseWriter rather than
 // return a single result.
 //
-// Simplification: on ctx cancellation this returns without writing a final JSON-RPC
-// response, treating every termination as the "abrupt disconnect" case. The spec's
-// "graceful closure" (an empty result response before closing, for server-initiated
-// teardown) is a SHOULD, not a MUST, and is not implemented in this round.
+// A client-initiated end (ctx cancelled) is the spec's "abrupt disconnect": nothing more
+// is written. A server-initiated one (Shutdown) is its "graceful closure": an empty
+// result, which tells the client the stream ended on purpose.
 func (s *Server) handleSubscriptionsListen(ctx context.Context, id json.RawMessage, params json.RawMessage, w transport.ResponseWriter) {
 	var p subscriptionsListenParams
 	if len(params) > 0 {
 		_ = json.Unmarshal(params, &p)
 	}
 
-	sub := s.broker.subscribe(p.Notifications)
+	s.listenMu.Lock()
+	if s.closed {
+		s.listenMu.Unlock()
+		w.WriteMessage(transport.NewErrorResponse(id, shuttingDownErr()))
+		return
+	}
+	s.listens.Add(1)
+	s.listenMu.Unlock()
+	defer s.listens.Done()
+
+	filter := p.Notifications
+	filter.ResourceSubscriptions = s.visibleSubscriptions(ctx, filter.ResourceSubscriptions)
+	sub := s.broker.subscribe(filter, s.resourceWatches(ctx, filter.ResourceSubscriptions))
 	defer s.broker.unsubscribe(sub)
 
 	ackParams := withSubscriptionMeta(map[string]interface{}{"notifications": p.Notifications}, id)
@@ -144,8 +293,57 @@ func (s *Server) handleSubscriptionsListen(ctx context.Context, id json.RawMessa
 		select {
 		case <-ctx.Done():
 			return
+		case <-s.closing:
+			result := &BaseResult{Meta: map[string]interface{}{metaKeySubscriptionID: id}}
+			result.setResultType(ResultTypeComplete)
+			result.setServerInfo(s.serverInfo())
+			_ = w.WriteMessage(transport.NewSuccessResponse(id, result))
+			return
 		case n := <-sub.ch:
+			sub.next(n)
 			_ = w.WriteNotification(n.method, withSubscriptionMeta(n.params, id))
+		case <-sub.overflow:
+			s.broker.resync(sub, id, w)
+		}
+	}
+}
+
+// Shutdown ends every live subscriptions/listen stream gracefully, each with its final,
+// empty JSON-RPC result, and waits until they have all been written or ctx is done,
+// returning ctx's error in the latter case. From the moment it is called, a new
+// subscriptions/listen is refused with -32603; every other method keeps working, so
+// requests already in flight can finish. It is safe to call more than once, and every
+// transport's Stop calls it (see transport.Shutdowner) before closing connections, so a
+// server serving several transports stops streaming on all of them as soon as one stops.
+//
+// With Tasks enabled it also refuses new tasks and cancels those queued or running, even
+// if ctx is done before the listens have ended, and waits for the task workers to exit
+// under the same ctx.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.listenMu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.closing)
+	}
+	s.listenMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.listens.Wait()
+		close(done)
+	}()
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	// Stop the task workers even if the listens ran out of time: with ctx already done,
+	// this still refuses new tasks and cancels the rest, just without waiting.
+	if s.tasks != nil {
+		if terr := s.tasks.close(ctx); err == nil {
+			err = terr
 		}
 	}
+	return err
 }
@@ -0,0 +1,423 @@
+package mcp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/spirilis/generic-go-mcp/logging"
+	"github.com/spirilis/generic-go-mcp/transport"
+)
+
+// ExtensionTasks is the identifier the Tasks extension is advertised under in
+// ServerCapabilities.Extensions.
+const ExtensionTasks = "io.modelcontextprotocol/tasks"
+
+// Task status values.
+const (
+	TaskStatusWorking       = "working"
+	TaskStatusInputRequired = "input_required"
+	TaskStatusCompleted     = "completed"
+	TaskStatusFailed        = "failed"
+	TaskStatusCancelled     = "cancelled"
+)
+
+// Defaults for TasksConfig fields left zero.
+const (
+	defaultTaskWorkers      = 4
+	defaultTaskQueueSize    = 64
+	defaultTaskTTL          = time.Hour
+	defaultTaskMaxTTL       = 24 * time.Hour
+	defaultTaskPollInterval = time.Second
+)
+
+// TasksConfig enables and tunes the Tasks extension: a tools/call carrying a "task"
+// param returns a task handle at once, and the tool runs on a server-owned worker pool,
+// detached from the request (and so from the client's connection). The client polls
+// tasks/get, fetches the outcome with tasks/result, and may tasks/cancel it.
+type TasksConfig struct {
+	Workers      int           // concurrent task executions; default 4
+	QueueSize    int           // tasks waiting for a worker before tools/call is refused; default 64
+	DefaultTTL   time.Duration // lifetime of a task whose request names no ttl; default 1h
+	MaxTTL       time.Duration // cap on a requested ttl; default 24h
+	PollInterval time.Duration // suggested tasks/get interval, sent to the client; default 1s
+}
+
+// TaskParams is the "task" param of a tools/call asking to run as a task. TTL is the
+// requested lifetime in milliseconds, 0 for the server's default.
+type TaskParams struct {
+	TTL int64 `json:"ttl,omitempty"`
+}
+
+// Task is the wire form of a task's state. Timestamps are RFC 3339; TTL and PollInterval
+// are milliseconds.
+type Task struct {
+	TaskID        string `json:"taskId"`
+	Status        string `json:"status"`
+	StatusMessage string `json:"statusMessage,omitempty"`
+	CreatedAt     string `json:"createdAt"`
+	LastUpdatedAt string `json:"lastUpdatedAt"`
+	TTL           int64  `json:"ttl"`
+	PollInterval  int64  `json:"pollInterval,omitempty"`
+}
+
+// CreateTaskResult is what a task-augmented tools/call returns in place of its result.
+type CreateTaskResult struct {
+	BaseResult
+	Task Task `json:"task"`
+}
+
+// TaskStatusResult is the result of tasks/get and tasks/cancel: the task's current state.
+type TaskStatusResult struct {
+	BaseResult
+	Task
+}
+
+// TaskIDParams is the params of tasks/get, tasks/result, and tasks/cancel.
+type TaskIDParams struct {
+	TaskID string `json:"taskId"`
+}
+
+// taskRecord is one task's server-side state. Everything but the immutable identity
+// fields is guarded by taskManager.mu.
+type taskRecord struct {
+	id        string
+	principal string
+	created   time.Time
+	ttl       time.Duration
+	run       func(ctx context.Context) (Result, *transport.RPCError)
+	ctx       context.Context
+	cancel    context.CancelFunc
+	done      chan struct{}
+
+	status  string
+	message string
+	updated time.Time
+	payload json.RawMessage // the marshalled final result, once there is one
+	rpcErr  *transport.RPCError
+}
+
+// taskManager owns the worker pool and every live task.
+type taskManager struct {
+	cfg        TasksConfig
+	serverInfo *Implementation
+	queue      chan *taskRecord
+	workers    sync.WaitGroup
+
+	mu     sync.Mutex
+	tasks  map[string]*taskRecord
+	closed bool // queue is closed; set by close
+}
+
+func newTaskManager(cfg TasksConfig, serverInfo *Implementation) *taskManager {
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaultTaskWorkers
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultTaskQueueSize
+	}
+	if cfg.DefaultTTL <= 0 {
+		cfg.DefaultTTL = defaultTaskTTL
+	}
+	if cfg.MaxTTL <= 0 {
+		cfg.MaxTTL = defaultTaskMaxTTL
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultTaskPollInterval
+	}
+	m := &taskManager{
+		cfg:        cfg,
+		serverInfo: serverInfo,
+		queue:      make(chan *taskRecord, cfg.QueueSize),
+		tasks:      make(map[string]*taskRecord),
+	}
+	m.workers.Add(cfg.Workers)
+	for i := 0; i < cfg.Workers; i++ {
+		go m.worker()
+	}
+	return m
+}
+
+var (
+	// errTaskQueueFull is returned by start when every worker is busy and the queue is full.
+	errTaskQueueFull = errors.New("task queue is full")
+	// errTasksClosed is returned by start once the server has shut the task manager down.
+	errTasksClosed = errors.New("server is shutting down")
+)
+
+// start creates a task owned by principal and queues run on the worker pool. run gets a
+// context that keeps reqCtx's values (the authenticated caller, for instance) but not its
+// cancellation: the task outlives the request that created it, and ends only when it
+// finishes, is cancelled, or expires.
+func (m *taskManager) start(reqCtx context.Context, principal string, p *TaskParams, run func(ctx context.Context) (Result, *transport.RPCError)) (*CreateTaskResult, error) {
+	ttl := m.cfg.DefaultTTL
+	if p.TTL > 0 {
+		// Clamp before converting: a huge ttl would overflow time.Duration and wrap.
+		if limit := int64(m.cfg.MaxTTL / time.Millisecond); p.TTL > limit {
+			ttl = m.cfg.MaxTTL
+		} else {
+			ttl = time.Duration(p.TTL) * time.Millisecond
+		}
+	}
+	if ttl > m.cfg.MaxTTL {
+		ttl = m.cfg.MaxTTL
+	}
+
+	now := time.Now()
+	ctx, cancel := context.WithCancel(context.WithoutCancel(reqCtx))
+	t := &taskRecord{
+		id:        newTaskID(),
+		principal: principal,
+		created:   now,
+		ttl:       ttl,
+		run:       run,
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+		status:    TaskStatusWorking,
+		updated:   now,
+	}
+
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		cancel()
+		return nil, errTasksClosed
+	}
+	m.sweepLocked(now)
+	select {
+	case m.queue <- t:
+	default:
+		m.mu.Unlock()
+		cancel()
+		return nil, errTaskQueueFull
+	}
+	m.tasks[t.id] = t
+	wire := m.wireLocked(t)
+	m.mu.Unlock()
+
+	return &CreateTaskResult{Task: wire}, nil
+}
+
+func (m *taskManager) worker() {
+	defer m.workers.Done()
+	for t := range m.queue {
+		m.execute(t)
+	}
+}
+
+// close refuses new tasks, cancels every task still queued or running, and waits until
+// the workers have exited or ctx is done, returning ctx's error in the latter case.
+// Finished tasks stay readable with tasks/get and tasks/result until they expire. It is
+// safe to call more than once.
+func (m *taskManager) close(ctx context.Context) error {
+	m.mu.Lock()
+	if !m.closed {
+		m.closed = true
+		close(m.queue)
+		now := time.Now()
+		for _, t := range m.tasks {
+			if t.status == TaskStatusWorking {
+				t.status, t.message, t.updated = TaskStatusCancelled, "server shut down", now
+			}
+			t.cancel()
+		}
+	}
+	m.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		m.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *taskManager) execute(t *taskRecord) {
+	defer close(t.done)
+	if t.ctx.Err() != nil {
+		return // cancelled or expired while queued
+	}
+
+	result, rerr := t.run(t.ctx)
+	status := TaskStatusCompleted
+	var payload json.RawMessage
+	if rerr != nil {
+		status = TaskStatusFailed
+	} else {
+		switch r := result.(type) {
+		case *InputRequiredResult:
+			status = TaskStatusInputRequired
+		case *ToolCallResult:
+			if r.IsError {
+				status = TaskStatusFailed
+			}
+		}
+		result.setResultType(ResultTypeComplete)
+		result.setServerInfo(m.serverInfo)
+		var err error
+		if payload, err = json.Marshal(result); err != nil {
+			status, rerr = TaskStatusFailed, internalErr(err)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t.cancel()
+	if t.status == TaskStatusCancelled {
+		return
+	}
+	t.status, t.updated, t.payload, t.rpcErr = status, time.Now(), payload, rerr
+	if rerr != nil {
+		t.message = rerr.Message
+	}
+}
+
+// lookup returns the task id names if it exists, hasn't expired, and belongs to
+// principal. A task owned by someone else is indistinguishable from a missing one, so
+// task IDs leak nothing across principals.
+func (m *taskManager) lookup(id, principal string) (*taskRecord, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweepLocked(time.Now())
+	t, ok := m.tasks[id]
+	if !ok || t.principal != principal {
+		return nil, false
+	}
+	return t, true
+}
+
+// sweepLocked forgets every task past its TTL, cancelling any still running. Callers
+// hold m.mu.
+func (m *taskManager) sweepLocked(now time.Time) {
+	for id, t := range m.tasks {
+		if now.Sub(t.created) > t.ttl {
+			t.cancel()
+			delete(m.tasks, id)
+		}
+	}
+}
+
+func (m *taskManager) wire(t *taskRecord) Task {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.wireLocked(t)
+}
+
+func (m *taskManager) wireLocked(t *taskRecord) Task {
+	return Task{
+		TaskID:        t.id,
+		Status:        t.status,
+		StatusMessage: t.message,
+		CreatedAt:     t.created.UTC().Format(time.RFC3339Nano),
+		LastUpdatedAt: t.updated.UTC().Format(time.RFC3339Nano),
+		TTL:           t.ttl.Milliseconds(),
+		PollInterval:  m.cfg.PollInterval.Milliseconds(),
+	}
+}
+
+func newTaskID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// taskPayload is a stored task result, replayed verbatim by tasks/result. It was stamped
+// with its resultType and serverInfo when the task finished, so the router's stamping is
+// a no-op here — which also keeps concurrent tasks/result calls from sharing a mutable
+// result.
+type taskPayload struct {
+	raw json.RawMessage
+}
+
+func (p *taskPayload) setResultType(string)          {}
+func (p *taskPayload) setServerInfo(*Implementation) {}
+
+func (p *taskPayload) MarshalJSON() ([]byte, error) {
+	return p.raw, nil
+}
+
+// tasksCapability is the ServerCapabilities.Extensions entry advertising Tasks: which
+// requests may be task-augmented.
+var tasksCapability = json.RawMessage(`{"requests":{"tools/call":{}}}`)
+
+func (s *Server) parseTaskID(ctx context.Context, params json.RawMessage) (*taskRecord, *transport.RPCError) {
+	if s.tasks == nil {
+		return nil, &transport.RPCError{Code: transport.MethodNotFound, Message: "Method not found"}
+	}
+	var p TaskIDParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, invalidParamsErr("invalid params: %v", err)
+	}
+	t, ok := s.tasks.lookup(p.TaskID, s.config.PrincipalFromContext(ctx))
+	if !ok {
+		return nil, invalidParamsErr("Unknown task: %s", p.TaskID)
+	}
+	return t, nil
+}
+
+func (s *Server) handleTasksGet(ctx context.Context, params json.RawMessage) (Result, *transport.RPCError) {
+	t, rerr := s.parseTaskID(ctx, params)
+	if rerr != nil {
+		return nil, rerr
+	}
+	return &TaskStatusResult{Task: s.tasks.wire(t)}, nil
+}
+
+// handleTasksResult blocks until the task reaches a terminal status, then returns what the
+// tools/call itself would have: its result, or its JSON-RPC error.
+func (s *Server) handleTasksResult(ctx context.Context, params json.RawMessage) (Result, *transport.RPCError) {
+	t, rerr := s.parseTaskID(ctx, params)
+	if rerr != nil {
+		return nil, rerr
+	}
+	select {
+	case <-t.done:
+	case <-t.ctx.Done():
+		// Cancelled or expired; a still-running tool may take a moment to notice, but
+		// the outcome is already decided.
+	case <-ctx.Done():
+		return nil, internalErr(ctx.Err())
+	}
+
+	s.tasks.mu.Lock()
+	status, payload, taskErr := t.status, t.payload, t.rpcErr
+	s.tasks.mu.Unlock()
+	switch {
+	case status == TaskStatusCancelled:
+		return nil, invalidParamsErr("task %s was cancelled", t.id)
+	case taskErr != nil:
+		return nil, taskErr
+	case payload == nil:
+		return nil, invalidParamsErr("task %s expired before completing", t.id)
+	}
+	return &taskPayload{raw: payload}, nil
+}
+
+func (s *Server) handleTasksCancel(ctx context.Context, params json.RawMessage) (Result, *transport.RPCError) {
+	t, rerr := s.parseTaskID(ctx, params)
+	if rerr != nil {
+		return nil, rerr
+	}
+	s.tasks.mu.Lock()
+	if t.status != TaskStatusWorking {
+		status := t.status
+		s.tasks.mu.Unlock()
+		return nil, invalidParamsErr("task %s is already %s", t.id, status)
+	}
+	t.status, t.message, t.updated = TaskStatusCancelled, "cancelled by client", time.Now()
+	t.cancel()
+	wire := s.tasks.wireLocked(t)
+	s.tasks.mu.Unlock()
+	logging.Debug("Task cancelled", "task", t.id)
+	return &TaskStatusResult{Task: wire}, nil
+}
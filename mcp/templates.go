@@ -0,0 +1,262 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/spirilis/generic-go-mcp/transport"
+)
+
+// ResourceTemplate describes a parameterized family of resources, identified by an RFC
+// 6570 URI template (e.g. "file:///logs/{date}") rather than a single URI.
+type ResourceTemplate struct {
+	URITemplate string                 `json:"uriTemplate"`
+	Name        string                 `json:"name"`
+	Title       string                 `json:"title,omitempty"`
+	Description string                 `json:"description,omitempty"`
+	MimeType    string                 `json:"mimeType,omitempty"`
+	Annotations *Annotations           `json:"annotations,omitempty"`
+	Icons       []Icon                 `json:"icons,omitempty"`
+	Meta        map[string]interface{} `json:"_meta,omitempty"`
+}
+
+// ResourceTemplateFunction produces the content of one resource matched by a template.
+// req.Variables holds the values the requested URI supplied for the template's variables;
+// like a ResourceReadFunction, it may return req.NeedInput(...) to ask the client for more.
+type ResourceTemplateFunction func(ctx context.Context, req *ResourceRequest) (ResourceContentResult, error)
+
+type registeredTemplate struct {
+	template ResourceTemplate
+	parsed   *URITemplate
+	fn       ResourceTemplateFunction
+}
+
+// ResourceTemplateRegistry manages available resource templates, safe for concurrent
+// registration and lookup in the same way as ResourceRegistry.
+type ResourceTemplateRegistry struct {
+	mu          sync.RWMutex
+	templates   []registeredTemplate
+	completions completionProviders
+	keys        keyset // positions for resources/templates/list cursors
+	onChange    func()
+	onUpdate    func(uri string)
+}
+
+// NewResourceTemplateRegistry creates a new resource template registry
+func NewResourceTemplateRegistry() *ResourceTemplateRegistry {
+	return &ResourceTemplateRegistry{
+		templates:   make([]registeredTemplate, 0),
+		completions: make(completionProviders),
+	}
+}
+
+// Register adds a resource template to the registry, returning an error if its
+// URITemplate does not parse. Registering a URITemplate that is already present replaces
+// it and moves it to the end of the list, exactly as ResourceRegistry.Register does. If the
+// registry is already attached to a running Server, this fires a
+// notifications/resources/list_changed to any subscribed clients: the spec has no separate
+// notification for templates, which are part of the same resource catalog.
+func (r *ResourceTemplateRegistry) Register(tmpl ResourceTemplate, fn ResourceTemplateFunction) error {
+	parsed, err := ParseURITemplate(tmpl.URITemplate)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.removeLocked(tmpl.URITemplate)
+	r.templates = append(r.templates, registeredTemplate{template: tmpl, parsed: parsed, fn: fn})
+	r.keys.add(tmpl.URITemplate)
+	notify := r.onChange
+	r.mu.Unlock()
+	if notify != nil {
+		notify()
+	}
+	return nil
+}
+
+// Unregister removes the template registered under uriTemplate, reporting whether one was
+// found. Only an actual removal fires notifications/resources/list_changed.
+func (r *ResourceTemplateRegistry) Unregister(uriTemplate string) bool {
+	r.mu.Lock()
+	removed := r.removeLocked(uriTemplate)
+	notify := r.onChange
+	r.mu.Unlock()
+	if removed && notify != nil {
+		notify()
+	}
+	return removed
+}
+
+// removeLocked drops any entry for uriTemplate, reporting whether one existed. Callers
+// must hold r.mu; see ToolRegistry.removeLocked for why it doesn't notify.
+func (r *ResourceTemplateRegistry) removeLocked(uriTemplate string) bool {
+	for i, t := range r.templates {
+		if t.template.URITemplate == uriTemplate {
+			r.templates = append(r.templates[:i], r.templates[i+1:]...)
+			r.keys.remove(uriTemplate)
+			return true
+		}
+	}
+	return false
+}
+
+// listing snapshots the templates for paginating resources/templates/list.
+func (r *ResourceTemplateRegistry) listing() listing[ResourceTemplate] {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	templates := make([]ResourceTemplate, len(r.templates))
+	for i, t := range r.templates {
+		templates[i] = t.template
+	}
+	return newListing(templates, func(t ResourceTemplate) string { return t.URITemplate }, &r.keys)
+}
+
+// List returns all registered templates, in registration order.
+func (r *ResourceTemplateRegistry) List() []ResourceTemplate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]ResourceTemplate, len(r.templates))
+	for i, t := range r.templates {
+		out[i] = t.template
+	}
+	return out
+}
+
+// Get returns the ResourceTemplate registered under uriTemplate.
+func (r *ResourceTemplateRegistry) Get(uriTemplate string) (ResourceTemplate, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, t := range r.templates {
+		if t.template.URITemplate == uriTemplate {
+			return t.template, true
+		}
+	}
+	return ResourceTemplate{}, false
+}
+
+// Match finds the template uri is an expansion of, returning it along with the variables
+// extracted from uri. When several templates match, the earliest registered wins.
+func (r *ResourceTemplateRegistry) Match(uri string) (ResourceTemplate, map[string]string, bool) {
+	t, vars, ok := r.match(uri)
+	return t.template, vars, ok
+}
+
+func (r *ResourceTemplateRegistry) match(uri string) (registeredTemplate, map[string]string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, t := range r.templates {
+		if vars, ok := t.parsed.Match(uri); ok {
+			return t, vars, true
+		}
+	}
+	return registeredTemplate{}, nil, false
+}
+
+// parsed returns the parsed form of the template registered under uriTemplate.
+func (r *ResourceTemplateRegistry) parsed(uriTemplate string) (*URITemplate, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, t := range r.templates {
+		if t.template.URITemplate == uriTemplate {
+			return t.parsed, true
+		}
+	}
+	return nil, false
+}
+
+// NotifyUpdated is ResourceRegistry.NotifyUpdated for templated resources: it announces
+// that the content behind uri changed, to every subscriptions/listen stream watching it.
+// It reports whether uri expands some registered template; announcing one that does not
+// is a no-op that notifies nobody.
+func (r *ResourceTemplateRegistry) NotifyUpdated(uri string) bool {
+	_, _, known := r.match(uri)
+	r.mu.RLock()
+	update := r.onUpdate
+	r.mu.RUnlock()
+	if known && update != nil {
+		update(uri)
+	}
+	return known
+}
+
+// HasTemplates reports whether any template is registered.
+func (r *ResourceTemplateRegistry) HasTemplates() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.templates) > 0
+}
+
+// RegisterCompletion attaches fn as the completion/complete provider for variable of the
+// template registered under uriTemplate, replacing any provider already attached there.
+// As with PromptRegistry.RegisterCompletion, providers survive re-registering the template.
+func (r *ResourceTemplateRegistry) RegisterCompletion(uriTemplate, variable string, fn CompletionFunction) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.completions.set(uriTemplate, variable, fn)
+}
+
+// UnregisterCompletion detaches the completion provider for variable of uriTemplate,
+// reporting whether one was attached.
+func (r *ResourceTemplateRegistry) UnregisterCompletion(uriTemplate, variable string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.completions.remove(uriTemplate, variable)
+}
+
+// HasCompletions reports whether any completion provider is attached.
+func (r *ResourceTemplateRegistry) HasCompletions() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.completions) > 0
+}
+
+func (r *ResourceTemplateRegistry) completion(uriTemplate, variable string) CompletionFunction {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.completions.get(uriTemplate, variable)
+}
+
+// errTemplateNotFound is returned by read when no registered template matches the URI —
+// including one that was unregistered between the handler's lookup and the read itself.
+var errTemplateNotFound = errors.New("no resource template matches")
+
+// read matches req.URI against the registered templates and runs the winning template's
+// function, filling in req.Variables. The matched template is returned so the caller can
+// fill in the result's metadata.
+func (r *ResourceTemplateRegistry) read(ctx context.Context, req *ResourceRequest) (ResourceTemplate, ResourceContentResult, error) {
+	t, vars, ok := r.match(req.URI)
+	if !ok {
+		return ResourceTemplate{}, ResourceContentResult{}, errTemplateNotFound
+	}
+	req.Variables = vars
+	content, err := t.fn(ctx, req)
+	return t.template, content, err
+}
+
+// ResourcesTemplatesListResult is the result of resources/templates/list.
+type ResourcesTemplatesListResult struct {
+	CacheableResult
+	ResourceTemplates []ResourceTemplate `json:"resourceTemplates"`
+	NextCursor        string             `json:"nextCursor,omitempty"`
+}
+
+func (s *Server) handleResourcesTemplatesList(ctx context.Context, params json.RawMessage) (Result, *transport.RPCError) {
+	var p struct {
+		Cursor string `json:"cursor"`
+	}
+	if len(params) > 0 {
+		_ = json.Unmarshal(params, &p)
+	}
+
+	page, next, err := paginate(s, "resources/templates/list", s.templateRegistry.listing(), p.Cursor)
+	if err != nil {
+		return nil, invalidParamsErr("invalid cursor")
+	}
+
+	return &ResourcesTemplatesListResult{
+		CacheableResult:   NewCacheableResult(s.listTTLMs, s.cacheScope()),
+		ResourceTemplates: page,
+		NextCursor:        next,
+	}, nil
+}
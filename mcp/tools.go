@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
 	"sync"
 
+	"github.com/spirilis/generic-go-mcp/logging"
 	"github.com/spirilis/generic-go-mcp/transport"
 )
 
@@ -52,8 +54,33 @@ type ToolRequest struct {
 	InputResponses     InputResponses
 	RequestState       string
 
-	ctx    context.Context
-	server *Server
+	ctx      context.Context
+	server   *Server
+	progress *progressReporter
+	logger   *slog.Logger
+}
+
+// Logger returns a logger scoped to this call. Its records go to stderr through the global
+// logging handler like any other, tagged with the tool's name; those at or above the
+// level the client asked for in io.modelcontextprotocol/logLevel are also sent to the
+// client as notifications/message on this call's response stream. A client that asked for
+// no level gets none. Attributes are redacted through ServerConfig.LogRedactor first.
+func (r *ToolRequest) Logger() *slog.Logger {
+	if r.logger == nil {
+		return slog.New(logging.Handler())
+	}
+	return r.logger
+}
+
+// ReportProgress sends a notifications/progress for this call, tagged with the progress
+// token the client put in _meta — upgrading a Streamable HTTP response to SSE on the first
+// one. total is 0 when unknown, and message is optional. It does nothing when the client
+// sent no token, and it silently drops a report that doesn't increase progress or that
+// arrives within ServerConfig.ProgressInterval of the previous one, except one reaching
+// total. Reports made after the tool has returned are dropped too, so it is safe to call
+// from a goroutine that may outlive the call.
+func (r *ToolRequest) ReportProgress(progress, total float64, message string) error {
+	return r.progress.report(progress, total, message)
 }
 
 // BindArguments unmarshals the call's raw arguments into v.
@@ -92,14 +119,14 @@ func (r *ToolRequest) NeedInput(reqs InputRequests) (Result, error) {
 		return nil, &MissingCapabilityError{Capabilities: missing}
 	}
 	principal := r.server.config.PrincipalFromContext(r.ctx)
-	state := r.server.signRequestState(principal, r.Name, r.Arguments)
+	state := r.server.signRequestState(principal, "tools/call", r.Name, r.Arguments)
 	return newInputRequiredResult(reqs, state), nil
 }
 
 // ToolFunction is the implementation of a tool. A non-nil error is a protocol-level
-// failure (mapped to JSON-RPC -32603): tool execution errors that the model should see
-// and can potentially recover from belong in a returned ToolCallResult with IsError set
-// (see ErrorResultf), not in the error return.
+// failure (mapped to JSON-RPC -32603, or sent as-is if it is a *transport.RPCError): tool
+// execution errors that the model should see and can potentially recover from belong in a
+// returned ToolCallResult with IsError set (see ErrorResultf), not in the error return.
 type ToolFunction func(ctx context.Context, req *ToolRequest) (Result, error)
 
 // ToolCallResult is the result of a completed tools/call.
@@ -124,27 +151,97 @@ type ToolRegistry struct {
 	mu        sync.RWMutex
 	tools     []Tool
 	functions map[string]ToolFunction
+	schemas   map[string]toolSchemas // compiled InputSchema/OutputSchema, keyed by name
+	forwarded map[string]bool        // names registered with RegisterForwarded
+	keys      keyset                 // positions for tools/list cursors
+	middle    []ToolMiddleware
 	onChange  func()
 }
 
+// toolSchemas holds a tool's schemas compiled for validation. A nil schema validates
+// nothing.
+type toolSchemas struct {
+	input  *compiledSchema
+	output *compiledSchema
+}
+
+// compileToolSchemas compiles tool's InputSchema and OutputSchema.
+func compileToolSchemas(tool Tool) (toolSchemas, error) {
+	var ts toolSchemas
+	var err error
+	if ts.input, err = compileSchema(tool.InputSchema); err != nil {
+		return toolSchemas{}, fmt.Errorf("inputSchema: %w", err)
+	}
+	if ts.output, err = compileSchema(tool.OutputSchema); err != nil {
+		return toolSchemas{}, fmt.Errorf("outputSchema: %w", err)
+	}
+	return ts, nil
+}
+
 // NewToolRegistry creates a new tool registry
 func NewToolRegistry() *ToolRegistry {
 	return &ToolRegistry{
 		tools:     make([]Tool, 0),
 		functions: make(map[string]ToolFunction),
+		schemas:   make(map[string]toolSchemas),
+		forwarded: make(map[string]bool),
 	}
 }
 
+// Use appends mw to the interceptors wrapped around every tool's function, including
+// tools registered before the call; the first one added is outermost. See ToolMiddleware.
+func (r *ToolRegistry) Use(mw ...ToolMiddleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.middle = append(r.middle, mw...)
+}
+
 // Register adds a tool to the registry. Registering a name that is already present
 // replaces it and moves it to the end of the list, rather than adding a second entry — the
 // list and the name-keyed function map must not be allowed to disagree. If the registry is
 // already attached to a running Server, this fires a notifications/tools/list_changed to
 // any subscribed clients.
+//
+// The tool's InputSchema and OutputSchema are compiled here, once, and every tools/call
+// is validated against them: arguments before the ToolFunction runs, structuredContent
+// after. A keyword that fails to compile (malformed, or one the built-in validator does
+// not support, such as a pattern RE2 cannot express) is logged and left out, and the rest
+// of the schema is still enforced; a schema that is not JSON at all rejects every call.
+// RegisterTyped reports the same failures as an error instead.
 func (r *ToolRegistry) Register(tool Tool, fn ToolFunction) {
+	r.register(tool, fn, false)
+}
+
+// RegisterForwarded is Register for a tool implemented by another MCP server, which fn
+// forwards each call to. The MRTR round trip is the upstream server's: an incoming
+// requestState is not verified here but handed to fn verbatim in req.RequestState (with
+// req.InputResponses), and fn returns the upstream's input_required as-is with
+// NewInputRequiredResult. An upstream JSON-RPC error returned by fn as a
+// *transport.RPCError reaches the client unchanged.
+func (r *ToolRegistry) RegisterForwarded(tool Tool, fn ToolFunction) {
+	r.register(tool, fn, true)
+}
+
+func (r *ToolRegistry) register(tool Tool, fn ToolFunction, forwarded bool) {
+	var schemas toolSchemas
+	var inDropped, outDropped []error
+	schemas.input, inDropped = compileSchemaLenient(tool.InputSchema)
+	schemas.output, outDropped = compileSchemaLenient(tool.OutputSchema)
+	for _, err := range inDropped {
+		logging.Warn("Tool schema keyword not enforced", "tool", tool.Name, "schema", "inputSchema", "error", err)
+	}
+	for _, err := range outDropped {
+		logging.Warn("Tool schema keyword not enforced", "tool", tool.Name, "schema", "outputSchema", "error", err)
+	}
 	r.mu.Lock()
 	r.removeLocked(tool.Name)
 	r.tools = append(r.tools, tool)
 	r.functions[tool.Name] = fn
+	r.schemas[tool.Name] = schemas
+	r.keys.add(tool.Name)
+	if forwarded {
+		r.forwarded[tool.Name] = true
+	}
 	notify := r.onChange
 	r.mu.Unlock()
 	if notify != nil {
@@ -156,10 +253,6 @@ func (r *ToolRegistry) Register(tool Tool, fn ToolFunction) {
 // the registry is attached to a running Server and something was actually removed, this
 // fires a notifications/tools/list_changed to any subscribed clients; unregistering an
 // absent name is a no-op and notifies nobody.
-//
-// Note for paginating clients: tools/list cursors are opaque offsets, so a removal between
-// two page fetches shifts later entries and can cause one to be skipped. That is what
-// list_changed is for — a client that sees it should restart pagination.
 func (r *ToolRegistry) Unregister(name string) bool {
 	r.mu.Lock()
 	removed := r.removeLocked(name)
@@ -179,6 +272,9 @@ func (r *ToolRegistry) removeLocked(name string) bool {
 		return false
 	}
 	delete(r.functions, name)
+	delete(r.schemas, name)
+	delete(r.forwarded, name)
+	r.keys.remove(name)
 	for i, t := range r.tools {
 		if t.Name == name {
 			r.tools = append(r.tools[:i], r.tools[i+1:]...)
@@ -188,6 +284,13 @@ func (r *ToolRegistry) removeLocked(name string) bool {
 	return true
 }
 
+// isForwarded reports whether name was registered with RegisterForwarded.
+func (r *ToolRegistry) isForwarded(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.forwarded[name]
+}
+
 // List returns all registered tools, in registration order (a stable, deterministic
 // order across calls when the underlying set hasn't changed, as recommended for
 // client-side caching and LLM prompt cache hit rates).
@@ -199,6 +302,13 @@ func (r *ToolRegistry) List() []Tool {
 	return out
 }
 
+// listing snapshots the tools for paginating tools/list.
+func (r *ToolRegistry) listing() listing[Tool] {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return newListing(r.tools, func(t Tool) string { return t.Name }, &r.keys)
+}
+
 // Get returns the Tool definition for name.
 func (r *ToolRegistry) Get(name string) (Tool, bool) {
 	r.mu.RLock()
@@ -222,14 +332,68 @@ func (r *ToolRegistry) HasTools() bool {
 // Get and the call itself — now possible, since Unregister can land in that window.
 var errToolNotFound = errors.New("tool not found")
 
+// call validates req's arguments against the tool's InputSchema, returning a
+// *ValidationError if they don't conform, then runs the tool and checks its
+// structuredContent against the OutputSchema. The registry's ToolMiddleware runs in
+// between, around the tool itself.
 func (r *ToolRegistry) call(ctx context.Context, req *ToolRequest) (Result, error) {
 	r.mu.RLock()
 	fn, ok := r.functions[req.Name]
+	schemas := r.schemas[req.Name]
+	middle := r.middle
 	r.mu.RUnlock()
 	if !ok {
 		return nil, errToolNotFound
 	}
-	return fn(ctx, req)
+
+	if schemas.input != nil {
+		args := req.Arguments
+		if len(args) == 0 {
+			args = json.RawMessage("{}")
+		}
+		instance, err := decodeJSONValue(args)
+		if err != nil {
+			return nil, &ValidationError{Message: "arguments are not valid JSON"}
+		}
+		if verr := schemas.input.validate(instance); verr != nil {
+			return nil, verr
+		}
+	}
+
+	result, err := chainToolMiddleware(fn, middle)(ctx, req)
+	if err != nil || schemas.output == nil {
+		return result, err
+	}
+	return checkStructuredContent(req.Name, result, schemas.output), nil
+}
+
+// checkStructuredContent replaces a successful result whose structuredContent does not
+// conform to the tool's OutputSchema with a tool execution error: the spec requires
+// conforming structured output, and a non-conforming one is the tool's bug, not the
+// caller's. Anything other than a successful ToolCallResult (an isError result, an MRTR
+// round trip) passes through untouched.
+func checkStructuredContent(name string, result Result, schema *compiledSchema) Result {
+	tcr, ok := result.(*ToolCallResult)
+	if !ok || tcr.IsError {
+		return result
+	}
+	if tcr.StructuredContent == nil {
+		logging.Warn("Tool returned no structuredContent despite declaring an outputSchema", "tool", name)
+		return ErrorResultf("tool %s returned no structuredContent, but declares an outputSchema", name)
+	}
+	raw, err := json.Marshal(tcr.StructuredContent)
+	var instance interface{}
+	if err == nil {
+		instance, err = decodeJSONValue(raw)
+	}
+	if err != nil {
+		return ErrorResultf("tool %s returned structuredContent that cannot be encoded: %v", name, err)
+	}
+	if verr := schema.validate(instance); verr != nil {
+		logging.Warn("Tool structuredContent does not match its outputSchema", "tool", name, "error", verr)
+		return ErrorResultf("tool %s returned structuredContent that does not match its outputSchema: %v", name, verr)
+	}
+	return result
 }
 
 // ToolsListResult is the result of tools/list.
@@ -247,8 +411,7 @@ func (s *Server) handleToolsList(ctx context.Context, params json.RawMessage) (R
 		_ = json.Unmarshal(params, &p)
 	}
 
-	all := s.registry.List()
-	page, next, err := paginate(all, p.Cursor, defaultPageSize)
+	page, next, err := paginate(s, "tools/list", s.toolListing(ctx), p.Cursor)
 	if err != nil {
 		return nil, invalidParamsErr("invalid cursor")
 	}
@@ -267,16 +430,17 @@ type ToolsCallParams struct {
 	Arguments      json.RawMessage `json:"arguments"`
 	InputResponses InputResponses  `json:"inputResponses,omitempty"`
 	RequestState   string          `json:"requestState,omitempty"`
+	Task           *TaskParams     `json:"task,omitempty"`
 }
 
-func (s *Server) handleToolsCall(ctx context.Context, meta *RequestMeta, params json.RawMessage) (Result, *transport.RPCError) {
+func (s *Server) handleToolsCall(ctx context.Context, meta *RequestMeta, params json.RawMessage, w transport.ResponseWriter) (Result, *transport.RPCError) {
 	var p ToolsCallParams
 	if err := json.Unmarshal(params, &p); err != nil {
 		return nil, invalidParamsErr("invalid tools/call params: %v", err)
 	}
 
 	tool, ok := s.registry.Get(p.Name)
-	if !ok {
+	if !ok || !s.toolVisible(ctx, tool) {
 		return nil, invalidParamsErr("Unknown tool: %s", p.Name)
 	}
 
@@ -284,9 +448,9 @@ func (s *Server) handleToolsCall(ctx context.Context, meta *RequestMeta, params
 		return nil, rerr
 	}
 
-	if p.RequestState != "" {
+	if p.RequestState != "" && !s.registry.isForwarded(p.Name) {
 		principal := s.config.PrincipalFromContext(ctx)
-		if err := s.verifyRequestState(p.RequestState, principal, p.Name, p.Arguments); err != nil {
+		if err := s.verifyRequestState(p.RequestState, principal, "tools/call", p.Name, p.Arguments); err != nil {
 			return nil, invalidParamsErr("invalid requestState: %v", err)
 		}
 	}
@@ -301,16 +465,47 @@ func (s *Server) handleToolsCall(ctx context.Context, meta *RequestMeta, params
 		ctx:                ctx,
 		server:             s,
 	}
+	if p.Task != nil && s.tasks != nil {
+		// The task outlives this request's response stream, so it has no notifier: its
+		// progress reports and client-bound log messages are dropped.
+		req.logger = newRequestLogger(nil, p.Name, "", s.config.LogRedactor)
+		created, err := s.tasks.start(ctx, s.config.PrincipalFromContext(ctx), p.Task, func(taskCtx context.Context) (Result, *transport.RPCError) {
+			req.ctx = taskCtx
+			return s.callTool(taskCtx, req)
+		})
+		if err != nil {
+			return nil, internalErr(err)
+		}
+		return created, nil
+	}
+
+	notifier := newRequestNotifier(w)
+	defer notifier.close()
+	req.progress = newProgressReporter(notifier, meta.ProgressToken, s.config.ProgressInterval)
+	req.logger = newRequestLogger(notifier, p.Name, meta.LogLevel, s.config.LogRedactor)
+	return s.callTool(ctx, req)
+}
 
+// callTool runs req through the registry, mapping a ToolFunction's error to the JSON-RPC
+// error tools/call answers with.
+func (s *Server) callTool(ctx context.Context, req *ToolRequest) (Result, *transport.RPCError) {
 	result, err := s.registry.call(ctx, req)
 	if err != nil {
 		if mc, ok := err.(*MissingCapabilityError); ok {
 			return nil, missingClientCapabilityErr(mc.Capabilities...)
 		}
+		var verr *ValidationError
+		if errors.As(err, &verr) {
+			return nil, invalidArgumentsErr(verr)
+		}
+		var rpcErr *transport.RPCError
+		if errors.As(err, &rpcErr) {
+			return nil, rpcErr
+		}
 		if errors.Is(err, errToolNotFound) {
-			// Unregistered concurrently, after the lookup above succeeded. Report it the
-			// same way as a name that was never registered.
-			return nil, invalidParamsErr("Unknown tool: %s", p.Name)
+			// Unregistered concurrently, after the lookup in handleToolsCall succeeded.
+			// Report it the same way as a name that was never registered.
+			return nil, invalidParamsErr("Unknown tool: %s", req.Name)
 		}
 		return nil, internalErr(err)
 	}
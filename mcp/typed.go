@@ -0,0 +1,117 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// TypedToolFunction is the implementation of a tool registered with RegisterTyped: it
+// receives the call's arguments already decoded into In and returns its structured output
+// as Out. As with ToolFunction, a non-nil error is a protocol-level failure (-32603); to
+// return a tool execution error or an MRTR round trip instead, wrap that Result with
+// ReturnResult.
+type TypedToolFunction[In, Out any] func(ctx context.Context, req *ToolRequest, in In) (Out, error)
+
+// RegisterTyped registers a tool whose arguments and structured output are Go types. Any
+// InputSchema or OutputSchema left empty on tool is generated from In or Out by
+// GenerateSchema, so the advertised schemas cannot drift from the structs the tool
+// actually decodes and returns; both In and Out must therefore be structs or maps (the
+// spec requires object schemas for both).
+//
+// The registered ToolFunction decodes the call's arguments into In, reporting a decode
+// failure as an isError result the model can correct, and returns Out as both
+// structuredContent and a text block: Out's String method if it has one, its JSON
+// serialization otherwise. It returns an error, and registers nothing, if a schema cannot
+// be generated, cannot be compiled for validation, or places x-mcp-header somewhere the
+// spec does not allow.
+func RegisterTyped[In, Out any](r *ToolRegistry, tool Tool, fn TypedToolFunction[In, Out]) error {
+	if len(tool.InputSchema) == 0 {
+		schema, err := typedObjectSchema[In]("input")
+		if err != nil {
+			return fmt.Errorf("tool %s: %w", tool.Name, err)
+		}
+		tool.InputSchema = schema
+	}
+	if len(tool.OutputSchema) == 0 {
+		schema, err := typedObjectSchema[Out]("output")
+		if err != nil {
+			return fmt.Errorf("tool %s: %w", tool.Name, err)
+		}
+		tool.OutputSchema = schema
+	}
+	if _, rerr := extractXMCPHeaderBindings(tool.InputSchema); rerr != nil {
+		return fmt.Errorf("tool %s: %s", tool.Name, rerr.Message)
+	}
+	if _, err := compileToolSchemas(tool); err != nil {
+		return fmt.Errorf("tool %s: %w", tool.Name, err)
+	}
+
+	r.Register(tool, func(ctx context.Context, req *ToolRequest) (Result, error) {
+		var in In
+		if err := req.BindArguments(&in); err != nil {
+			return ErrorResultf("invalid arguments: %v", err), nil
+		}
+		out, err := fn(ctx, req, in)
+		if err != nil {
+			var rr *resultReturn
+			if errors.As(err, &rr) {
+				return rr.result, nil
+			}
+			return nil, err
+		}
+		return typedToolResult(out)
+	})
+	return nil
+}
+
+// typedObjectSchema generates T's schema, refusing any T whose JSON form isn't an object.
+func typedObjectSchema[T any](role string) (json.RawMessage, error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct && t.Kind() != reflect.Map {
+		return nil, fmt.Errorf("%s type %s must be a struct or map", role, t)
+	}
+	return GenerateSchema[T]()
+}
+
+func typedToolResult(out interface{}) (Result, error) {
+	var text string
+	if s, ok := out.(fmt.Stringer); ok {
+		text = s.String()
+	} else {
+		raw, err := json.Marshal(out)
+		if err != nil {
+			return nil, err
+		}
+		text = string(raw)
+	}
+	return &ToolCallResult{Content: []Content{Text(text)}, StructuredContent: out}, nil
+}
+
+// resultReturn carries a Result out through a TypedToolFunction's error return.
+type resultReturn struct {
+	result Result
+}
+
+func (r *resultReturn) Error() string {
+	return "tool returned a result in place of its output"
+}
+
+// ReturnResult lets a TypedToolFunction return res in place of its Out: an ErrorResultf
+// tool execution error, or the InputRequiredResult from req.NeedInput. It takes NeedInput's
+// two return values directly, passing a non-nil err (a *MissingCapabilityError) through
+// unchanged:
+//
+//	return Out{}, mcp.ReturnResult(req.NeedInput(reqs))
+//	return Out{}, mcp.ReturnResult(mcp.ErrorResultf("cancelled by user"), nil)
+func ReturnResult(res Result, err error) error {
+	if err != nil {
+		return err
+	}
+	return &resultReturn{result: res}
+}
@@ -0,0 +1,241 @@
+package mcp
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// URITemplate is a parsed RFC 6570 URI template, used in reverse: rather than expanding
+// variables into a URI, Match recovers the variables from a URI a client asked to read.
+//
+// Every level 1–3 expression is supported: simple ({var}), reserved ({+var}), fragment
+// ({#var}), label ({.var}), path segment ({/var}), path-style parameter ({;var}), form
+// query ({?var}) and query continuation ({&var}), each with any number of comma-separated
+// variables. The level 4 modifiers (prefix {var:3} and explode {var*}) are accepted, but
+// every variable is still matched as a single string value — there is no list or map
+// decomposition.
+type URITemplate struct {
+	raw   string
+	re    *regexp.Regexp
+	exprs []uriTemplateExpr
+}
+
+type uriTemplateExpr struct {
+	op   byte // 0 for a simple expression
+	vars []uriTemplateVar
+}
+
+type uriTemplateVar struct {
+	name      string
+	maxLength int // prefix modifier; 0 if absent
+}
+
+// Character classes a single expanded value may contain, per operator. Simple and label/
+// path/parameter expansions percent-encode everything outside the unreserved set, so a
+// value is unreserved characters and %XX escapes; reserved and fragment expansion also pass
+// reserved characters through. Reserved expansion stops short of '?' and '#' so a template
+// like "{+path}{?q}" still splits the query off the path.
+const (
+	uriUnreservedClass = `A-Za-z0-9\-._~%`
+	uriReservedClass   = uriUnreservedClass + `!$&'()*+,;=:@/\[\]`
+)
+
+// uriTemplateVarName is the RFC 6570 varname production: varchars, optionally
+// dot-separated.
+var uriTemplateVarName = regexp.MustCompile(`^(?:[A-Za-z0-9_]|%[0-9A-Fa-f]{2})+(?:\.(?:[A-Za-z0-9_]|%[0-9A-Fa-f]{2})+)*$`)
+
+// ParseURITemplate parses s as an RFC 6570 URI template.
+func ParseURITemplate(s string) (*URITemplate, error) {
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	var exprs []uriTemplateExpr
+
+	rest := s
+	for rest != "" {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			if strings.IndexByte(rest, '}') >= 0 {
+				return nil, fmt.Errorf("uri template %q: unmatched '}'", s)
+			}
+			pattern.WriteString(regexp.QuoteMeta(rest))
+			break
+		}
+		if strings.IndexByte(rest[:open], '}') >= 0 {
+			return nil, fmt.Errorf("uri template %q: unmatched '}'", s)
+		}
+		pattern.WriteString(regexp.QuoteMeta(rest[:open]))
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("uri template %q: unterminated expression", s)
+		}
+		expr, err := parseURITemplateExpr(rest[open+1 : open+end])
+		if err != nil {
+			return nil, fmt.Errorf("uri template %q: %w", s, err)
+		}
+		pattern.WriteString("(" + expr.pattern() + ")")
+		exprs = append(exprs, expr)
+		rest = rest[open+end+1:]
+	}
+	pattern.WriteString("$")
+
+	re, err := regexp.Compile(pattern.String())
+	if err != nil {
+		return nil, fmt.Errorf("uri template %q: %w", s, err)
+	}
+	return &URITemplate{raw: s, re: re, exprs: exprs}, nil
+}
+
+func parseURITemplateExpr(body string) (uriTemplateExpr, error) {
+	var expr uriTemplateExpr
+	if body == "" {
+		return expr, fmt.Errorf("empty expression")
+	}
+	switch body[0] {
+	case '+', '#', '.', '/', ';', '?', '&':
+		expr.op = body[0]
+		body = body[1:]
+	case '=', ',', '!', '@', '|':
+		return expr, fmt.Errorf("reserved operator %q", body[0])
+	}
+	for _, spec := range strings.Split(body, ",") {
+		v := uriTemplateVar{name: strings.TrimSuffix(spec, "*")}
+		if i := strings.IndexByte(v.name, ':'); i >= 0 {
+			n, err := strconv.Atoi(v.name[i+1:])
+			if err != nil || n <= 0 || n >= 10000 {
+				return expr, fmt.Errorf("invalid prefix modifier in %q", spec)
+			}
+			v.name, v.maxLength = v.name[:i], n
+		}
+		if !uriTemplateVarName.MatchString(v.name) {
+			return expr, fmt.Errorf("invalid variable name %q", v.name)
+		}
+		expr.vars = append(expr.vars, v)
+	}
+	return expr, nil
+}
+
+// pattern is the regular expression an expansion of this expression can produce,
+// including its operator's leading character. Every variable may be undefined, so each
+// pattern also matches the empty string.
+func (e uriTemplateExpr) pattern() string {
+	const u, r = uriUnreservedClass, uriReservedClass
+	switch e.op {
+	case '+':
+		return "[" + r + "]*"
+	case '#':
+		return "(?:#[" + r + "?#]*)?"
+	case '.':
+		return `(?:\.[A-Za-z0-9\-_~%]*)*`
+	case '/':
+		return "(?:/[" + u + "]*)*"
+	case ';':
+		return "(?:;[" + u + "]+(?:=[" + u + ",]*)?)*"
+	case '?':
+		return `(?:\?[` + u + `=,]*(?:&[` + u + `=,]*)*)?`
+	case '&':
+		return "(?:&[" + u + "=,]*)*"
+	default:
+		return "[" + u + ",]*"
+	}
+}
+
+// String returns the template as originally written.
+func (t *URITemplate) String() string {
+	return t.raw
+}
+
+// Match reports whether uri is an expansion of t, returning the value of every variable
+// it defines. Variables the expansion left undefined are absent from the map, not set to
+// "". Values are percent-decoded.
+func (t *URITemplate) Match(uri string) (map[string]string, bool) {
+	m := t.re.FindStringSubmatch(uri)
+	if m == nil {
+		return nil, false
+	}
+	vars := make(map[string]string)
+	for i, expr := range t.exprs {
+		if !expr.extract(m[i+1], vars) {
+			return nil, false
+		}
+	}
+	return vars, true
+}
+
+// extract decodes one expression's matched text into vars, reporting false if the text
+// cannot be an expansion of this expression after all (e.g. a query parameter the
+// template never declared, or a value longer than its prefix modifier allows).
+func (e uriTemplateExpr) extract(text string, vars map[string]string) bool {
+	if text == "" {
+		return true
+	}
+	switch e.op {
+	case ';', '?', '&':
+		sep := "&"
+		if e.op == ';' {
+			sep = ";"
+		}
+		for _, pair := range strings.Split(text[1:], sep) {
+			name, value, _ := strings.Cut(pair, "=")
+			v, ok := e.lookup(name)
+			if !ok {
+				return false
+			}
+			if !setURITemplateVar(vars, v, value) {
+				return false
+			}
+		}
+		return true
+	}
+
+	var values []string
+	switch e.op {
+	case '#', '.', '/':
+		sep := ","
+		if e.op != '#' {
+			sep = string(e.op)
+		}
+		values = strings.Split(text[1:], sep)
+	default:
+		values = strings.Split(text, ",")
+	}
+	if len(values) > len(e.vars) {
+		// More values than variables: only a comma inside a single reserved-expansion value
+		// can explain it, so fold the overflow back into the last variable.
+		if e.op != '+' && e.op != '#' {
+			return false
+		}
+		last := len(e.vars) - 1
+		values[last] = strings.Join(values[last:], ",")
+		values = values[:last+1]
+	}
+	for i, value := range values {
+		if !setURITemplateVar(vars, e.vars[i], value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e uriTemplateExpr) lookup(name string) (uriTemplateVar, bool) {
+	for _, v := range e.vars {
+		if v.name == name {
+			return v, true
+		}
+	}
+	return uriTemplateVar{}, false
+}
+
+func setURITemplateVar(vars map[string]string, v uriTemplateVar, raw string) bool {
+	value, err := url.PathUnescape(raw)
+	if err != nil {
+		return false
+	}
+	if v.maxLength > 0 && len([]rune(value)) > v.maxLength {
+		return false
+	}
+	vars[v.name] = value
+	return true
+}
@@ -0,0 +1,54 @@
+package mcp
+
+import "context"
+
+// filtering reports whether the catalog varies by caller, in which case every cacheable
+// result is marked private.
+func (s *Server) filtering() bool {
+	return s.config.ToolVisible != nil || s.config.ResourceVisible != nil
+}
+
+// toolVisible reports whether the caller behind ctx may see tool.
+func (s *Server) toolVisible(ctx context.Context, tool Tool) bool {
+	return s.config.ToolVisible == nil || s.config.ToolVisible(ctx, s.config.PrincipalFromContext(ctx), tool)
+}
+
+// resourceVisible reports whether the caller behind ctx may see res.
+func (s *Server) resourceVisible(ctx context.Context, res Resource) bool {
+	return s.config.ResourceVisible == nil || s.config.ResourceVisible(ctx, s.config.PrincipalFromContext(ctx), res)
+}
+
+// toolListing returns the tools the caller behind ctx may see, in registration order.
+func (s *Server) toolListing(ctx context.Context) listing[Tool] {
+	l := s.registry.listing()
+	if s.config.ToolVisible == nil {
+		return l
+	}
+	return l.filter(func(tool Tool) bool { return s.toolVisible(ctx, tool) })
+}
+
+// resourceListing returns the resources the caller behind ctx may see, in registration
+// order.
+func (s *Server) resourceListing(ctx context.Context) listing[Resource] {
+	l := s.resourceRegistry.listing()
+	if s.config.ResourceVisible == nil {
+		return l
+	}
+	return l.filter(func(res Resource) bool { return s.resourceVisible(ctx, res) })
+}
+
+// visibleSubscriptions drops from uris every registered resource the caller behind ctx
+// may not see, so subscribing to one yields no resources/updated. URIs not registered as
+// static resources (templated ones, or ones that don't exist yet) are kept.
+func (s *Server) visibleSubscriptions(ctx context.Context, uris []string) []string {
+	if s.config.ResourceVisible == nil {
+		return uris
+	}
+	var visible []string
+	for _, uri := range uris {
+		if res, ok := s.resourceRegistry.Get(uri); !ok || s.resourceVisible(ctx, res) {
+			visible = append(visible, uri)
+		}
+	}
+	return visible
+}
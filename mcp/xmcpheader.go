@@ -3,6 +3,7 @@ package mcp
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"strconv"
 	"strings"
 
@@ -155,3 +156,50 @@ func validateToolHeaders(ctx context.Context, tool Tool, arguments json.RawMessa
 	}
 	return nil
 }
+
+// ParamHeaders computes the Mcp-Param-* headers a Streamable HTTP client must send with a
+// tools/call of tool with arguments: one per x-mcp-header-annotated argument present in
+// arguments, its value converted per the spec (string as-is, integer in decimal, boolean
+// as true/false) and encoded with transport.EncodeHeaderValue. It is the client-side
+// counterpart of the validation tools/call performs.
+func ParamHeaders(tool Tool, arguments json.RawMessage) (map[string]string, error) {
+	bindings, rerr := extractXMCPHeaderBindings(tool.InputSchema)
+	if rerr != nil {
+		return nil, rerr
+	}
+	if len(bindings) == 0 {
+		return nil, nil
+	}
+	var args map[string]json.RawMessage
+	if len(arguments) > 0 {
+		if err := json.Unmarshal(arguments, &args); err != nil {
+			return nil, err
+		}
+	}
+	headers := make(map[string]string, len(bindings))
+	for _, b := range bindings {
+		raw, ok := lookupArgPath(args, b.path)
+		if !ok {
+			continue
+		}
+		var v interface{}
+		dec := json.NewDecoder(strings.NewReader(string(raw)))
+		dec.UseNumber()
+		if err := dec.Decode(&v); err != nil {
+			return nil, err
+		}
+		var s string
+		switch v := v.(type) {
+		case string:
+			s = v
+		case bool:
+			s = strconv.FormatBool(v)
+		case json.Number:
+			s = v.String()
+		default:
+			return nil, fmt.Errorf("argument %s is not a string, integer or boolean and cannot be sent as header %s", strings.Join(b.path, "."), b.header)
+		}
+		headers[b.header] = transport.EncodeHeaderValue(s)
+	}
+	return headers, nil
+}
@@ -0,0 +1,542 @@
+// Package mcpclient is a client for MCP servers speaking the 2026-07-28 protocol, over
+// stdio (a spawned subprocess), a UNIX domain socket, or Streamable HTTP.
+//
+// The protocol is stateless, so there is no handshake: every request carries the
+// protocolVersion, clientInfo and clientCapabilities _meta fields, which the Client fills
+// in from its Options. Multi Round-Trip Requests (an input_required result) are driven to
+// completion through Options.Elicit, and subscriptions/listen is exposed as a channel.
+package mcpclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/spirilis/generic-go-mcp/mcp"
+	"github.com/spirilis/generic-go-mcp/transport"
+)
+
+// Reserved io.modelcontextprotocol/* _meta keys the client sends or reads.
+const (
+	metaKeyProtocolVersion    = "io.modelcontextprotocol/protocolVersion"
+	metaKeyClientInfo         = "io.modelcontextprotocol/clientInfo"
+	metaKeyClientCapabilities = "io.modelcontextprotocol/clientCapabilities"
+	metaKeyLogLevel           = "io.modelcontextprotocol/logLevel"
+	metaKeySubscriptionID     = "io.modelcontextprotocol/subscriptionId"
+	metaKeyProgressToken      = "progressToken"
+)
+
+// defaultMaxInputRounds bounds how many input_required results one call answers before
+// giving up, unless Options.MaxInputRounds says otherwise.
+const defaultMaxInputRounds = 10
+
+// ElicitFunc answers an elicitation/create input request from the server, typically by
+// asking the user. Return an ElicitResult with Action "decline" or "cancel" rather than an
+// error when the user refuses; an error aborts the whole call.
+type ElicitFunc func(ctx context.Context, params mcp.ElicitRequestParams) (mcp.ElicitResult, error)
+
+// Notification is a server-to-client notification: one delivered on a Listen channel, or
+// passed to Options.OnNotification.
+type Notification struct {
+	Method string
+	Params json.RawMessage
+}
+
+// Options configures a Client. Every field is optional.
+type Options struct {
+	// ClientInfo is sent as io.modelcontextprotocol/clientInfo on every request. Defaults
+	// to "generic-go-mcp-client" 0.1.0.
+	ClientInfo mcp.Implementation
+
+	// Capabilities is sent as io.modelcontextprotocol/clientCapabilities on every request.
+	// Elicitation is declared automatically when Elicit is set.
+	Capabilities mcp.ClientCapabilities
+
+	// Elicit answers elicitation/create input requests when a call comes back
+	// input_required. Without it, such a call fails with ErrInputRequired.
+	Elicit ElicitFunc
+
+	// MaxInputRounds bounds how many input_required results a single call answers before
+	// failing. Defaults to 10.
+	MaxInputRounds int
+
+	// LogLevel, if set, is sent as io.modelcontextprotocol/logLevel, asking the server for
+	// notifications/message at or above it.
+	LogLevel string
+
+	// OnNotification receives every notification that doesn't belong to a Listen stream:
+	// progress (a progressToken is sent with every tools/call when this is set) and log
+	// messages. It is called from the goroutine reading the connection, so it must not
+	// block.
+	OnNotification func(Notification)
+
+	// HTTPClient is used by NewHTTPClient. Defaults to a client of the package's own, on a
+	// clone of http.DefaultTransport, whose idle connections Close closes; Close leaves a
+	// client passed here alone.
+	HTTPClient *http.Client
+
+	// Header is added to every Streamable HTTP request, e.g. an Authorization header.
+	Header http.Header
+}
+
+// ErrInputRequired is returned when a call comes back input_required and the Client has
+// no Elicit callback, or the server asks for input other than elicitation.
+var ErrInputRequired = errors.New("mcpclient: server requires input the client cannot provide")
+
+// Client issues MCP requests over one connection. It is safe for concurrent use.
+type Client struct {
+	conn conn
+	opts Options
+
+	nextID atomic.Int64
+
+	mu    sync.Mutex
+	tools map[string]mcp.Tool // from the last ListTools, for deriving Mcp-Param-* headers
+}
+
+// conn is one transport binding: it sends a request and yields everything the server
+// writes for it, notifications first and the final response last.
+type conn interface {
+	// send writes req and returns the channel its messages arrive on, closed after the
+	// final response (or when the connection fails), and a release func the caller must
+	// call once it is done with the request, which abandons it if still in flight.
+	send(ctx context.Context, req *outgoing) (<-chan message, func(), error)
+	// headers reports whether the binding carries Mcp-* headers, so the Client knows
+	// whether computing them is worth the trouble.
+	headers() bool
+	close() error
+}
+
+// outgoing is one request as handed to a conn.
+type outgoing struct {
+	id      json.RawMessage
+	method  string
+	body    []byte
+	headers map[string]string // Mcp-Name, Mcp-Param-*; ignored by stream bindings
+}
+
+// message is any JSON-RPC message received from the server.
+type message struct {
+	ID     json.RawMessage     `json:"id,omitempty"`
+	Method string              `json:"method,omitempty"`
+	Params json.RawMessage     `json:"params,omitempty"`
+	Result json.RawMessage     `json:"result,omitempty"`
+	Error  *transport.RPCError `json:"error,omitempty"`
+}
+
+func (m *message) isNotification() bool {
+	return m.Method != "" && len(m.ID) == 0
+}
+
+func newClient(c conn, opts *Options) *Client {
+	cl := &Client{conn: c, tools: map[string]mcp.Tool{}}
+	if opts != nil {
+		cl.opts = *opts
+	}
+	if cl.opts.ClientInfo.Name == "" {
+		cl.opts.ClientInfo = mcp.Implementation{Name: "generic-go-mcp-client", Version: "0.1.0"}
+	}
+	if cl.opts.Elicit != nil && cl.opts.Capabilities.Elicitation == nil {
+		cl.opts.Capabilities.Elicitation = map[string]interface{}{}
+	}
+	if cl.opts.MaxInputRounds <= 0 {
+		cl.opts.MaxInputRounds = defaultMaxInputRounds
+	}
+	return cl
+}
+
+// Close closes the connection. For a stdio client it also waits for the subprocess to exit.
+func (c *Client) Close() error {
+	return c.conn.close()
+}
+
+// Call sends method with params (any value marshalling to a JSON object, or nil) and
+// decodes the result into result, if non-nil. The client's _meta fields are merged into
+// params, except where params._meta already sets the same key. Over Streamable HTTP the
+// Mcp-Name and Mcp-Param-* headers are derived from params as CallTool and ReadResource
+// do. A JSON-RPC error is returned as a *transport.RPCError. Call does not drive MRTR: an
+// input_required result is decoded like any other.
+func (c *Client) Call(ctx context.Context, method string, params, result interface{}) error {
+	name, headers, err := c.requestHeaders(ctx, method, params)
+	if err != nil {
+		return err
+	}
+	raw, err := c.call(ctx, method, name, params, headers, nil)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(raw, result)
+}
+
+// Discover calls server/discover.
+func (c *Client) Discover(ctx context.Context) (*mcp.DiscoverResult, error) {
+	var res mcp.DiscoverResult
+	if err := c.Call(ctx, "server/discover", nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ListTools returns every tool the server offers, following nextCursor through all pages.
+func (c *Client) ListTools(ctx context.Context) ([]mcp.Tool, error) {
+	var all []mcp.Tool
+	cursor := ""
+	for {
+		var page mcp.ToolsListResult
+		if err := c.Call(ctx, "tools/list", cursorParams(cursor), &page); err != nil {
+			return nil, err
+		}
+		all = append(all, page.Tools...)
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	tools := make(map[string]mcp.Tool, len(all))
+	for _, t := range all {
+		tools[t.Name] = t
+	}
+	c.mu.Lock()
+	c.tools = tools
+	c.mu.Unlock()
+	return all, nil
+}
+
+// ListResources returns every resource the server offers, following nextCursor through
+// all pages.
+func (c *Client) ListResources(ctx context.Context) ([]mcp.Resource, error) {
+	var all []mcp.Resource
+	cursor := ""
+	for {
+		var page mcp.ResourcesListResult
+		if err := c.Call(ctx, "resources/list", cursorParams(cursor), &page); err != nil {
+			return nil, err
+		}
+		all = append(all, page.Resources...)
+		if page.NextCursor == "" {
+			return all, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+func cursorParams(cursor string) map[string]interface{} {
+	if cursor == "" {
+		return nil
+	}
+	return map[string]interface{}{"cursor": cursor}
+}
+
+// CallTool calls tool name with args (any value marshalling to a JSON object, or nil),
+// answering input_required rounds through Options.Elicit. A tool execution error is a
+// result with IsError set, not an error. Over Streamable HTTP, the Mcp-Param-* headers
+// are derived from the tool's inputSchema as last seen by ListTools, which is called
+// first if the tool hasn't been seen yet.
+func (c *Client) CallTool(ctx context.Context, name string, args interface{}) (*mcp.ToolCallResult, error) {
+	rawArgs := json.RawMessage("{}")
+	if args != nil {
+		b, err := json.Marshal(args)
+		if err != nil {
+			return nil, err
+		}
+		rawArgs = b
+	}
+
+	var headers map[string]string
+	if c.conn.headers() {
+		var err error
+		if headers, err = c.paramHeaders(ctx, name, rawArgs); err != nil {
+			return nil, err
+		}
+	}
+
+	params := map[string]interface{}{"name": name, "arguments": rawArgs}
+	raw, err := c.callMRTR(ctx, "tools/call", name, params, headers)
+	if err != nil {
+		return nil, err
+	}
+	var res mcp.ToolCallResult
+	if err := json.Unmarshal(raw, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// paramHeaders returns the Mcp-Param-* headers for calling tool name with args.
+func (c *Client) paramHeaders(ctx context.Context, name string, args json.RawMessage) (map[string]string, error) {
+	tool, err := c.lookupTool(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	headers, err := mcp.ParamHeaders(tool, args)
+	if err != nil {
+		return nil, fmt.Errorf("mcpclient: tool %s: %w", name, err)
+	}
+	return headers, nil
+}
+
+// requestHeaders returns what Call sends as the Mcp-Name header and the Mcp-Param-*
+// headers for method and params, on bindings that carry headers at all.
+func (c *Client) requestHeaders(ctx context.Context, method string, params interface{}) (string, map[string]string, error) {
+	if params == nil || !c.conn.headers() {
+		return "", nil, nil
+	}
+	switch method {
+	case "tools/call", "resources/read", "prompts/get":
+	default:
+		return "", nil, nil
+	}
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return "", nil, err
+	}
+	var p struct {
+		Name      string          `json:"name"`
+		URI       string          `json:"uri"`
+		Arguments json.RawMessage `json:"arguments"`
+	}
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return "", nil, fmt.Errorf("mcpclient: params must be a JSON object: %w", err)
+	}
+	switch method {
+	case "resources/read":
+		return p.URI, nil, nil
+	case "prompts/get":
+		return p.Name, nil, nil
+	}
+	if len(p.Arguments) == 0 {
+		p.Arguments = json.RawMessage("{}")
+	}
+	headers, err := c.paramHeaders(ctx, p.Name, p.Arguments)
+	return p.Name, headers, err
+}
+
+func (c *Client) lookupTool(ctx context.Context, name string) (mcp.Tool, error) {
+	c.mu.Lock()
+	tool, ok := c.tools[name]
+	c.mu.Unlock()
+	if ok {
+		return tool, nil
+	}
+	if _, err := c.ListTools(ctx); err != nil {
+		return mcp.Tool{}, err
+	}
+	c.mu.Lock()
+	tool, ok = c.tools[name]
+	c.mu.Unlock()
+	if !ok {
+		// Let the server report the unknown tool in its own words.
+		return mcp.Tool{Name: name}, nil
+	}
+	return tool, nil
+}
+
+// ReadResource reads uri, answering input_required rounds through Options.Elicit.
+func (c *Client) ReadResource(ctx context.Context, uri string) (*mcp.ResourcesReadResult, error) {
+	raw, err := c.callMRTR(ctx, "resources/read", uri, map[string]interface{}{"uri": uri}, nil)
+	if err != nil {
+		return nil, err
+	}
+	var res mcp.ResourcesReadResult
+	if err := json.Unmarshal(raw, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Listen opens a subscriptions/listen stream for filter, returning once the server has
+// acknowledged it. Matching notifications arrive on the returned channel, which is closed
+// when ctx is cancelled (ending the subscription) or the stream fails.
+func (c *Client) Listen(ctx context.Context, filter mcp.NotificationFilter) (<-chan Notification, error) {
+	out := make(chan Notification, 16)
+	acked := make(chan struct{})
+	errc := make(chan error, 1)
+	var once sync.Once
+
+	go func() {
+		defer close(out)
+		_, err := c.call(ctx, "subscriptions/listen", "", map[string]interface{}{"notifications": filter}, nil, func(n Notification) {
+			if n.Method == "notifications/subscriptions/acknowledged" {
+				once.Do(func() { close(acked) })
+				return
+			}
+			select {
+			case out <- n:
+			case <-ctx.Done():
+			}
+		})
+		errc <- err
+	}()
+
+	select {
+	case <-acked:
+		return out, nil
+	case err := <-errc:
+		if err == nil {
+			err = errors.New("mcpclient: subscriptions/listen ended before it was acknowledged")
+		}
+		return nil, err
+	}
+}
+
+// callMRTR sends a request and, for as long as the server answers input_required,
+// fulfils its inputRequests and retries with inputResponses and requestState attached.
+func (c *Client) callMRTR(ctx context.Context, method, name string, params map[string]interface{}, headers map[string]string) (json.RawMessage, error) {
+	for round := 0; ; round++ {
+		raw, err := c.call(ctx, method, name, params, headers, nil)
+		if err != nil {
+			return nil, err
+		}
+		var ir mcp.InputRequiredResult
+		if err := json.Unmarshal(raw, &ir); err != nil {
+			return nil, err
+		}
+		if ir.ResultType != mcp.ResultTypeInputRequired {
+			return raw, nil
+		}
+		if round >= c.opts.MaxInputRounds {
+			return nil, fmt.Errorf("mcpclient: %s still requires input after %d rounds", method, round)
+		}
+		responses, err := c.fulfil(ctx, ir.InputRequests)
+		if err != nil {
+			return nil, err
+		}
+		params["inputResponses"] = responses
+		params["requestState"] = ir.RequestState
+	}
+}
+
+// fulfil answers each of reqs. Only elicitation/create is supported; sampling and roots
+// are deprecated in this revision.
+func (c *Client) fulfil(ctx context.Context, reqs mcp.InputRequests) (mcp.InputResponses, error) {
+	responses := make(mcp.InputResponses, len(reqs))
+	for key, raw := range reqs {
+		var r struct {
+			Method string                  `json:"method"`
+			Params mcp.ElicitRequestParams `json:"params"`
+		}
+		if err := json.Unmarshal(raw, &r); err != nil {
+			return nil, err
+		}
+		if r.Method != "elicitation/create" || c.opts.Elicit == nil {
+			return nil, fmt.Errorf("%w: %s", ErrInputRequired, r.Method)
+		}
+		res, err := c.opts.Elicit(ctx, r.Params)
+		if err != nil {
+			return nil, err
+		}
+		if responses[key], err = json.Marshal(res); err != nil {
+			return nil, err
+		}
+	}
+	return responses, nil
+}
+
+// call sends one request and waits for its response, passing any notification that
+// arrives for it to notify, or to Options.OnNotification when notify is nil.
+func (c *Client) call(ctx context.Context, method, name string, params interface{}, headers map[string]string, notify func(Notification)) (json.RawMessage, error) {
+	if notify == nil {
+		notify = c.opts.OnNotification
+	}
+
+	id := json.RawMessage(fmt.Sprint(c.nextID.Add(1)))
+	withMeta, err := c.withMeta(params, method == "tools/call" && notify != nil, id)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(transport.JSONRPCRequest{JSONRPC: "2.0", ID: id, Method: method, Params: withMeta})
+	if err != nil {
+		return nil, err
+	}
+
+	hdr := map[string]string{}
+	for k, v := range headers {
+		hdr[k] = v
+	}
+	if name != "" {
+		hdr[transport.NameHeader] = transport.EncodeHeaderValue(name)
+	}
+
+	ch, release, err := c.conn.send(ctx, &outgoing{id: id, method: method, body: body, headers: hdr})
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	for {
+		select {
+		case m, ok := <-ch:
+			if !ok {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				return nil, errConnectionClosed
+			}
+			if m.isNotification() {
+				if notify != nil {
+					notify(Notification{Method: m.Method, Params: m.Params})
+				}
+				continue
+			}
+			if m.Error != nil {
+				return nil, m.Error
+			}
+			return m.Result, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+var errConnectionClosed = errors.New("mcpclient: connection closed before the response arrived")
+
+// withMeta merges the client's per-request _meta fields into params, leaving any key the
+// caller already set in params._meta alone.
+func (c *Client) withMeta(params interface{}, progress bool, id json.RawMessage) (json.RawMessage, error) {
+	fields := map[string]json.RawMessage{}
+	if params != nil {
+		raw, err := json.Marshal(params)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return nil, fmt.Errorf("mcpclient: params must be a JSON object: %w", err)
+		}
+		if fields == nil { // params marshalled to null, e.g. a nil map
+			fields = map[string]json.RawMessage{}
+		}
+	}
+	meta := map[string]interface{}{}
+	if raw, ok := fields["_meta"]; ok {
+		if err := json.Unmarshal(raw, &meta); err != nil {
+			return nil, fmt.Errorf("mcpclient: params._meta must be a JSON object: %w", err)
+		}
+	}
+	setDefault := func(key string, value interface{}) {
+		if _, ok := meta[key]; !ok {
+			meta[key] = value
+		}
+	}
+	setDefault(metaKeyProtocolVersion, mcp.ProtocolVersion)
+	setDefault(metaKeyClientInfo, c.opts.ClientInfo)
+	setDefault(metaKeyClientCapabilities, c.opts.Capabilities)
+	if c.opts.LogLevel != "" {
+		setDefault(metaKeyLogLevel, c.opts.LogLevel)
+	}
+	if _, ok := meta[metaKeyProgressToken]; !ok && progress {
+		meta[metaKeyProgressToken] = id
+	}
+	rawMeta, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+	fields["_meta"] = rawMeta
+	return json.Marshal(fields)
+}
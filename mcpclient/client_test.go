@@ -0,0 +1,265 @@
+package mcpclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spirilis/generic-go-mcp/mcp"
+	"github.com/spirilis/generic-go-mcp/transport"
+)
+
+// newTestServer builds a server with enough tools to need two tools/list pages, an
+// x-mcp-header-annotated tool, and a tool that asks for input before answering.
+func newTestServer(t *testing.T) (*mcp.Server, *mcp.ToolRegistry) {
+	t.Helper()
+	registry := mcp.NewToolRegistry()
+	for i := 0; i < 60; i++ {
+		registry.Register(mcp.Tool{Name: fmt.Sprintf("filler_%02d", i), InputSchema: json.RawMessage(`{"type":"object"}`)},
+			func(ctx context.Context, req *mcp.ToolRequest) (mcp.Result, error) {
+				return &mcp.ToolCallResult{Content: []mcp.Content{mcp.Text(req.Name)}}, nil
+			})
+	}
+	registry.Register(mcp.Tool{
+		Name:        "weather",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{"region":{"type":"string","x-mcp-header":"Region"}},"required":["region"]}`),
+	}, func(ctx context.Context, req *mcp.ToolRequest) (mcp.Result, error) {
+		var args struct {
+			Region string `json:"region"`
+		}
+		_ = req.BindArguments(&args)
+		return &mcp.ToolCallResult{Content: []mcp.Content{mcp.Text("sunny in " + args.Region)}}, nil
+	})
+	registry.Register(mcp.Tool{Name: "confirm", InputSchema: json.RawMessage(`{"type":"object"}`)},
+		func(ctx context.Context, req *mcp.ToolRequest) (mcp.Result, error) {
+			if v, ok := req.ElicitResponse("ok"); ok {
+				return &mcp.ToolCallResult{Content: []mcp.Content{mcp.Text("answer: " + v.Action)}}, nil
+			}
+			return req.NeedInput(mcp.InputRequests{
+				"ok": mcp.NewElicitRequest("form", "proceed?", json.RawMessage(`{"type":"object"}`)),
+			})
+		})
+	return mcp.NewServer(registry, mcp.NewResourceRegistry(), nil), registry
+}
+
+func startUnix(t *testing.T, srv *mcp.Server) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "mcp.sock")
+	tr := transport.NewUnixTransport(transport.UnixTransportConfig{SocketPath: path, FileMode: 0o600})
+	if err := tr.Start(srv); err != nil {
+		t.Fatalf("start unix transport: %v", err)
+	}
+	t.Cleanup(func() { tr.Stop() })
+	return path
+}
+
+func startHTTP(t *testing.T, srv *mcp.Server) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("reserve port: %v", err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	tr := transport.NewHTTPTransport(transport.HTTPTransportConfig{Host: "127.0.0.1", Port: port})
+	if err := tr.Start(srv); err != nil {
+		t.Fatalf("start http transport: %v", err)
+	}
+	t.Cleanup(func() { tr.Stop() })
+	endpoint := fmt.Sprintf("http://127.0.0.1:%d/mcp", port)
+	for i := 0; i < 50; i++ {
+		if c, err := net.Dial("tcp", l.Addr().String()); err == nil {
+			c.Close()
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return endpoint
+}
+
+func exerciseClient(t *testing.T, c *Client, registry *mcp.ToolRegistry) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	disc, err := c.Discover(ctx)
+	if err != nil || disc.Capabilities.Tools == nil {
+		t.Fatalf("Discover = %+v, %v; want tools advertised", disc, err)
+	}
+
+	tools, err := c.ListTools(ctx)
+	if err != nil || len(tools) != 62 {
+		t.Fatalf("ListTools = %d tools, %v; want all 62 across pages", len(tools), err)
+	}
+
+	res, err := c.CallTool(ctx, "weather", map[string]string{"region": "Zürich"})
+	if err != nil || len(res.Content) != 1 || res.Content[0].Text != "sunny in Zürich" {
+		t.Fatalf("CallTool weather = %+v, %v", res, err)
+	}
+
+	res, err = c.CallTool(ctx, "confirm", nil)
+	if err != nil || res.Content[0].Text != "answer: accept" {
+		t.Fatalf("CallTool confirm through MRTR = %+v, %v", res, err)
+	}
+
+	var rpcErr *transport.RPCError
+	if _, err := c.CallTool(ctx, "no_such_tool", nil); !errors.As(err, &rpcErr) || rpcErr.Code != transport.InvalidParams {
+		t.Errorf("CallTool of an unknown tool = %v, want a -32602 *transport.RPCError", err)
+	}
+
+	listenCtx, stopListen := context.WithCancel(ctx)
+	notes, err := c.Listen(listenCtx, mcp.NotificationFilter{ToolsListChanged: true})
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	registry.Unregister("filler_00")
+	select {
+	case n := <-notes:
+		if n.Method != "notifications/tools/list_changed" {
+			t.Errorf("listen delivered %s, want notifications/tools/list_changed", n.Method)
+		}
+	case <-ctx.Done():
+		t.Fatal("no notification on the Listen channel")
+	}
+	stopListen()
+	for range notes {
+	}
+}
+
+func elicitAccept(ctx context.Context, p mcp.ElicitRequestParams) (mcp.ElicitResult, error) {
+	return mcp.ElicitResult{Action: "accept", Content: json.RawMessage(`{}`)}, nil
+}
+
+func TestClientOverUnixSocket(t *testing.T) {
+	srv, registry := newTestServer(t)
+	c, err := DialUnix(context.Background(), startUnix(t, srv), &Options{Elicit: elicitAccept})
+	if err != nil {
+		t.Fatalf("DialUnix: %v", err)
+	}
+	defer c.Close()
+	exerciseClient(t, c, registry)
+}
+
+func TestClientOverStreamableHTTP(t *testing.T) {
+	srv, registry := newTestServer(t)
+	c := NewHTTPClient(startHTTP(t, srv), &Options{Elicit: elicitAccept})
+	defer c.Close()
+	exerciseClient(t, c, registry)
+}
+
+func TestClientReportsHTTPAuthFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":"invalid_token"}`))
+	}))
+	defer srv.Close()
+	c := NewHTTPClient(srv.URL+"/mcp", nil)
+	defer c.Close()
+
+	var statusErr *HTTPStatusError
+	_, err := c.ListTools(context.Background())
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnauthorized ||
+		statusErr.Body != `{"error":"invalid_token"}` || statusErr.WWWAuthenticate == "" {
+		t.Errorf("ListTools against a 401 = %v, want an *HTTPStatusError carrying the status, body and challenge", err)
+	}
+}
+
+// idleCountingTransport counts the CloseIdleConnections calls reaching it.
+type idleCountingTransport struct {
+	http.RoundTripper
+	closes int
+}
+
+func (t *idleCountingTransport) CloseIdleConnections() { t.closes++ }
+
+func TestCloseLeavesACallersHTTPClientAlone(t *testing.T) {
+	srv, _ := newTestServer(t)
+	tr := &idleCountingTransport{RoundTripper: http.DefaultTransport}
+	c := NewHTTPClient(startHTTP(t, srv), &Options{HTTPClient: &http.Client{Transport: tr}})
+	if _, err := c.ListTools(context.Background()); err != nil {
+		t.Fatalf("ListTools: %v", err)
+	}
+	c.Close()
+	if tr.closes != 0 {
+		t.Errorf("Close called CloseIdleConnections %d times on the caller's client, want 0", tr.closes)
+	}
+}
+
+func TestClientInMemory(t *testing.T) {
+	srv, registry := newTestServer(t)
+	tr := transport.NewInMemoryTransport()
+	tr.Start(srv)
+	defer tr.Stop()
+	conn, err := tr.Connect()
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	c := NewInMemoryClient(conn, &Options{Elicit: elicitAccept})
+	defer c.Close()
+	exerciseClient(t, c, registry)
+}
+
+func TestClientWithoutElicitReportsInputRequired(t *testing.T) {
+	srv, _ := newTestServer(t)
+	c, err := DialUnix(context.Background(), startUnix(t, srv), nil)
+	if err != nil {
+		t.Fatalf("DialUnix: %v", err)
+	}
+	defer c.Close()
+	// The client declares no elicitation capability, so the server refuses outright.
+	var rpcErr *transport.RPCError
+	if _, err := c.CallTool(context.Background(), "confirm", nil); !errors.As(err, &rpcErr) || rpcErr.Code != transport.MissingRequiredClientCapability {
+		t.Errorf("CallTool without elicitation = %v, want -32021", err)
+	}
+}
+
+func TestSlowListenerDoesNotStallOtherRequests(t *testing.T) {
+	registry := mcp.NewToolRegistry()
+	registry.Register(mcp.Tool{Name: "ping", InputSchema: json.RawMessage(`{"type":"object"}`)},
+		func(ctx context.Context, req *mcp.ToolRequest) (mcp.Result, error) {
+			return &mcp.ToolCallResult{Content: []mcp.Content{mcp.Text("pong")}}, nil
+		})
+	resources := mcp.NewResourceRegistry()
+	var uris []string
+	for i := 0; i < 100; i++ {
+		uri := fmt.Sprintf("test://item/%d", i)
+		uris = append(uris, uri)
+		resources.Register(mcp.Resource{URI: uri, Name: uri}, func(ctx context.Context) (mcp.ResourceContentResult, error) {
+			return mcp.ResourceContentResult{Text: "item"}, nil
+		})
+	}
+	srv := mcp.NewServer(registry, resources, nil)
+	c, err := DialUnix(context.Background(), startUnix(t, srv), nil)
+	if err != nil {
+		t.Fatalf("DialUnix: %v", err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Nobody reads notes, so everything past its buffer backs up inside the client.
+	notes, err := c.Listen(ctx, mcp.NotificationFilter{ResourceSubscriptions: uris})
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	for _, uri := range uris {
+		resources.NotifyUpdated(uri)
+		time.Sleep(time.Millisecond)
+	}
+	res, err := c.CallTool(ctx, "ping", nil)
+	if err != nil || res.Content[0].Text != "pong" {
+		t.Fatalf("CallTool behind an undrained Listen = %+v, %v", res, err)
+	}
+	cancel()
+	for range notes {
+	}
+}
@@ -0,0 +1,171 @@
+package mcpclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/spirilis/generic-go-mcp/mcp"
+	"github.com/spirilis/generic-go-mcp/transport"
+)
+
+// httpConn is the Streamable HTTP binding: each request is its own POST, answered either
+// with a single JSON response or with an SSE stream scoped to that request, so every
+// notification in the response belongs to it and no demultiplexing is needed.
+type httpConn struct {
+	endpoint string
+	client   *http.Client
+	header   http.Header
+	// ownClient is set when client was created here, so close may drop its connections.
+	ownClient bool
+}
+
+// NewHTTPClient returns a Client for the Streamable HTTP endpoint at endpoint, e.g.
+// "http://localhost:8080/mcp".
+func NewHTTPClient(endpoint string, opts *Options) *Client {
+	c := &httpConn{endpoint: endpoint}
+	cl := newClient(c, opts)
+	c.client = cl.opts.HTTPClient
+	if c.client == nil {
+		c.client = &http.Client{Transport: http.DefaultTransport.(*http.Transport).Clone()}
+		c.ownClient = true
+	}
+	c.header = cl.opts.Header
+	return cl
+}
+
+func (c *httpConn) headers() bool {
+	return true
+}
+
+func (c *httpConn) send(ctx context.Context, req *outgoing) (<-chan message, func(), error) {
+	ctx, cancel := context.WithCancel(ctx)
+	hr, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(req.body))
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	for k, vs := range c.header {
+		for _, v := range vs {
+			hr.Header.Add(k, v)
+		}
+	}
+	hr.Header.Set("Content-Type", "application/json")
+	hr.Header.Set("Accept", "application/json, text/event-stream")
+	hr.Header.Set(transport.ProtocolVersionHeader, mcp.ProtocolVersion)
+	hr.Header.Set(transport.MethodHeader, req.method)
+	for k, v := range req.headers {
+		hr.Header.Set(k, v)
+	}
+
+	resp, err := c.client.Do(hr)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+
+	ch := make(chan message, 16)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// The server maps some JSON-RPC errors to HTTP statuses (see
+		// transport.HTTPStatusForRPCError), so a JSON-RPC error body is still the answer;
+		// anything else (e.g. the auth middleware's 401) is the HTTP error itself.
+		defer cancel()
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		var m message
+		if json.Unmarshal(body, &m) == nil && m.Error != nil {
+			ch <- m
+			close(ch)
+			return ch, func() {}, nil
+		}
+		return nil, nil, &HTTPStatusError{
+			StatusCode:      resp.StatusCode,
+			Body:            strings.TrimSpace(string(body)),
+			WWWAuthenticate: resp.Header.Get("WWW-Authenticate"),
+		}
+	}
+	go func() {
+		defer close(ch)
+		defer resp.Body.Close()
+		mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		switch mediaType {
+		case "text/event-stream":
+			readSSE(ctx, resp.Body, ch)
+		case "application/json":
+			var m message
+			if err := json.NewDecoder(resp.Body).Decode(&m); err == nil {
+				ch <- m
+			}
+		default:
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+			ch <- message{Error: &transport.RPCError{
+				Code:    transport.InternalError,
+				Message: fmt.Sprintf("unexpected HTTP %d response: %s", resp.StatusCode, strings.TrimSpace(string(body))),
+			}}
+		}
+	}()
+	return ch, cancel, nil
+}
+
+// HTTPStatusError is returned for a non-2xx HTTP response that carries no JSON-RPC error,
+// such as a 401 from an OAuth-protected server when Options.Header holds no valid token.
+type HTTPStatusError struct {
+	StatusCode      int
+	Body            string // the start of the response body
+	WWWAuthenticate string // the WWW-Authenticate header, naming where to get a token on a 401
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("mcpclient: unexpected HTTP %d response: %s", e.StatusCode, e.Body)
+}
+
+// readSSE forwards each data event of an SSE stream to ch until the stream ends, the final
+// response has been forwarded, or ctx is done.
+func readSSE(ctx context.Context, r io.Reader, ch chan<- message) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	var data []byte
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if len(data) == 0 {
+				continue
+			}
+			var m message
+			err := json.Unmarshal(data, &m)
+			data = data[:0]
+			if err != nil {
+				continue
+			}
+			select {
+			case ch <- m:
+			case <-ctx.Done():
+				return
+			}
+			if !m.isNotification() {
+				return
+			}
+			continue
+		}
+		if value, ok := strings.CutPrefix(line, "data:"); ok {
+			if len(data) > 0 {
+				data = append(data, '\n')
+			}
+			data = append(data, strings.TrimPrefix(value, " ")...)
+		}
+		// Comments (keep-alives), event names and ids carry nothing the client needs.
+	}
+}
+
+func (c *httpConn) close() error {
+	if c.ownClient {
+		c.client.CloseIdleConnections()
+	}
+	return nil
+}
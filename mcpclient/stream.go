@@ -0,0 +1,309 @@
+package mcpclient
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"sync"
+
+	"github.com/spirilis/generic-go-mcp/transport"
+)
+
+// streamConn is the binding shared by stdio, UNIX sockets and in-memory connections:
+// every request and response shares one stream of messages, so a single reader goroutine
+// demultiplexes what the server writes. A response goes to the request with its id; a
+// notification goes to the subscriptions/listen request named by its
+// io.modelcontextprotocol/subscriptionId, or the request whose progressToken it carries,
+// and otherwise to Options.OnNotification.
+type streamConn struct {
+	write    func(msg []byte) error // sends one message; calls are serialized by writeMu
+	closer   func() error
+	unrouted func(Notification)
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[string]*pendingRequest // JSON-RPC id -> request awaiting its response
+	closed  bool
+}
+
+// pendingRequest queues what the read loop routes to one request without limit, so a
+// caller slow to drain a subscriptions/listen stream never stalls the shared reader and
+// every other request on the connection. Its pump goroutine forwards the queue to ch in
+// order and closes ch once the request has ended and the queue is empty.
+type pendingRequest struct {
+	ch   chan message
+	done chan struct{} // closed when the caller abandons the request
+	wake chan struct{}
+
+	mu    sync.Mutex
+	queue []message
+	ended bool
+}
+
+func newPendingRequest() *pendingRequest {
+	p := &pendingRequest{
+		ch:   make(chan message),
+		done: make(chan struct{}),
+		wake: make(chan struct{}, 1),
+	}
+	go p.pump()
+	return p
+}
+
+// push queues m for the caller; it never blocks.
+func (p *pendingRequest) push(m message) {
+	p.mu.Lock()
+	p.queue = append(p.queue, m)
+	p.mu.Unlock()
+	p.signal()
+}
+
+// end closes ch once everything already queued has been handed over.
+func (p *pendingRequest) end() {
+	p.mu.Lock()
+	p.ended = true
+	p.mu.Unlock()
+	p.signal()
+}
+
+func (p *pendingRequest) signal() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (p *pendingRequest) pump() {
+	defer close(p.ch)
+	for {
+		p.mu.Lock()
+		queue, ended := p.queue, p.ended
+		p.queue = nil
+		p.mu.Unlock()
+		if len(queue) == 0 {
+			if ended {
+				return
+			}
+			select {
+			case <-p.wake:
+			case <-p.done:
+				return
+			}
+			continue
+		}
+		for _, m := range queue {
+			select {
+			case p.ch <- m:
+			case <-p.done:
+				return
+			}
+		}
+	}
+}
+
+// NewStreamClient returns a Client speaking newline-delimited JSON-RPC over rwc, which
+// Close closes. DialStdio and DialUnix are built on it; use it directly for any other
+// reliable byte stream.
+func NewStreamClient(rwc io.ReadWriteCloser, opts *Options) *Client {
+	scanner := bufio.NewScanner(rwc)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	next := func() ([]byte, bool) {
+		if !scanner.Scan() {
+			return nil, false
+		}
+		return scanner.Bytes(), true
+	}
+	write := func(msg []byte) error {
+		line := make([]byte, 0, len(msg)+1)
+		_, err := rwc.Write(append(append(line, msg...), '\n'))
+		return err
+	}
+	return newStreamClient(write, next, rwc.Close, opts)
+}
+
+// NewInMemoryClient returns a Client for the server behind conn, an in-memory
+// connection from transport.InMemoryTransport.Connect. Close closes conn.
+func NewInMemoryClient(conn *transport.InMemoryConn, opts *Options) *Client {
+	next := func() ([]byte, bool) {
+		msg, ok := <-conn.Messages()
+		return msg, ok
+	}
+	return newStreamClient(conn.Send, next, conn.Close, opts)
+}
+
+// newStreamClient starts a streamConn reading messages from next until it reports the
+// end of the stream.
+func newStreamClient(write func([]byte) error, next func() ([]byte, bool), closer func() error, opts *Options) *Client {
+	c := &streamConn{write: write, closer: closer, pending: map[string]*pendingRequest{}}
+	cl := newClient(c, opts)
+	c.unrouted = cl.opts.OnNotification
+	go c.readLoop(next)
+	return cl
+}
+
+// DialUnix connects to an MCP server listening on the UNIX domain socket at path.
+func DialUnix(ctx context.Context, path string, opts *Options) (*Client, error) {
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, "unix", path)
+	if err != nil {
+		return nil, err
+	}
+	return NewStreamClient(nc, opts), nil
+}
+
+// DialStdio starts cmd and speaks MCP over its stdin and stdout. cmd's Stdin and Stdout
+// must be unset; its Stderr is left as the caller set it (nil discards the server's logs).
+// Close closes the server's stdin, the spec's shutdown signal for a stdio server, and
+// waits for it to exit.
+func DialStdio(cmd *exec.Cmd, opts *Options) (*Client, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("mcpclient: starting %s: %w", cmd.Path, err)
+	}
+	return NewStreamClient(&stdioPipe{Reader: stdout, stdin: stdin, cmd: cmd}, opts), nil
+}
+
+// stdioPipe joins a subprocess's stdout and stdin into one io.ReadWriteCloser.
+type stdioPipe struct {
+	io.Reader
+	stdin io.WriteCloser
+	cmd   *exec.Cmd
+}
+
+func (p *stdioPipe) Write(b []byte) (int, error) {
+	return p.stdin.Write(b)
+}
+
+func (p *stdioPipe) Close() error {
+	p.stdin.Close()
+	return p.cmd.Wait()
+}
+
+func (c *streamConn) headers() bool {
+	return false
+}
+
+func (c *streamConn) send(ctx context.Context, req *outgoing) (<-chan message, func(), error) {
+	key := string(req.id)
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, nil, errConnectionClosed
+	}
+	p := newPendingRequest()
+	c.pending[key] = p
+	c.mu.Unlock()
+
+	if err := c.writeMsg(req.body); err != nil {
+		c.forget(key)
+		close(p.done)
+		return nil, nil, err
+	}
+
+	release := func() {
+		close(p.done)
+		if c.forget(key) {
+			// Still in flight: tell the server to stop working on it.
+			data, _ := json.Marshal(map[string]interface{}{
+				"jsonrpc": "2.0",
+				"method":  "notifications/cancelled",
+				"params":  map[string]interface{}{"requestId": req.id},
+			})
+			_ = c.writeMsg(data)
+		}
+	}
+	return p.ch, release, nil
+}
+
+// forget removes key's pending request, reporting whether it was still there.
+func (c *streamConn) forget(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.pending[key]
+	delete(c.pending, key)
+	return ok
+}
+
+func (c *streamConn) writeMsg(data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.write(data)
+}
+
+func (c *streamConn) readLoop(next func() ([]byte, bool)) {
+	for {
+		data, ok := next()
+		if !ok {
+			break
+		}
+		var m message
+		if err := json.Unmarshal(data, &m); err != nil {
+			continue
+		}
+		if m.isNotification() {
+			c.routeNotification(m)
+			continue
+		}
+		key := string(m.ID)
+		c.mu.Lock()
+		p, ok := c.pending[key]
+		delete(c.pending, key)
+		c.mu.Unlock()
+		if ok {
+			p.push(m)
+			p.end()
+		}
+	}
+
+	c.mu.Lock()
+	c.closed = true
+	pending := c.pending
+	c.pending = map[string]*pendingRequest{}
+	c.mu.Unlock()
+	for _, p := range pending {
+		p.end()
+	}
+}
+
+func (c *streamConn) routeNotification(m message) {
+	var params struct {
+		Meta map[string]json.RawMessage `json:"_meta"`
+	}
+	_ = json.Unmarshal(m.Params, &params)
+	key, ok := params.Meta[metaKeySubscriptionID]
+	if !ok {
+		var progress struct {
+			ProgressToken json.RawMessage `json:"progressToken"`
+		}
+		_ = json.Unmarshal(m.Params, &progress)
+		key, ok = progress.ProgressToken, len(progress.ProgressToken) > 0
+	}
+	if ok {
+		c.mu.Lock()
+		p, found := c.pending[string(key)]
+		c.mu.Unlock()
+		if found {
+			p.push(m)
+			return
+		}
+	}
+	if c.unrouted != nil {
+		c.unrouted(Notification{Method: m.Method, Params: m.Params})
+	}
+}
+
+func (c *streamConn) close() error {
+	return c.closer()
+}
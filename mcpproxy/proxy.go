@@ -0,0 +1,370 @@
+// Package mcpproxy aggregates upstream MCP servers behind one server: it mounts each
+// upstream's tools and resources into a local mcp.ToolRegistry and mcp.ResourceRegistry
+// under a name prefix, forwards tools/call and resources/read to the upstream, and keeps
+// the local registries in step with the upstream's list_changed and resources/updated
+// notifications, so the local server's subscribers hear about upstream changes too.
+//
+// Upstreams are reached through mcpclient, so any binding it supports will do: a spawned
+// stdio server (mcpclient.DialStdio), a UNIX socket (mcpclient.DialUnix) or Streamable
+// HTTP (mcpclient.NewHTTPClient).
+package mcpproxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"time"
+
+	"github.com/spirilis/generic-go-mcp/logging"
+	"github.com/spirilis/generic-go-mcp/mcp"
+	"github.com/spirilis/generic-go-mcp/mcpclient"
+)
+
+// relistenDelay is how long a mount waits before reopening a subscriptions/listen stream
+// the upstream ended or refused.
+const relistenDelay = time.Second
+
+// Upstream describes one server to mount.
+type Upstream struct {
+	// Name identifies the upstream in logs.
+	Name string
+
+	// Client is connected to the upstream. The proxy does not close it.
+	Client *mcpclient.Client
+
+	// ToolPrefix is prepended to each upstream tool name, e.g. "weather_" exports the
+	// upstream's "forecast" as "weather_forecast".
+	ToolPrefix string
+
+	// URIPrefix is prepended to each upstream resource URI. A prefix ending in "+" extends
+	// the URI's scheme, so "weather+" exports "file:///today.json" as
+	// "weather+file:///today.json" and the result is still a well-formed URI.
+	URIPrefix string
+}
+
+// Proxy mounts upstream servers into a pair of local registries.
+type Proxy struct {
+	tools     *mcp.ToolRegistry
+	resources *mcp.ResourceRegistry
+}
+
+// New returns a Proxy exporting into tools and resources, which are typically also given
+// to mcp.NewServer. Either may also hold the server's own entries; names must not collide
+// with the mounted ones.
+func New(tools *mcp.ToolRegistry, resources *mcp.ResourceRegistry) *Proxy {
+	return &Proxy{tools: tools, resources: resources}
+}
+
+// mount is one upstream's presence in the local registries. Only the goroutine running it
+// touches its maps once Mount has returned.
+type mount struct {
+	p    *Proxy
+	up   Upstream
+	caps mcp.ServerCapabilities
+
+	tools     map[string]mcp.Tool     // upstream name -> tool as last exported
+	resources map[string]mcp.Resource // upstream URI -> resource as last exported
+}
+
+// Mount exports up's tools and resources and keeps them in sync until ctx is done, when
+// they are unregistered again. It returns once the initial export is complete, or with
+// the error that prevented it.
+func (p *Proxy) Mount(ctx context.Context, up Upstream) error {
+	disc, err := up.Client.Discover(ctx)
+	if err != nil {
+		return err
+	}
+	m := &mount{
+		p:         p,
+		up:        up,
+		caps:      disc.Capabilities,
+		tools:     map[string]mcp.Tool{},
+		resources: map[string]mcp.Resource{},
+	}
+
+	notes, stop, err := m.open(ctx)
+	if err != nil {
+		m.unmount()
+		return err
+	}
+	go m.run(ctx, notes, stop)
+	return nil
+}
+
+// open opens a subscriptions/listen stream and then syncs, so that nothing changing in
+// between goes unnoticed. If the sync changed which resources there are to watch, it
+// opens a second stream subscribed to them before closing the first.
+func (m *mount) open(ctx context.Context) (<-chan mcpclient.Notification, context.CancelFunc, error) {
+	listenCtx, stop := context.WithCancel(ctx)
+	notes, err := m.listen(listenCtx)
+	var changed bool
+	if err == nil {
+		changed, err = m.sync(ctx)
+	}
+	if err == nil && changed {
+		first := stop
+		listenCtx, stop = context.WithCancel(ctx)
+		notes, err = m.listen(listenCtx)
+		first()
+	}
+	if err != nil {
+		stop()
+		return nil, nil, err
+	}
+	return notes, stop, nil
+}
+
+// run applies upstream notifications until ctx is done, reopening the listen stream when
+// the upstream ends it or when the set of resources to watch changes.
+func (m *mount) run(ctx context.Context, notes <-chan mcpclient.Notification, stop context.CancelFunc) {
+	defer m.unmount()
+	for {
+		resubscribe := m.consume(ctx, notes)
+		stop()
+		for range notes {
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if !resubscribe {
+			logging.Warn("Upstream listen stream ended", "upstream", m.up.Name)
+			select {
+			case <-time.After(relistenDelay):
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		var err error
+		if notes, stop, err = m.open(ctx); err != nil {
+			// Notifications may have been missed while no stream was open, so keep trying.
+			logging.Warn("Upstream resync failed", "upstream", m.up.Name, "error", err)
+			closed := make(chan mcpclient.Notification)
+			close(closed)
+			notes, stop = closed, func() {}
+		}
+	}
+}
+
+// consume handles notes until the stream closes, returning true if it stopped early
+// because the resources to watch changed.
+func (m *mount) consume(ctx context.Context, notes <-chan mcpclient.Notification) bool {
+	for n := range notes {
+		var err error
+		switch n.Method {
+		case "notifications/tools/list_changed":
+			err = m.syncTools(ctx)
+		case "notifications/resources/list_changed":
+			var changed bool
+			if changed, err = m.syncResources(ctx); err == nil && changed {
+				return true
+			}
+		case "notifications/resources/updated":
+			var params struct {
+				URI string `json:"uri"`
+			}
+			if json.Unmarshal(n.Params, &params) == nil {
+				if _, ok := m.resources[params.URI]; ok {
+					m.p.resources.NotifyUpdated(m.up.URIPrefix + params.URI)
+				}
+			}
+		}
+		if err != nil {
+			logging.Warn("Upstream resync failed", "upstream", m.up.Name, "method", n.Method, "error", err)
+		}
+	}
+	return false
+}
+
+// listen opens a subscriptions/listen stream for everything the mount mirrors.
+func (m *mount) listen(ctx context.Context) (<-chan mcpclient.Notification, error) {
+	filter := mcp.NotificationFilter{
+		ToolsListChanged:     m.caps.Tools != nil,
+		ResourcesListChanged: m.caps.Resources != nil,
+	}
+	for uri := range m.resources {
+		filter.ResourceSubscriptions = append(filter.ResourceSubscriptions, uri)
+	}
+	return m.up.Client.Listen(ctx, filter)
+}
+
+// sync runs syncTools and syncResources, reporting whether the set of resource URIs
+// changed.
+func (m *mount) sync(ctx context.Context) (bool, error) {
+	if err := m.syncTools(ctx); err != nil {
+		return false, err
+	}
+	return m.syncResources(ctx)
+}
+
+// syncTools brings the exported tools in line with the upstream's list, touching only
+// those that were added, changed or removed.
+func (m *mount) syncTools(ctx context.Context) error {
+	if m.caps.Tools == nil {
+		return nil
+	}
+	tools, err := m.up.Client.ListTools(ctx)
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool, len(tools))
+	for _, tool := range tools {
+		seen[tool.Name] = true
+		if old, ok := m.tools[tool.Name]; ok && reflect.DeepEqual(old, tool) {
+			continue
+		}
+		m.tools[tool.Name] = tool
+		local := tool
+		local.Name = m.up.ToolPrefix + tool.Name
+		m.p.tools.RegisterForwarded(local, m.callTool(tool.Name))
+	}
+	for name := range m.tools {
+		if !seen[name] {
+			delete(m.tools, name)
+			m.p.tools.Unregister(m.up.ToolPrefix + name)
+		}
+	}
+	return nil
+}
+
+// syncResources is syncTools for resources, also reporting whether the set of URIs
+// changed.
+func (m *mount) syncResources(ctx context.Context) (bool, error) {
+	if m.caps.Resources == nil {
+		return false, nil
+	}
+	resources, err := m.up.Client.ListResources(ctx)
+	if err != nil {
+		return false, err
+	}
+	changed := false
+	seen := make(map[string]bool, len(resources))
+	for _, res := range resources {
+		seen[res.URI] = true
+		old, ok := m.resources[res.URI]
+		if ok && reflect.DeepEqual(old, res) {
+			continue
+		}
+		changed = changed || !ok
+		m.resources[res.URI] = res
+		local := res
+		local.URI = m.up.URIPrefix + res.URI
+		m.p.resources.RegisterForwarded(local, m.readResource(res.URI))
+	}
+	for uri := range m.resources {
+		if !seen[uri] {
+			changed = true
+			delete(m.resources, uri)
+			m.p.resources.Unregister(m.up.URIPrefix + uri)
+		}
+	}
+	return changed, nil
+}
+
+// unmount removes everything the mount exported.
+func (m *mount) unmount() {
+	for name := range m.tools {
+		m.p.tools.Unregister(m.up.ToolPrefix + name)
+	}
+	for uri := range m.resources {
+		m.p.resources.Unregister(m.up.URIPrefix + uri)
+	}
+}
+
+// callTool returns the function forwarding calls of the upstream tool name.
+func (m *mount) callTool(name string) mcp.ToolFunction {
+	return func(ctx context.Context, req *mcp.ToolRequest) (mcp.Result, error) {
+		args := req.Arguments
+		if len(args) == 0 {
+			args = json.RawMessage("{}")
+		}
+		params := forwardParams(req.ClientCapabilities, req.InputResponses, req.RequestState)
+		params["name"] = name
+		params["arguments"] = args
+
+		var raw json.RawMessage
+		if err := m.up.Client.Call(ctx, "tools/call", params, &raw); err != nil {
+			return nil, err
+		}
+		if ir, ok, err := inputRequired(raw); ok || err != nil {
+			return ir, err
+		}
+		var res mcp.ToolCallResult
+		if err := json.Unmarshal(raw, &res); err != nil {
+			return nil, err
+		}
+		return &res, nil
+	}
+}
+
+// readResource returns the function forwarding reads of the upstream resource uri.
+func (m *mount) readResource(uri string) mcp.ResourceReadFunction {
+	return func(ctx context.Context, req *mcp.ResourceRequest) (mcp.ResourceContentResult, error) {
+		params := forwardParams(req.ClientCapabilities, req.InputResponses, req.RequestState)
+		params["uri"] = uri
+		if req.KnownVersion != "" {
+			// Ask upstream for a conditional read, so an unchanged resource stays unsent.
+			params["_meta"].(map[string]interface{})[mcp.MetaKeyResourceVersion] = req.KnownVersion
+		}
+
+		var raw json.RawMessage
+		if err := m.up.Client.Call(ctx, "resources/read", params, &raw); err != nil {
+			return mcp.ResourceContentResult{}, err
+		}
+		if ir, ok, err := inputRequired(raw); ok || err != nil {
+			return mcp.InputRequiredContent(ir), err
+		}
+		var res mcp.ResourcesReadResult
+		if err := json.Unmarshal(raw, &res); err != nil {
+			return mcp.ResourceContentResult{}, err
+		}
+		version, _ := res.Meta[mcp.MetaKeyResourceVersion].(string)
+		if notModified, _ := res.Meta[mcp.MetaKeyNotModified].(bool); notModified {
+			// Content-free: the local server answers not-modified on seeing the version.
+			return mcp.ResourceContentResult{Version: version}, nil
+		}
+		if len(res.Contents) == 0 {
+			return mcp.ResourceContentResult{}, errors.New("mcpproxy: upstream returned no contents for " + uri)
+		}
+		for i := range res.Contents {
+			res.Contents[i].URI = m.up.URIPrefix + res.Contents[i].URI
+		}
+		content := mcp.MultiContent(res.Contents...)
+		content.Version = version
+		return content, nil
+	}
+}
+
+// forwardParams starts the params of a forwarded request: the downstream client's
+// capabilities stand in for the proxy's own, since it is that client that will answer
+// any input request, and an MRTR retry's inputResponses and requestState go upstream
+// untouched — the state is the upstream's, signed by it and opaque to the proxy.
+func forwardParams(caps *mcp.ClientCapabilities, responses mcp.InputResponses, state string) map[string]interface{} {
+	if caps == nil {
+		caps = &mcp.ClientCapabilities{}
+	}
+	params := map[string]interface{}{
+		"_meta": map[string]interface{}{"io.modelcontextprotocol/clientCapabilities": caps},
+	}
+	if state != "" {
+		params["requestState"] = state
+	}
+	if responses != nil {
+		params["inputResponses"] = responses
+	}
+	return params
+}
+
+// inputRequired decodes raw as an input_required result, reporting false if it is
+// anything else.
+func inputRequired(raw json.RawMessage) (*mcp.InputRequiredResult, bool, error) {
+	var ir mcp.InputRequiredResult
+	if err := json.Unmarshal(raw, &ir); err != nil {
+		return nil, false, err
+	}
+	if ir.ResultType != mcp.ResultTypeInputRequired {
+		return nil, false, nil
+	}
+	return mcp.NewInputRequiredResult(ir.InputRequests, ir.RequestState), true, nil
+}
@@ -0,0 +1,147 @@
+package mcpproxy
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/spirilis/generic-go-mcp/mcp"
+	"github.com/spirilis/generic-go-mcp/mcpclient"
+	"github.com/spirilis/generic-go-mcp/transport"
+)
+
+// connect serves srv over an in-memory transport and returns a client for it.
+func connect(t *testing.T, srv *mcp.Server, opts *mcpclient.Options) *mcpclient.Client {
+	t.Helper()
+	tr := transport.NewInMemoryTransport()
+	tr.Start(srv)
+	t.Cleanup(func() { tr.Stop() })
+	conn, err := tr.Connect()
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	c := mcpclient.NewInMemoryClient(conn, opts)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func elicitAccept(ctx context.Context, p mcp.ElicitRequestParams) (mcp.ElicitResult, error) {
+	return mcp.ElicitResult{Action: "accept", Content: json.RawMessage(`{}`)}, nil
+}
+
+// waitFor polls cond until it holds or the test's patience runs out.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestProxyMountsUpstreamToolsAndResources(t *testing.T) {
+	upTools := mcp.NewToolRegistry()
+	upTools.Register(mcp.Tool{Name: "echo", InputSchema: json.RawMessage(`{"type":"object"}`)},
+		func(ctx context.Context, req *mcp.ToolRequest) (mcp.Result, error) {
+			return &mcp.ToolCallResult{Content: []mcp.Content{mcp.Text(string(req.Arguments))}}, nil
+		})
+	upTools.Register(mcp.Tool{Name: "confirm", InputSchema: json.RawMessage(`{"type":"object"}`)},
+		func(ctx context.Context, req *mcp.ToolRequest) (mcp.Result, error) {
+			if v, ok := req.ElicitResponse("ok"); ok {
+				return &mcp.ToolCallResult{Content: []mcp.Content{mcp.Text("answer: " + v.Action)}}, nil
+			}
+			return req.NeedInput(mcp.InputRequests{
+				"ok": mcp.NewElicitRequest("form", "proceed?", json.RawMessage(`{"type":"object"}`)),
+			})
+		})
+	upResources := mcp.NewResourceRegistry()
+	upResources.Register(mcp.Resource{URI: "test:///hello", Name: "hello"}, func(ctx context.Context) (mcp.ResourceContentResult, error) {
+		return mcp.ResourceContentResult{Text: "hello", MimeType: "text/plain"}, nil
+	})
+	upstream := connect(t, mcp.NewServer(upTools, upResources, nil), nil)
+
+	tools, resources := mcp.NewToolRegistry(), mcp.NewResourceRegistry()
+	mountCtx, unmount := context.WithCancel(context.Background())
+	defer unmount()
+	err := New(tools, resources).Mount(mountCtx, Upstream{Name: "up", Client: upstream, ToolPrefix: "up_", URIPrefix: "up+"})
+	if err != nil {
+		t.Fatalf("Mount: %v", err)
+	}
+	client := connect(t, mcp.NewServer(tools, resources, nil), &mcpclient.Options{Elicit: elicitAccept})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := client.CallTool(ctx, "up_echo", map[string]string{"x": "1"})
+	if err != nil || len(res.Content) != 1 || res.Content[0].Text != `{"x":"1"}` {
+		t.Fatalf("CallTool up_echo = %+v, %v", res, err)
+	}
+
+	// The upstream signs and later verifies its own requestState, so this only succeeds
+	// if the proxy relays inputRequests and requestState untouched.
+	res, err = client.CallTool(ctx, "up_confirm", nil)
+	if err != nil || res.Content[0].Text != "answer: accept" {
+		t.Fatalf("CallTool up_confirm through MRTR = %+v, %v", res, err)
+	}
+
+	read, err := client.ReadResource(ctx, "up+test:///hello")
+	if err != nil || len(read.Contents) != 1 || read.Contents[0].Text != "hello" {
+		t.Fatalf("ReadResource up+test:///hello = %+v, %v", read, err)
+	}
+
+	listenCtx, stopListen := context.WithCancel(ctx)
+	defer stopListen()
+	notes, err := client.Listen(listenCtx, mcp.NotificationFilter{
+		ToolsListChanged:      true,
+		ResourceSubscriptions: []string{"up+test:///hello"},
+	})
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+
+	upTools.Register(mcp.Tool{Name: "late", InputSchema: json.RawMessage(`{"type":"object"}`)},
+		func(ctx context.Context, req *mcp.ToolRequest) (mcp.Result, error) {
+			return &mcp.ToolCallResult{Content: []mcp.Content{mcp.Text("late")}}, nil
+		})
+	waitFor(t, "up_late to be exported", func() bool {
+		_, ok := tools.Get("up_late")
+		return ok
+	})
+	upResources.NotifyUpdated("test:///hello")
+
+	var sawListChanged, sawUpdated bool
+	for !sawListChanged || !sawUpdated {
+		select {
+		case n := <-notes:
+			switch n.Method {
+			case "notifications/tools/list_changed":
+				sawListChanged = true
+			case "notifications/resources/updated":
+				var p struct {
+					URI string `json:"uri"`
+				}
+				_ = json.Unmarshal(n.Params, &p)
+				if p.URI != "up+test:///hello" {
+					t.Errorf("resources/updated for %q, want the rewritten URI", p.URI)
+				}
+				sawUpdated = true
+			}
+		case <-ctx.Done():
+			t.Fatalf("list_changed seen %v, resources/updated seen %v; want both", sawListChanged, sawUpdated)
+		}
+	}
+
+	upTools.Unregister("echo")
+	waitFor(t, "up_echo to be withdrawn", func() bool {
+		_, ok := tools.Get("up_echo")
+		return !ok
+	})
+
+	unmount()
+	waitFor(t, "the mount to be removed", func() bool {
+		return len(tools.List()) == 0 && !resources.HasResources()
+	})
+}
@@ -14,8 +14,19 @@ const (
 	// ParamHeaderPrefix is prepended to a tool's x-mcp-header name to form the header that
 	// carries that parameter's value, e.g. x-mcp-header "Region" -> "Mcp-Param-Region".
 	ParamHeaderPrefix = "Mcp-Param-"
+
+	// IfNoneMatchHeader on a resources/read names the resource version the client already
+	// has, as an entity tag; ETagHeader on the response names the version it got. See
+	// MetaKeyResourceVersion, the _meta field both mirror.
+	IfNoneMatchHeader = "If-None-Match"
+	ETagHeader        = "ETag"
 )
 
+// MetaKeyResourceVersion is the _meta key carrying a resource's version on a
+// resources/read request and result. It is defined here, where the Streamable HTTP
+// binding maps it to ETag and If-None-Match, and re-exported as mcp.MetaKeyResourceVersion.
+const MetaKeyResourceVersion = "io.github.spirilis/resourceVersion"
+
 const (
 	base64SentinelPrefix = "=?base64?"
 	base64SentinelSuffix = "?="
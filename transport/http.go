@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/url"
 	"reflect"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -87,7 +88,8 @@ func (r *responseRecorder) Flush() {
 	}
 }
 
-// HTTPTransportConfig holds configuration for HTTP transport
+// HTTPTransportConfig holds configuration for HTTP transport, and for the handlers
+// NewMCPHandler and NewAuthHandler build from it (which ignore Host and Port).
 type HTTPTransportConfig struct {
 	Host        string
 	Port        int
@@ -100,17 +102,83 @@ type HTTPTransportConfig struct {
 	// port) — appropriate for a server bound to loopback. Set to []string{"*"} to allow
 	// any origin (e.g. behind a trusted reverse proxy that already restricts access).
 	AllowedOrigins []string
+
+	// WebSocketPath, if set (e.g. "/mcp/ws"), also serves the WebSocket binding there, for
+	// clients that can hold a WebSocket open but not make per-request POSTs. Upgrades pass
+	// the same Origin check and auth middleware as /mcp. See handleWebSocket. It must
+	// start with "/" and may not be "/mcp" or, with auth enabled, "/" or one of the auth
+	// service's routes; an AuthService with a Routes() []string method (such as
+	// *auth.AuthService) is checked against them.
+	WebSocketPath string
+
+	// PathPrefix, if set (e.g. "/api/v1"), moves every route under it: the endpoint to
+	// PathPrefix+"/mcp", the WebSocket binding to PathPrefix+WebSocketPath, and the OAuth
+	// routes to PathPrefix+"/authorize" and so on. It must start with "/" and not end with
+	// one. The auth service advertises its routes relative to its issuer URL, so with auth
+	// enabled that must end in PathPrefix too; an AuthService with an Issuer() string
+	// method (such as *auth.AuthService) is checked for it.
+	PathPrefix string
+}
+
+// checkPathPrefix reports a PathPrefix that cannot be joined into routes, or that the
+// auth service's issuer URL does not end in.
+func (c HTTPTransportConfig) checkPathPrefix() error {
+	if c.PathPrefix == "" {
+		return nil
+	}
+	if !strings.HasPrefix(c.PathPrefix, "/") || strings.HasSuffix(c.PathPrefix, "/") {
+		return fmt.Errorf("path prefix %q must start with '/' and not end with one", c.PathPrefix)
+	}
+	if isNilAuthProvider(c.AuthService) {
+		return nil
+	}
+	if ip, ok := c.AuthService.(interface{ Issuer() string }); ok {
+		u, err := url.Parse(ip.Issuer())
+		if err != nil || !strings.HasSuffix(strings.TrimSuffix(u.Path, "/"), c.PathPrefix) {
+			return fmt.Errorf("auth issuer %q must end in the path prefix %q", ip.Issuer(), c.PathPrefix)
+		}
+	}
+	return nil
+}
+
+// checkWebSocketPath reports a WebSocketPath that is not a path, or that collides with a
+// route served next to it: /mcp, or with auth enabled the auth handler's mount point and
+// routes.
+func (c HTTPTransportConfig) checkWebSocketPath() error {
+	if c.WebSocketPath == "" {
+		return nil
+	}
+	if !strings.HasPrefix(c.WebSocketPath, "/") {
+		return fmt.Errorf("websocket path %q must start with '/'", c.WebSocketPath)
+	}
+	if c.WebSocketPath == "/mcp" {
+		return fmt.Errorf("websocket path must differ from the /mcp endpoint")
+	}
+	if isNilAuthProvider(c.AuthService) {
+		return nil
+	}
+	routes := []string{"/"}
+	if rp, ok := c.AuthService.(interface{ Routes() []string }); ok {
+		routes = append(routes, rp.Routes()...)
+	}
+	if slices.Contains(routes, c.WebSocketPath) {
+		return fmt.Errorf("websocket path %q collides with an auth route", c.WebSocketPath)
+	}
+	return nil
 }
 
 // HTTPTransport implements Transport using the stateless Streamable HTTP binding
 // (2026-07-28): a single POST-only /mcp endpoint, no protocol-level sessions, no GET/DELETE.
+// It is a thin wrapper serving an MCPHandler, and the auth routes if auth is enabled,
+// from an http.Server of its own; to add MCP to a server you already have, mount those
+// handlers on it instead.
 type HTTPTransport struct {
-	config      HTTPTransportConfig
-	handler     MessageHandler
-	server      *http.Server
-	stopCh      chan struct{}
-	wg          sync.WaitGroup
-	authService AuthProvider
+	config   HTTPTransportConfig
+	handler  MessageHandler
+	endpoint *MCPHandler
+	server   *http.Server
+	stopCh   chan struct{}
+	wg       sync.WaitGroup
 }
 
 // NewHTTPTransport creates a new HTTP transport
@@ -123,37 +191,36 @@ func NewHTTPTransport(config HTTPTransportConfig) *HTTPTransport {
 		config.Port = 8080
 	}
 
-	authService := config.AuthService
-	if isNilAuthProvider(authService) {
-		// Guard against a typed-nil AuthProvider (e.g. a caller assigning a nil
-		// *auth.AuthService unconditionally) — treat it the same as auth disabled.
-		authService = nil
-	}
-
 	return &HTTPTransport{
-		config:      config,
-		stopCh:      make(chan struct{}),
-		authService: authService,
+		config: config,
+		stopCh: make(chan struct{}),
 	}
 }
 
 // Start begins the HTTP server
 func (t *HTTPTransport) Start(handler MessageHandler) error {
+	endpoint, err := NewMCPHandler(handler, t.config)
+	if err != nil {
+		return err
+	}
+	auth, err := NewAuthHandler(t.config)
+	if err != nil {
+		return err
+	}
 	t.handler = handler
+	t.endpoint = endpoint
 
 	mux := http.NewServeMux()
-
-	// Register auth endpoints if auth is enabled
-	if t.authService != nil {
-		t.authService.RegisterRoutes(mux)
-		t.authService.RegisterAdminRoutes(mux)
-
-		// Wrap /mcp with auth middleware
-		mux.Handle("/mcp", t.authService.Middleware(http.HandlerFunc(t.handleMCP)))
+	if auth != nil {
+		mux.Handle(t.config.PathPrefix+"/", auth)
+		if t.config.PathPrefix != "" {
+			mux.Handle("/.well-known/", auth)
+		}
 		logging.Info("OAuth authentication enabled")
-	} else {
-		// No auth - direct handler
-		mux.HandleFunc("/mcp", t.handleMCP)
+	}
+	mux.Handle(t.config.PathPrefix+"/mcp", t.endpoint)
+	if t.config.WebSocketPath != "" {
+		mux.Handle(t.config.PathPrefix+t.config.WebSocketPath, t.endpoint)
 	}
 
 	t.server = &http.Server{
@@ -173,15 +240,30 @@ func (t *HTTPTransport) Start(handler MessageHandler) error {
 	return nil
 }
 
-// Stop gracefully stops the HTTP server
+// Stop gracefully stops the HTTP server: the handler is shut down first (see
+// Shutdowner), so each subscriptions/listen stream ends with its final response, and
+// then the server stops, letting responses still being written finish for up to
+// ShutdownTimeout before closing what remains. WebSocket connections are closed last,
+// with status 1001 (going away).
 func (t *HTTPTransport) Stop() error {
 	close(t.stopCh)
 
+	if t.handler != nil {
+		shutdownHandler("http", t.handler)
+	}
 	if t.server != nil {
-		if err := t.server.Close(); err != nil {
-			return err
+		ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+		err := t.server.Shutdown(ctx)
+		cancel()
+		if err != nil {
+			if err := t.server.Close(); err != nil {
+				return err
+			}
 		}
 	}
+	if t.endpoint != nil {
+		t.endpoint.Close()
+	}
 
 	t.wg.Wait()
 	return nil
@@ -191,14 +273,14 @@ func (t *HTTPTransport) Stop() error {
 // defined operation in this protocol revision; GET and DELETE (session lifecycle from
 // earlier revisions) are rejected with 405, per the 2026-07-28 backward-compatibility
 // guidance for a server that supports only this revision.
-func (t *HTTPTransport) handleMCP(w http.ResponseWriter, r *http.Request) {
+func (h *MCPHandler) handleMCP(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 
 	// Wrap response writer to capture details
 	recorder := newResponseRecorder(w)
 
 	origin := r.Header.Get("Origin")
-	if !t.originAllowed(origin) {
+	if !h.originAllowed(origin) {
 		logging.Warn("HTTP request rejected: origin not allowed", "origin", origin, "remote_addr", r.RemoteAddr)
 		recorder.Header().Set("Content-Type", "application/json")
 		recorder.WriteHeader(http.StatusForbidden)
@@ -206,7 +288,7 @@ func (t *HTTPTransport) handleMCP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	t.setCORSHeaders(recorder, r, origin)
+	h.setCORSHeaders(recorder, r, origin)
 
 	if r.Method == http.MethodOptions {
 		recorder.WriteHeader(http.StatusOK)
@@ -225,7 +307,7 @@ func (t *HTTPTransport) handleMCP(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case http.MethodPost:
-		t.handlePost(recorder, r)
+		h.handlePost(recorder, r)
 	default:
 		// GET, DELETE, and anything else: no such operation in this revision (no
 		// sessions, no standalone SSE stream, no session teardown).
@@ -248,8 +330,8 @@ func (t *HTTPTransport) handleMCP(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Add user info if available
-		if t.authService != nil {
-			if id, login, ok := t.authService.UserFromContext(r.Context()); ok {
+		if h.authService != nil {
+			if id, login, ok := h.authService.UserFromContext(r.Context()); ok {
 				logArgs = append(logArgs, "user_id", id, "github_login", login)
 			}
 		}
@@ -266,14 +348,14 @@ func (t *HTTPTransport) handleMCP(w http.ResponseWriter, r *http.Request) {
 // originAllowed implements the Origin validation the Streamable HTTP binding requires to
 // prevent DNS rebinding. A request without an Origin header (i.e. not issued by a
 // browser) is always allowed — there is nothing to rebind.
-func (t *HTTPTransport) originAllowed(origin string) bool {
+func (h *MCPHandler) originAllowed(origin string) bool {
 	if origin == "" {
 		return true
 	}
-	if len(t.config.AllowedOrigins) == 0 {
+	if len(h.config.AllowedOrigins) == 0 {
 		return isDefaultLocalOrigin(origin)
 	}
-	for _, allowed := range t.config.AllowedOrigins {
+	for _, allowed := range h.config.AllowedOrigins {
 		if allowed == "*" || strings.EqualFold(allowed, origin) {
 			return true
 		}
@@ -294,19 +376,20 @@ func isDefaultLocalOrigin(origin string) bool {
 	}
 }
 
-func (t *HTTPTransport) setCORSHeaders(w http.ResponseWriter, r *http.Request, origin string) {
+func (h *MCPHandler) setCORSHeaders(w http.ResponseWriter, r *http.Request, origin string) {
 	if origin != "" {
 		w.Header().Set("Access-Control-Allow-Origin", origin)
 		w.Header().Set("Vary", "Origin")
-	} else if len(t.config.AllowedOrigins) == 1 && t.config.AllowedOrigins[0] == "*" {
+	} else if len(h.config.AllowedOrigins) == 1 && h.config.AllowedOrigins[0] == "*" {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 	}
 	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Expose-Headers", ETagHeader)
 	if reqHeaders := r.Header.Get("Access-Control-Request-Headers"); reqHeaders != "" {
 		w.Header().Set("Access-Control-Allow-Headers", reqHeaders)
 	} else {
 		w.Header().Set("Access-Control-Allow-Headers",
-			"Content-Type, Accept, Authorization, "+ProtocolVersionHeader+", "+MethodHeader+", "+NameHeader)
+			"Content-Type, Accept, Authorization, "+ProtocolVersionHeader+", "+MethodHeader+", "+NameHeader+", "+IfNoneMatchHeader)
 	}
 }
 
@@ -324,7 +407,7 @@ type reqParamsPeek struct {
 // match the request body. Callers MUST NOT invoke this for "initialize" requests: legacy
 // clients don't send these headers at all, and the caller is expected to let those
 // through to the handler's own diagnostic instead of rejecting them here.
-func (t *HTTPTransport) validateHeaders(r *http.Request, req JSONRPCRequest) error {
+func (h *MCPHandler) validateHeaders(r *http.Request, req JSONRPCRequest) error {
 	pv := r.Header.Get(ProtocolVersionHeader)
 	if pv == "" {
 		return fmt.Errorf("missing required header %s", ProtocolVersionHeader)
@@ -400,6 +483,7 @@ func collectHeaders(r *http.Request) RequestHeaders {
 		if strings.HasPrefix(name, ParamHeaderPrefix) ||
 			strings.EqualFold(name, NameHeader) ||
 			strings.EqualFold(name, MethodHeader) ||
+			strings.EqualFold(name, IfNoneMatchHeader) ||
 			strings.EqualFold(name, ProtocolVersionHeader) {
 			values[name] = vals[0]
 		}
@@ -424,7 +508,7 @@ func (discardResponseWriter) WriteNotification(string, interface{}) error { retu
 func (discardResponseWriter) WriteMessage([]byte) error                   { return nil }
 
 // handlePost handles POST requests, the only operation this transport defines.
-func (t *HTTPTransport) handlePost(w http.ResponseWriter, r *http.Request) {
+func (h *MCPHandler) handlePost(w http.ResponseWriter, r *http.Request) {
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		writeHTTPError(w, http.StatusBadRequest, nil, ParseError, "Failed to read request body")
@@ -446,7 +530,7 @@ func (t *HTTPTransport) handlePost(w http.ResponseWriter, r *http.Request) {
 	// UnsupportedProtocolVersion/MethodNotFound naming the versions we do support; that
 	// error's code maps to the correct HTTP status via HTTPStatusForRPCError below.
 	if req.Method != "initialize" {
-		if verr := t.validateHeaders(r, req); verr != nil {
+		if verr := h.validateHeaders(r, req); verr != nil {
 			logging.Debug("HTTP header validation failed", "error", verr, "remote_addr", r.RemoteAddr)
 			writeHTTPError(w, http.StatusBadRequest, req.ID, HeaderMismatch, verr.Error())
 			return
@@ -456,14 +540,15 @@ func (t *HTTPTransport) handlePost(w http.ResponseWriter, r *http.Request) {
 	ctx := WithRequestHeaders(r.Context(), collectHeaders(r))
 
 	if req.IsNotification() {
-		t.handler.HandleMessage(ctx, body, discardResponseWriter{})
+		h.handler.HandleMessage(ctx, body, discardResponseWriter{})
 		w.WriteHeader(http.StatusAccepted)
 		return
 	}
 
 	rw := newHTTPResponseWriter(w)
+	rw.etag = req.Method == "resources/read"
 	defer rw.closeDone()
-	t.handler.HandleMessage(ctx, body, rw)
+	h.handler.HandleMessage(ctx, body, rw)
 }
 
 // httpResponseWriter implements ResponseWriter over a single HTTP response: the first
@@ -475,6 +560,7 @@ type httpResponseWriter struct {
 	flusher http.Flusher
 	started bool
 	sse     bool
+	etag    bool // a resources/read, whose result may carry a version to send as the ETag
 	once    sync.Once
 	done    chan struct{}
 }
@@ -549,6 +635,11 @@ func (rw *httpResponseWriter) WriteMessage(data []byte) error {
 		if code, ok := rpcErrorCode(data); ok {
 			status = HTTPStatusForRPCError(code)
 		}
+		if rw.etag {
+			if version, ok := resultVersion(data); ok {
+				rw.w.Header().Set(ETagHeader, `"`+version+`"`)
+			}
+		}
 		rw.w.Header().Set("Content-Type", "application/json")
 		rw.w.WriteHeader(status)
 		rw.started = true
@@ -577,6 +668,25 @@ func rpcErrorCode(data []byte) (int, bool) {
 	return env.Error.Code, true
 }
 
+// resultVersion extracts the resource version a resources/read result carries in its
+// _meta, if any, to send as the response's ETag. A not-modified result is still answered
+// 200 with its JSON-RPC body rather than 304, which could carry none.
+func resultVersion(data []byte) (string, bool) {
+	var env struct {
+		Result *struct {
+			Meta map[string]json.RawMessage `json:"_meta"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(data, &env); err != nil || env.Result == nil {
+		return "", false
+	}
+	v, ok := stringFromRaw(env.Result.Meta[MetaKeyResourceVersion])
+	if !ok || strings.ContainsAny(v, "\"\r\n") {
+		return "", false
+	}
+	return v, true
+}
+
 func (rw *httpResponseWriter) writeSSEEventLocked(data []byte) error {
 	if _, err := fmt.Fprintf(rw.w, "data: %s\n\n", data); err != nil {
 		return err
@@ -10,7 +10,7 @@ import (
 	"testing"
 )
 
-// fakeHandler is a minimal MessageHandler for exercising HTTPTransport's request
+// fakeHandler is a minimal MessageHandler for exercising MCPHandler's request
 // validation and response-shape logic without a real MCP server behind it.
 type fakeHandler struct {
 	fn func(ctx context.Context, data []byte, w ResponseWriter)
@@ -22,13 +22,15 @@ func (h *fakeHandler) HandleMessage(ctx context.Context, data []byte, w Response
 	}
 }
 
-func newTestTransport(handler MessageHandler) *HTTPTransport {
-	tr := NewHTTPTransport(HTTPTransportConfig{})
-	tr.handler = handler
-	return tr
+func newTestTransport(handler MessageHandler) *MCPHandler {
+	h, err := NewMCPHandler(handler, HTTPTransportConfig{})
+	if err != nil {
+		panic(err)
+	}
+	return h
 }
 
-func doRequest(tr *HTTPTransport, req *http.Request) *http.Response {
+func doRequest(tr *MCPHandler, req *http.Request) *http.Response {
 	rec := httptest.NewRecorder()
 	tr.handleMCP(rec, req)
 	return rec.Result()
@@ -192,6 +194,45 @@ func TestPlainResultIsApplicationJSON(t *testing.T) {
 	}
 }
 
+func TestResourceVersionMapsToETagAndIfNoneMatch(t *testing.T) {
+	var gotHeader string
+	tr := newTestTransport(&fakeHandler{fn: func(ctx context.Context, data []byte, w ResponseWriter) {
+		h, _ := HeadersFromContext(ctx)
+		gotHeader, _ = h.Get(IfNoneMatchHeader)
+		w.WriteMessage(NewSuccessResponse(json.RawMessage(`1`), map[string]interface{}{
+			"contents": []interface{}{},
+			"_meta":    map[string]interface{}{MetaKeyResourceVersion: "v2"},
+		}))
+	}})
+
+	body := fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"resources/read","params":{"uri":"test:///r",%s}}`, validMetaJSON)
+	req := httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(body))
+	req.Header.Set(ProtocolVersionHeader, "2026-07-28")
+	req.Header.Set(MethodHeader, "resources/read")
+	req.Header.Set(NameHeader, "test:///r")
+	req.Header.Set(IfNoneMatchHeader, `"v1"`)
+
+	resp := doRequest(tr, req)
+	if gotHeader != `"v1"` {
+		t.Errorf("handler saw If-None-Match %q, want it passed through", gotHeader)
+	}
+	if etag := resp.Header.Get(ETagHeader); etag != `"v2"` {
+		t.Errorf("ETag = %q, want the result's version quoted", etag)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+
+	// Only a resources/read result is looked into for a version.
+	body = fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"tools/list","params":{%s}}`, validMetaJSON)
+	req = httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(body))
+	req.Header.Set(ProtocolVersionHeader, "2026-07-28")
+	req.Header.Set(MethodHeader, "tools/list")
+	if etag := doRequest(tr, req).Header.Get(ETagHeader); etag != "" {
+		t.Errorf("ETag on tools/list = %q, want none", etag)
+	}
+}
+
 // TestErrorResponseMapsToCorrectHTTPStatus guards against a regression where
 // httpResponseWriter.WriteMessage always wrote 200 OK regardless of the JSON-RPC error
 // code inside the body: the Streamable HTTP binding requires specific error codes (e.g.
@@ -244,3 +285,145 @@ func TestNotificationBeforeResultUpgradesToSSE(t *testing.T) {
 		t.Fatalf("Content-Type = %q, want text/event-stream", ct)
 	}
 }
+
+// tokenAuth is an AuthProvider serving a /token route and admitting only "Bearer ok".
+type tokenAuth struct{ bearerAuth }
+
+func (tokenAuth) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("token route")) })
+	mux.HandleFunc("/.well-known/oauth-authorization-server", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("metadata route"))
+	})
+}
+
+func TestHandlersMountUnderPathPrefix(t *testing.T) {
+	config := HTTPTransportConfig{AuthService: tokenAuth{}, PathPrefix: "/api"}
+	auth, err := NewAuthHandler(config)
+	if err != nil {
+		t.Fatalf("NewAuthHandler: %v", err)
+	}
+	endpoint, err := NewMCPHandler(&fakeHandler{fn: func(ctx context.Context, data []byte, w ResponseWriter) {
+		w.WriteMessage(NewSuccessResponse(json.RawMessage(`1`), map[string]string{"ok": "true"}))
+	}}, config)
+	if err != nil {
+		t.Fatalf("NewMCPHandler: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/api/", auth)
+	mux.Handle("/.well-known/", auth)
+	mux.Handle("/api/mcp", endpoint)
+
+	post := func(path, origin string) *http.Response {
+		body := fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"tools/list","params":{%s}}`, validMetaJSON)
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set(ProtocolVersionHeader, "2026-07-28")
+		req.Header.Set(MethodHeader, "tools/list")
+		req.Header.Set("Authorization", "Bearer ok")
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec.Result()
+	}
+
+	if resp := post("/api/mcp", "http://localhost:5173"); resp.StatusCode != http.StatusOK ||
+		resp.Header.Get("Access-Control-Allow-Origin") != "http://localhost:5173" {
+		t.Errorf("POST /api/mcp = %d, CORS origin %q; want 200 with the origin echoed",
+			resp.StatusCode, resp.Header.Get("Access-Control-Allow-Origin"))
+	}
+	if resp := post("/api/mcp", "https://evil.example"); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("POST /api/mcp from a foreign origin = %d, want 403", resp.StatusCode)
+	}
+	if resp := post("/mcp", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("POST /mcp outside the prefix = %d, want 404", resp.StatusCode)
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/token", nil))
+	if rec.Body.String() != "token route" {
+		t.Errorf("POST /api/token = %d %q, want the auth service's /token route", rec.Code, rec.Body.String())
+	}
+	// RFC 8414 puts the issuer's path after the well-known segment, at the host root.
+	for _, path := range []string{"/api/.well-known/oauth-authorization-server", "/.well-known/oauth-authorization-server/api"} {
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Body.String() != "metadata route" {
+			t.Errorf("GET %s = %d %q, want the authorization server metadata", path, rec.Code, rec.Body.String())
+		}
+	}
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/oauth-authorization-server/other", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET a well-known URL for another prefix = %d, want 404", rec.Code)
+	}
+	unauthenticated := httptest.NewRequest(http.MethodPost, "/api/mcp", strings.NewReader(`{}`))
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, unauthenticated)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("unauthenticated POST /api/mcp = %d, want 401 from the auth middleware", rec.Code)
+	}
+
+	if h, err := NewAuthHandler(HTTPTransportConfig{}); h != nil || err != nil {
+		t.Errorf("NewAuthHandler without an AuthService = %v, %v; want nil, nil", h, err)
+	}
+}
+
+// issuerAuth is tokenAuth reporting an issuer URL, like *auth.AuthService.
+type issuerAuth struct {
+	tokenAuth
+	issuer string
+}
+
+func (a issuerAuth) Issuer() string { return a.issuer }
+
+func TestMalformedPathPrefixIsRejected(t *testing.T) {
+	for _, tc := range []struct {
+		prefix, issuer string
+		ok             bool
+	}{
+		{"/v1", "https://api.example.com/v1", true},
+		{"/v1", "https://api.example.com/v1/", true},
+		{"v1", "https://api.example.com/v1", false},
+		{"/v1/", "https://api.example.com/v1", false},
+		{"/v1", "https://api.example.com", false},
+		{"/v1", "https://api.example.com/v2", false},
+	} {
+		config := HTTPTransportConfig{PathPrefix: tc.prefix, AuthService: issuerAuth{issuer: tc.issuer}}
+		_, mcpErr := NewMCPHandler(&fakeHandler{}, config)
+		_, authErr := NewAuthHandler(config)
+		if (mcpErr == nil) != tc.ok || (authErr == nil) != tc.ok {
+			t.Errorf("prefix %q, issuer %q: NewMCPHandler = %v, NewAuthHandler = %v; want ok = %v",
+				tc.prefix, tc.issuer, mcpErr, authErr, tc.ok)
+		}
+	}
+	if _, err := NewMCPHandler(&fakeHandler{}, HTTPTransportConfig{PathPrefix: "v1"}); err == nil {
+		t.Error("NewMCPHandler without auth accepted the prefix \"v1\"")
+	}
+}
+
+// routesAuth is tokenAuth listing the routes it serves, like *auth.AuthService.
+type routesAuth struct{ tokenAuth }
+
+func (routesAuth) Routes() []string { return []string{"/token", "/admin/clients"} }
+
+func TestWebSocketPathCollisionsAreRejected(t *testing.T) {
+	for _, tc := range []struct {
+		path string
+		auth AuthProvider
+		ok   bool
+	}{
+		{"/mcp/ws", routesAuth{}, true},
+		{"/token", nil, true},
+		{"mcp/ws", nil, false},
+		{"/mcp", nil, false},
+		{"/", routesAuth{}, false},
+		{"/token", routesAuth{}, false},
+		{"/admin/clients", routesAuth{}, false},
+	} {
+		config := HTTPTransportConfig{WebSocketPath: tc.path, AuthService: tc.auth}
+		if _, err := NewMCPHandler(&fakeHandler{}, config); (err == nil) != tc.ok {
+			t.Errorf("WebSocketPath %q with auth %v: NewMCPHandler = %v; want ok = %v", tc.path, tc.auth != nil, err, tc.ok)
+		}
+	}
+}
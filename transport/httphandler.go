@@ -0,0 +1,138 @@
+package transport
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// MCPHandler serves the Streamable HTTP endpoint, and the WebSocket binding if
+// configured, as an http.Handler, for mounting in a server and router of your own: behind
+// your own TLS, middleware and routes. It applies the same Origin check, CORS headers,
+// header validation and auth middleware as HTTPTransport, which is built on it.
+//
+// It routes on the full request path, PathPrefix+"/mcp" (and PathPrefix+WebSocketPath),
+// answering anything else with 404, so mount it where those paths reach it unchanged:
+//
+//	mux.Handle(cfg.PathPrefix+"/mcp", endpoint)
+//
+// Before shutting the server down, shut the MessageHandler down if it is a Shutdowner,
+// so subscriptions end gracefully; then Close the MCPHandler, as http.Server.Shutdown
+// does not close WebSocket connections.
+type MCPHandler struct {
+	config      HTTPTransportConfig
+	handler     MessageHandler
+	authService AuthProvider
+	mux         http.Handler
+
+	closing   chan struct{}
+	closeOnce sync.Once
+	wsMu      sync.Mutex
+	wsConns   map[*wsConn]struct{}
+	wg        sync.WaitGroup
+}
+
+// NewMCPHandler returns an MCPHandler dispatching to handler. It fails if
+// config.PathPrefix is malformed or disagrees with the auth issuer, or if
+// config.WebSocketPath collides with /mcp or an auth route.
+func NewMCPHandler(handler MessageHandler, config HTTPTransportConfig) (*MCPHandler, error) {
+	if err := config.checkPathPrefix(); err != nil {
+		return nil, err
+	}
+	if err := config.checkWebSocketPath(); err != nil {
+		return nil, err
+	}
+	h := &MCPHandler{
+		config:      config,
+		handler:     handler,
+		authService: config.AuthService,
+		closing:     make(chan struct{}),
+	}
+	if isNilAuthProvider(h.authService) {
+		// Guard against a typed-nil AuthProvider (e.g. a caller assigning a nil
+		// *auth.AuthService unconditionally) — treat it the same as auth disabled.
+		h.authService = nil
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(config.PathPrefix+"/mcp", h.handleMCP)
+	if config.WebSocketPath != "" {
+		mux.HandleFunc(config.PathPrefix+config.WebSocketPath, h.handleWebSocket)
+	}
+	h.mux = mux
+	if h.authService != nil {
+		h.mux = h.authService.Middleware(mux)
+	}
+	return h, nil
+}
+
+func (h *MCPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// Close closes every open WebSocket connection with status 1001 (going away), refuses
+// new ones, and waits for their requests to return. The POST endpoint is unaffected.
+func (h *MCPHandler) Close() error {
+	h.closeOnce.Do(func() { close(h.closing) })
+	h.closeWebSockets()
+	h.wg.Wait()
+	return nil
+}
+
+// NewAuthHandler returns the OAuth and admin routes of config.AuthService under
+// config.PathPrefix, or nil if auth is not enabled. Like NewMCPHandler, it fails if
+// PathPrefix is malformed or disagrees with the auth issuer. Mount it at PathPrefix+"/" next to
+// the MCPHandler; the paths it serves are the auth service's, e.g. PathPrefix+"/token".
+//
+// With a PathPrefix, an RFC 8414 or RFC 9728 client looks for metadata at the host root
+// with the issuer's or resource's path appended, e.g.
+// /.well-known/oauth-authorization-server/v1. The handler answers those as well, so also
+// mount it at "/.well-known/".
+func NewAuthHandler(config HTTPTransportConfig) (http.Handler, error) {
+	if isNilAuthProvider(config.AuthService) {
+		return nil, nil
+	}
+	if err := config.checkPathPrefix(); err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	config.AuthService.RegisterRoutes(mux)
+	config.AuthService.RegisterAdminRoutes(mux)
+	if config.PathPrefix == "" {
+		return mux, nil
+	}
+	prefixed := http.StripPrefix(config.PathPrefix, mux)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if path, ok := wellKnownPath(r.URL.Path, config.PathPrefix); ok {
+			r2 := new(http.Request)
+			*r2 = *r
+			r2.URL = new(url.URL)
+			*r2.URL = *r.URL
+			r2.URL.Path = path
+			r2.URL.RawPath = ""
+			mux.ServeHTTP(w, r2)
+			return
+		}
+		prefixed.ServeHTTP(w, r)
+	}), nil
+}
+
+// wellKnownPath maps a path-inserted well-known URL for prefix, such as
+// /.well-known/oauth-authorization-server/v1 or /.well-known/oauth-protected-resource/v1/mcp,
+// to the route the auth service registers, /.well-known/oauth-authorization-server.
+func wellKnownPath(path, prefix string) (string, bool) {
+	rest, ok := strings.CutPrefix(path, "/.well-known/")
+	if !ok {
+		return "", false
+	}
+	name, suffix, ok := strings.Cut(rest, "/")
+	if !ok || name == "" {
+		return "", false
+	}
+	suffix = "/" + suffix
+	if suffix != prefix && !strings.HasPrefix(suffix, prefix+"/") {
+		return "", false
+	}
+	return "/.well-known/" + name, true
+}
@@ -0,0 +1,146 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrTransportClosed is returned by InMemoryTransport.Connect before Start or after Stop,
+// and by InMemoryConn.Send once the connection is closed.
+var ErrTransportClosed = errors.New("transport closed")
+
+// InMemoryTransport serves a MessageHandler to clients in the same process, with no
+// socket or pipe in between: each InMemoryConn exchanges whole JSON-RPC messages over
+// channels. Dispatch is the stream bindings' own — every request on its own goroutine,
+// notifications/cancelled honored, notifications streamed as they are written — so it
+// behaves like a stdio or UNIX connection, minus the framing. It is for embedding an MCP
+// server in an application that also consumes it, and for tests that need to observe a
+// live subscriptions/listen stream.
+type InMemoryTransport struct {
+	mu      sync.Mutex
+	handler MessageHandler
+	conns   map[*InMemoryConn]struct{}
+	stopped bool
+}
+
+// NewInMemoryTransport creates an in-memory transport. Connect to it once started.
+func NewInMemoryTransport() *InMemoryTransport {
+	return &InMemoryTransport{conns: make(map[*InMemoryConn]struct{})}
+}
+
+// Start records handler; connections may be made from then on.
+func (t *InMemoryTransport) Start(handler MessageHandler) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.handler = handler
+	return nil
+}
+
+// Stop shuts the handler down (see Shutdowner), then closes every open connection,
+// cancelling their in-flight requests, and refuses new ones.
+func (t *InMemoryTransport) Stop() error {
+	t.mu.Lock()
+	handler := t.handler
+	t.mu.Unlock()
+	if handler != nil {
+		shutdownHandler("memory", handler)
+	}
+
+	t.mu.Lock()
+	t.stopped = true
+	conns := make([]*InMemoryConn, 0, len(t.conns))
+	for c := range t.conns {
+		conns = append(conns, c)
+	}
+	t.mu.Unlock()
+	for _, c := range conns {
+		c.Close()
+	}
+	return nil
+}
+
+// Connect opens a new client connection.
+func (t *InMemoryTransport) Connect() (*InMemoryConn, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.handler == nil || t.stopped {
+		return nil, ErrTransportClosed
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &InMemoryConn{
+		t:      t,
+		stream: newStreamTransport("memory"),
+		out:    make(chan []byte, 16),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	c.stream.handler = t.handler
+	c.stream.write = c.deliver
+	t.conns[c] = struct{}{}
+	return c, nil
+}
+
+// InMemoryConn is the client end of one in-memory connection. Send and Messages may be
+// used from different goroutines.
+type InMemoryConn struct {
+	t      *InMemoryTransport
+	stream *streamTransport
+	out    chan []byte
+	ctx    context.Context
+	cancel context.CancelFunc
+	once   sync.Once
+
+	// sendMu keeps Close from closing out while a Send is still dispatching: Send holds
+	// it shared, and Close takes it exclusively to set closed.
+	sendMu sync.RWMutex
+	closed bool
+}
+
+// Send delivers one JSON-RPC message (request or notification) to the server. It does not
+// wait for the response, which arrives on Messages; any number of requests may be in
+// flight at once.
+func (c *InMemoryConn) Send(msg []byte) error {
+	c.sendMu.RLock()
+	defer c.sendMu.RUnlock()
+	if c.closed || c.ctx.Err() != nil {
+		return ErrTransportClosed
+	}
+	c.stream.dispatch(c.ctx, append([]byte(nil), msg...))
+	return nil
+}
+
+// Messages returns the channel every server-to-client message arrives on, responses and
+// notifications alike, in the order the server wrote them. The server blocks once its
+// buffer fills, so a client must keep reading for as long as it has requests in flight.
+// The channel is closed by Close, once every in-flight request has finished.
+func (c *InMemoryConn) Messages() <-chan []byte {
+	return c.out
+}
+
+// Close cancels every in-flight request (a subscriptions/listen stream included), waits
+// for their handlers to return, and closes Messages. It is safe to call more than once.
+func (c *InMemoryConn) Close() error {
+	c.once.Do(func() {
+		// Cancel first, so a Send blocked delivering a parse error lets go of sendMu.
+		c.cancel()
+		c.sendMu.Lock()
+		c.closed = true
+		c.sendMu.Unlock()
+		c.stream.wg.Wait()
+		close(c.out)
+		c.t.mu.Lock()
+		delete(c.t.conns, c)
+		c.t.mu.Unlock()
+	})
+	return nil
+}
+
+func (c *InMemoryConn) deliver(msg []byte) error {
+	select {
+	case c.out <- msg:
+		return nil
+	case <-c.ctx.Done():
+		return ErrTransportClosed
+	}
+}
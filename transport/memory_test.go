@@ -0,0 +1,103 @@
+package transport
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestInMemoryConcurrentDispatchAndCancellation is the in-memory counterpart of
+// TestStreamConcurrentDispatchAndCancellation: the same guarantees, with messages passed
+// over channels instead of framed lines.
+func TestInMemoryConcurrentDispatchAndCancellation(t *testing.T) {
+	tr := NewInMemoryTransport()
+	if _, err := tr.Connect(); err != ErrTransportClosed {
+		t.Fatalf("Connect before Start = %v, want ErrTransportClosed", err)
+	}
+	tr.Start(streamTestHandler{})
+	conn, err := tr.Connect()
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+
+	lines := make(chan string, 16)
+	go func() {
+		for msg := range conn.Messages() {
+			lines <- string(msg)
+		}
+		close(lines)
+	}()
+
+	conn.Send([]byte(`{"jsonrpc":"2.0","id":"sub","method":"subscriptions/listen","params":{}}`))
+	if ack := readLineWithTimeout(t, lines, 2*time.Second); !strings.Contains(ack, "acknowledged") {
+		t.Fatalf("expected an acknowledgment first, got: %s", ack)
+	}
+
+	conn.Send([]byte(`{"jsonrpc":"2.0","id":"call","method":"tools/call","params":{}}`))
+	if resp := readLineWithTimeout(t, lines, 2*time.Second); !strings.Contains(resp, `"echo":"tools/call"`) {
+		t.Fatalf("expected the concurrent tools/call to complete, got: %s", resp)
+	}
+
+	conn.Send([]byte(`{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":"sub"}}`))
+	expectNoLineWithin(t, lines, 300*time.Millisecond)
+
+	// A second subscription is still open when the transport stops; Stop must cancel it
+	// and close the connection's channel.
+	conn.Send([]byte(`{"jsonrpc":"2.0","id":"sub2","method":"subscriptions/listen","params":{}}`))
+	readLineWithTimeout(t, lines, 2*time.Second)
+	stopped := make(chan struct{})
+	go func() {
+		tr.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Stop did not return while a subscription was open")
+	}
+	if _, ok := <-lines; ok {
+		t.Error("Messages still open after Stop")
+	}
+	if err := conn.Send([]byte(`{}`)); err != ErrTransportClosed {
+		t.Errorf("Send after Stop = %v, want ErrTransportClosed", err)
+	}
+}
+
+// TestInMemorySendRacingCloseNeverPanics hammers Send from several goroutines while
+// Close runs: a Send must either dispatch before Messages closes or fail with
+// ErrTransportClosed, never deliver onto the closed channel.
+func TestInMemorySendRacingCloseNeverPanics(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		tr := NewInMemoryTransport()
+		tr.Start(streamTestHandler{})
+		conn, err := tr.Connect()
+		if err != nil {
+			t.Fatalf("Connect: %v", err)
+		}
+		go func() {
+			for range conn.Messages() {
+			}
+		}()
+
+		done := make(chan struct{})
+		for g := 0; g < 4; g++ {
+			go func() {
+				defer func() { done <- struct{}{} }()
+				for j := 0; j < 20; j++ {
+					// Malformed input is answered synchronously, from Send itself.
+					if conn.Send([]byte(`not json`)) != nil {
+						return
+					}
+					conn.Send([]byte(`{"jsonrpc":"2.0","id":1,"method":"tools/list","params":{}}`))
+				}
+			}()
+		}
+		conn.Close()
+		for g := 0; g < 4; g++ {
+			<-done
+		}
+		if err := conn.Send([]byte(`{}`)); err != ErrTransportClosed {
+			t.Fatalf("Send after Close = %v, want ErrTransportClosed", err)
+		}
+	}
+}
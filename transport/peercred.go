@@ -0,0 +1,64 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+)
+
+// errPeerCredentialsUnsupported is returned by peerCredentials where the platform offers
+// no way to read them.
+var errPeerCredentialsUnsupported = errors.New("peer credentials are not supported on this platform")
+
+// PeerCredentials identifies the process on the other end of a UNIX socket connection, as
+// the kernel reports it (SO_PEERCRED) when the connection is accepted. Unlike anything a
+// client puts in a message, it cannot be forged by the client. GID is the peer's primary
+// group only.
+type PeerCredentials struct {
+	UID uint32
+	GID uint32
+	PID int32
+}
+
+// peerCredentialsKey is the context key under which PeerCredentials is stored.
+type peerCredentialsKey struct{}
+
+// WithPeerCredentials attaches cred to ctx.
+func WithPeerCredentials(ctx context.Context, cred PeerCredentials) context.Context {
+	return context.WithValue(ctx, peerCredentialsKey{}, cred)
+}
+
+// PeerCredentialsFromContext retrieves the PeerCredentials UnixTransport attached to a
+// request's context. ok is false on any other transport, or where the platform cannot
+// report them (they are read on Linux).
+func PeerCredentialsFromContext(ctx context.Context) (cred PeerCredentials, ok bool) {
+	cred, ok = ctx.Value(peerCredentialsKey{}).(PeerCredentials)
+	return cred, ok
+}
+
+// PeerPrincipal returns the caller's identity as its transport established it, or "" if
+// it did not: "uid:<n>" for the peer's user over a UNIX socket, or, over mutual TLS,
+// "cert:" followed by the identity of the client's verified certificate (its first URI,
+// DNS or email SAN, else its subject DN). The prefix keeps the two apart, so a
+// certificate whose SAN reads "uid:0" is not taken for the root user. It fits
+// mcp.ServerConfig.PrincipalFromContext as is, binding MRTR requestState and tasks to the
+// caller that started them.
+func PeerPrincipal(ctx context.Context) string {
+	if cred, ok := PeerCredentialsFromContext(ctx); ok {
+		return "uid:" + strconv.FormatUint(uint64(cred.UID), 10)
+	}
+	if cert, ok := PeerCertificateFromContext(ctx); ok {
+		return "cert:" + certificateIdentity(cert)
+	}
+	return ""
+}
+
+// peerAllowed reports whether config's allow-lists admit cred: its UID is in AllowedUIDs
+// or its GID in AllowedGIDs. With neither list set, everyone is.
+func (c UnixTransportConfig) peerAllowed(cred PeerCredentials) bool {
+	if len(c.AllowedUIDs) == 0 && len(c.AllowedGIDs) == 0 {
+		return true
+	}
+	return slices.Contains(c.AllowedUIDs, cred.UID) || slices.Contains(c.AllowedGIDs, cred.GID)
+}
@@ -0,0 +1,31 @@
+//go:build linux
+
+package transport
+
+import (
+	"net"
+	"syscall"
+)
+
+// peerCredentials reads the credentials of conn's peer with SO_PEERCRED.
+func peerCredentials(conn net.Conn) (PeerCredentials, error) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return PeerCredentials{}, errPeerCredentialsUnsupported
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return PeerCredentials{}, err
+	}
+	var ucred *syscall.Ucred
+	var sockErr error
+	if err := raw.Control(func(fd uintptr) {
+		ucred, sockErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil {
+		return PeerCredentials{}, err
+	}
+	if sockErr != nil {
+		return PeerCredentials{}, sockErr
+	}
+	return PeerCredentials{UID: ucred.Uid, GID: ucred.Gid, PID: ucred.Pid}, nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package transport
+
+import "net"
+
+// peerCredentials is unavailable here: SO_PEERCRED is Linux's.
+func peerCredentials(conn net.Conn) (PeerCredentials, error) {
+	return PeerCredentials{}, errPeerCredentialsUnsupported
+}
@@ -36,12 +36,16 @@ func (t *StdioTransport) Start(handler MessageHandler) error {
 	return nil
 }
 
-// Stop signals in-flight requests to cancel and waits for the read loop to exit. Per the
+// Stop shuts the handler down (see Shutdowner), then signals in-flight requests to cancel
+// and waits for the read loop to exit. Per the
 // spec, the primary and only fully portable shutdown signal for a stdio server is its
 // stdin being closed by the client; Stop cancels in-flight request contexts but cannot
 // interrupt a blocked stdin read itself, so callers that need a hard deadline should race
 // this against their own timeout.
 func (t *StdioTransport) Stop() error {
+	if t.stream.handler != nil {
+		shutdownHandler("stdio", t.stream.handler)
+	}
 	if t.cancel != nil {
 		t.cancel()
 	}
@@ -4,8 +4,12 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
+	"net"
+	"os"
 	"sync"
+	"time"
 
 	"github.com/spirilis/generic-go-mcp/logging"
 )
@@ -15,6 +19,7 @@ import (
 // the 2026-07-28 stdio transport spec, custom transports over such a stream SHOULD reuse
 // this framing rather than defining a new one — only process/connection lifecycle is
 // binding-specific, which is why stdio.go and unix.go are thin wrappers around this type.
+// websocket.go reuses the same dispatch with WebSocket messages in place of lines.
 //
 // Because the protocol is stateless and subscriptions/listen never returns on its own,
 // messages MUST be dispatched concurrently: a single serial read-dispatch-write loop
@@ -28,7 +33,7 @@ type streamTransport struct {
 	handler MessageHandler
 
 	writeMu sync.Mutex
-	out     io.Writer
+	write   func(msg []byte) error // emits one message; calls are serialized by writeMu
 
 	inflightMu sync.Mutex
 	inflight   map[string]context.CancelFunc // JSON-RPC id (as string) -> cancel
@@ -36,6 +41,9 @@ type streamTransport struct {
 	wg sync.WaitGroup
 }
 
+// maxMessageSize bounds a single incoming message on any stream binding.
+const maxMessageSize = 16 * 1024 * 1024
+
 func newStreamTransport(name string) *streamTransport {
 	return &streamTransport{
 		name:     name,
@@ -47,21 +55,50 @@ func newStreamTransport(name string) *streamTransport {
 // returns EOF/error or ctx is cancelled. It blocks until all in-flight handlers have
 // returned. Safe to call once per connection.
 func (s *streamTransport) serve(ctx context.Context, r io.Reader, w io.Writer) {
-	s.out = w
+	s.write = func(msg []byte) error {
+		if _, err := w.Write(msg); err != nil {
+			return err
+		}
+		_, err := w.Write([]byte("\n"))
+		return err
+	}
 
 	scanner := bufio.NewScanner(r)
 	// Allow generously large single-line messages (default bufio max is 64KiB, which is
 	// easy to exceed with embedded resources/images).
 	buf := make([]byte, 0, 64*1024)
-	scanner.Buffer(buf, 16*1024*1024)
+	scanner.Buffer(buf, maxMessageSize)
 
-	for scanner.Scan() {
-		line := scanner.Bytes()
-		if len(line) == 0 {
-			continue
+	s.serveMessages(ctx, func() ([]byte, error) {
+		for scanner.Scan() {
+			line := scanner.Bytes()
+			if len(line) == 0 {
+				continue
+			}
+			msg := make([]byte, len(line))
+			copy(msg, line)
+			return msg, nil
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	})
+}
+
+// serveMessages dispatches each message next returns until next fails (io.EOF at the
+// end of input) or ctx is cancelled, then blocks until all in-flight handlers have
+// returned. It is the read loop behind serve, for bindings whose framing is not lines;
+// s.write must already be set.
+func (s *streamTransport) serveMessages(ctx context.Context, next func() ([]byte, error)) {
+	for {
+		msg, err := next()
+		if err != nil {
+			if err != io.EOF {
+				logging.Debug("stream read error", "transport", s.name, "error", err)
+			}
+			break
 		}
-		msg := make([]byte, len(line))
-		copy(msg, line)
 
 		select {
 		case <-ctx.Done():
@@ -70,47 +107,51 @@ func (s *streamTransport) serve(ctx context.Context, r io.Reader, w io.Writer) {
 		default:
 		}
 
-		var req JSONRPCRequest
-		if err := json.Unmarshal(msg, &req); err != nil {
-			logging.Debug("JSON-RPC parse error", "transport", s.name, "error", err)
-			s.writeLine(NewErrorResponse(nil, &RPCError{Code: ParseError, Message: "Parse error"}))
-			continue
-		}
-
-		if req.Method == "notifications/cancelled" {
-			s.handleCancelled(req.Params)
-			continue
-		}
+		s.dispatch(ctx, msg)
+	}
+	s.wg.Wait()
+}
 
-		reqCtx := ctx
-		var cancel context.CancelFunc
-		idKey := string(req.ID)
-		if !req.IsNotification() {
-			reqCtx, cancel = context.WithCancel(ctx)
-			s.inflightMu.Lock()
-			s.inflight[idKey] = cancel
-			s.inflightMu.Unlock()
-		}
+// dispatch handles one incoming message: notifications/cancelled is acted on at once, and
+// anything else is handed to the handler on its own goroutine, under a context cancelled
+// by a matching notifications/cancelled or by ctx. Callers wait on s.wg for every
+// dispatched handler to return.
+func (s *streamTransport) dispatch(ctx context.Context, msg []byte) {
+	var req JSONRPCRequest
+	if err := json.Unmarshal(msg, &req); err != nil {
+		logging.Debug("JSON-RPC parse error", "transport", s.name, "error", err)
+		s.writeMsg(NewErrorResponse(nil, &RPCError{Code: ParseError, Message: "Parse error"}))
+		return
+	}
 
-		s.wg.Add(1)
-		go func() {
-			defer s.wg.Done()
-			if cancel != nil {
-				defer func() {
-					cancel()
-					s.inflightMu.Lock()
-					delete(s.inflight, idKey)
-					s.inflightMu.Unlock()
-				}()
-			}
-			s.handler.HandleMessage(reqCtx, msg, &streamResponseWriter{t: s})
-		}()
+	if req.Method == "notifications/cancelled" {
+		s.handleCancelled(req.Params)
+		return
 	}
 
-	if err := scanner.Err(); err != nil {
-		logging.Debug("stream scanner error", "transport", s.name, "error", err)
+	reqCtx := ctx
+	var cancel context.CancelFunc
+	idKey := string(req.ID)
+	if !req.IsNotification() {
+		reqCtx, cancel = context.WithCancel(ctx)
+		s.inflightMu.Lock()
+		s.inflight[idKey] = cancel
+		s.inflightMu.Unlock()
 	}
-	s.wg.Wait()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if cancel != nil {
+			defer func() {
+				cancel()
+				s.inflightMu.Lock()
+				delete(s.inflight, idKey)
+				s.inflightMu.Unlock()
+			}()
+		}
+		s.handler.HandleMessage(reqCtx, msg, &streamResponseWriter{t: s})
+	}()
 }
 
 // handleCancelled cancels the in-flight request named by the notification's params.requestId.
@@ -130,17 +171,20 @@ func (s *streamTransport) handleCancelled(params json.RawMessage) {
 	}
 }
 
-func (s *streamTransport) writeLine(data []byte) error {
+// busy reports whether any request on the stream is still in flight.
+func (s *streamTransport) busy() bool {
+	s.inflightMu.Lock()
+	defer s.inflightMu.Unlock()
+	return len(s.inflight) > 0
+}
+
+func (s *streamTransport) writeMsg(data []byte) error {
 	if data == nil {
 		return nil
 	}
 	s.writeMu.Lock()
 	defer s.writeMu.Unlock()
-	if _, err := s.out.Write(data); err != nil {
-		return err
-	}
-	_, err := s.out.Write([]byte("\n"))
-	return err
+	return s.write(data)
 }
 
 // streamResponseWriter implements ResponseWriter by writing each message as its own line
@@ -158,9 +202,55 @@ func (w *streamResponseWriter) WriteNotification(method string, params interface
 	if err != nil {
 		return err
 	}
-	return w.t.writeLine(data)
+	return w.t.writeMsg(data)
 }
 
 func (w *streamResponseWriter) WriteMessage(data []byte) error {
-	return w.t.writeLine(data)
+	return w.t.writeMsg(data)
+}
+
+// serveConn serves one client connection of a socket transport, named name, on a
+// streamTransport of its own until the client disconnects or ctx is cancelled. With
+// idleTimeout set, it also disconnects a client that has sent nothing for that long while
+// none of its requests are in flight.
+func serveConn(ctx context.Context, name string, handler MessageHandler, conn net.Conn, idleTimeout time.Duration) {
+	stream := newStreamTransport(name)
+	stream.handler = handler
+	var r io.Reader = conn
+	if idleTimeout > 0 {
+		r = &idleReader{conn: conn, timeout: idleTimeout, busy: stream.busy}
+	}
+	stream.serve(ctx, r, conn)
+}
+
+// refuseConn turns away a connection a socket transport will not serve, telling the
+// client why in a -32603 error line first.
+func refuseConn(conn net.Conn, message string) {
+	conn.Write(append(NewErrorResponse(nil, &RPCError{Code: InternalError, Message: message}), '\n'))
+	conn.Close()
+}
+
+// idleReader reads from conn, failing with a timeout once nothing has arrived for
+// timeout while busy reports false.
+type idleReader struct {
+	conn    net.Conn
+	timeout time.Duration
+	busy    func() bool
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	for {
+		r.conn.SetReadDeadline(time.Now().Add(r.timeout))
+		n, err := r.conn.Read(p)
+		if n > 0 || err == nil {
+			return n, nil
+		}
+		if errors.Is(err, os.ErrDeadlineExceeded) && r.busy() {
+			continue
+		}
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			logging.Debug("Closing idle connection", "remote_addr", r.conn.RemoteAddr(), "idle_timeout", r.timeout)
+		}
+		return 0, err
+	}
 }
@@ -13,7 +13,8 @@ import (
 // streamTestHandler simulates a stateless MCP server for exercising the shared
 // stream binding: subscriptions/listen acknowledges immediately and then blocks until
 // its context is cancelled (by notifications/cancelled or the connection closing);
-// every other method responds immediately, echoing its own method name.
+// whoami responds with the caller's PeerPrincipal; every other method responds
+// immediately, echoing its own method name.
 type streamTestHandler struct{}
 
 func (streamTestHandler) HandleMessage(ctx context.Context, data []byte, w ResponseWriter) {
@@ -26,6 +27,8 @@ func (streamTestHandler) HandleMessage(ctx context.Context, data []byte, w Respo
 		w.WriteNotification("notifications/subscriptions/acknowledged", map[string]interface{}{})
 		<-ctx.Done()
 		// No final message on an abrupt cancel — matches mcp.handleSubscriptionsListen.
+	case "whoami":
+		w.WriteMessage(NewSuccessResponse(req.ID, map[string]string{"principal": PeerPrincipal(ctx)}))
 	default:
 		w.WriteMessage(NewSuccessResponse(req.ID, map[string]string{"echo": req.Method}))
 	}
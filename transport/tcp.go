@@ -0,0 +1,242 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spirilis/generic-go-mcp/logging"
+)
+
+// tlsHandshakeTimeout bounds how long a client may take to complete its TLS handshake.
+const tlsHandshakeTimeout = 10 * time.Second
+
+// TCPTransportConfig holds configuration for TCP transport
+type TCPTransportConfig struct {
+	Host string // Default "127.0.0.1": without TLS, anyone who can reach the port is served
+	Port int    // Zero picks a free port; see Addr
+
+	// MaxConnections and IdleTimeout work as in UnixTransportConfig.
+	MaxConnections int
+	IdleTimeout    time.Duration
+
+	// TLS, if set, serves every connection over TLS, and with TLS.ClientCAFile set, only to
+	// clients presenting a certificate it verifies (mutual TLS).
+	TLS *TLSConfig
+}
+
+// TLSConfig names the PEM files a TLS listener is served from. They are watched: a
+// handshake after any of them changes on disk (checked at most every ReloadInterval)
+// uses the new contents, so certificates can be rotated without a restart. If the new
+// files fail to load, the previous ones stay in use.
+type TLSConfig struct {
+	CertFile string // Required: server certificate chain
+	KeyFile  string // Required: its private key
+
+	// ClientCAFile, if set, requires every client to present a certificate that verifies
+	// against the CAs in it. Its identity becomes the caller's PeerPrincipal.
+	ClientCAFile string
+
+	// ReloadInterval is how often, at most, the files are checked for changes. Default 5s.
+	ReloadInterval time.Duration
+}
+
+// TCPTransport implements Transport over plain TCP or TLS, with the same newline-delimited
+// framing and per-connection streamTransport as UnixTransport. Over mutual TLS each
+// request's context carries the client's verified certificate (see
+// PeerCertificateFromContext).
+type TCPTransport struct {
+	config   TCPTransportConfig
+	listener net.Listener
+	tls      *certReloader
+	handler  MessageHandler
+	stopCh   chan struct{}
+	wg       sync.WaitGroup
+
+	connMu sync.Mutex
+	conns  map[net.Conn]context.CancelFunc // open connections -> cancel for their requests
+}
+
+// NewTCPTransport creates a new TCP transport
+func NewTCPTransport(config TCPTransportConfig) *TCPTransport {
+	if config.Host == "" {
+		config.Host = "127.0.0.1"
+	}
+	return &TCPTransport{
+		config: config,
+		stopCh: make(chan struct{}),
+		conns:  make(map[net.Conn]context.CancelFunc),
+	}
+}
+
+// Start loads the TLS files, if any, and begins listening
+func (t *TCPTransport) Start(handler MessageHandler) error {
+	t.handler = handler
+
+	if t.config.TLS != nil {
+		reloader, err := newCertReloader(*t.config.TLS)
+		if err != nil {
+			return fmt.Errorf("failed to load TLS configuration: %w", err)
+		}
+		t.tls = reloader
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(t.config.Host, strconv.Itoa(t.config.Port)))
+	if err != nil {
+		return fmt.Errorf("failed to listen on tcp: %w", err)
+	}
+	t.listener = listener
+
+	logging.Info("TCP server listening", "addr", listener.Addr().String(), "tls", t.tls != nil,
+		"mutual_tls", t.config.TLS != nil && t.config.TLS.ClientCAFile != "")
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		t.acceptLoop()
+	}()
+
+	return nil
+}
+
+// Addr returns the address the transport is listening on, once started.
+func (t *TCPTransport) Addr() net.Addr {
+	if t.listener == nil {
+		return nil
+	}
+	return t.listener.Addr()
+}
+
+// Stop gracefully stops the transport. The handler is shut down first (see Shutdowner),
+// while the connections are still open to carry what it writes.
+func (t *TCPTransport) Stop() error {
+	if t.handler != nil {
+		shutdownHandler("tcp", t.handler)
+	}
+	close(t.stopCh)
+
+	if t.listener != nil {
+		t.listener.Close()
+	}
+
+	t.connMu.Lock()
+	for c, cancel := range t.conns {
+		c.Close()
+		cancel()
+		delete(t.conns, c)
+	}
+	t.connMu.Unlock()
+
+	t.wg.Wait()
+	return nil
+}
+
+// acceptLoop accepts connections, serving each on its own goroutine until it
+// disconnects, up to MaxConnections at once. Over TLS the handshake happens on that
+// goroutine, before any message is read, so a slow one never holds up the next accept.
+func (t *TCPTransport) acceptLoop() {
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			select {
+			case <-t.stopCh:
+				return
+			default:
+				logging.Error("Error accepting connection", "error", err)
+				continue
+			}
+		}
+		if t.tls != nil {
+			conn = tls.Server(conn, &tls.Config{GetConfigForClient: t.tls.configForClient})
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		t.connMu.Lock()
+		if max := t.config.MaxConnections; max > 0 && len(t.conns) >= max {
+			t.connMu.Unlock()
+			cancel()
+			logging.Warn("TCP connection refused: too many connections", "max", max, "remote_addr", conn.RemoteAddr())
+			if t.tls != nil {
+				conn.Close() // no handshake yet, so no channel to say why on
+			} else {
+				refuseConn(conn, "Too many connections")
+			}
+			continue
+		}
+		t.conns[conn] = cancel
+		t.connMu.Unlock()
+
+		t.wg.Add(1)
+		go func(c net.Conn, ctx context.Context, cancel context.CancelFunc) {
+			defer t.wg.Done()
+			defer func() {
+				t.connMu.Lock()
+				delete(t.conns, c)
+				t.connMu.Unlock()
+				c.Close()
+				cancel()
+			}()
+
+			if tc, ok := c.(*tls.Conn); ok {
+				var err error
+				if ctx, err = handshake(ctx, tc); err != nil {
+					logging.Warn("TLS handshake failed", "remote_addr", c.RemoteAddr(), "error", err)
+					return
+				}
+			}
+			logging.Debug("Client connected over TCP", "remote_addr", c.RemoteAddr())
+			serveConn(ctx, "tcp", t.handler, c, t.config.IdleTimeout)
+			logging.Debug("Client disconnected from TCP", "remote_addr", c.RemoteAddr())
+		}(conn, ctx, cancel)
+	}
+}
+
+// handshake completes conn's TLS handshake, returning ctx with the client's verified
+// certificate attached if it presented one.
+func handshake(ctx context.Context, conn *tls.Conn) (context.Context, error) {
+	hsCtx, cancel := context.WithTimeout(ctx, tlsHandshakeTimeout)
+	defer cancel()
+	if err := conn.HandshakeContext(hsCtx); err != nil {
+		return ctx, err
+	}
+	if chains := conn.ConnectionState().VerifiedChains; len(chains) > 0 {
+		ctx = WithPeerCertificate(ctx, chains[0][0])
+	}
+	return ctx, nil
+}
+
+// peerCertificateKey is the context key under which the client's certificate is stored.
+type peerCertificateKey struct{}
+
+// WithPeerCertificate attaches a client's verified certificate to ctx.
+func WithPeerCertificate(ctx context.Context, cert *x509.Certificate) context.Context {
+	return context.WithValue(ctx, peerCertificateKey{}, cert)
+}
+
+// PeerCertificateFromContext retrieves the verified client certificate TCPTransport
+// attached to a request's context under mutual TLS. ok is false otherwise.
+func PeerCertificateFromContext(ctx context.Context) (cert *x509.Certificate, ok bool) {
+	cert, ok = ctx.Value(peerCertificateKey{}).(*x509.Certificate)
+	return cert, ok && cert != nil
+}
+
+// certificateIdentity names the holder of cert: its first URI SAN (e.g. a SPIFFE ID),
+// else its first DNS SAN, else its first email SAN, else its subject DN.
+func certificateIdentity(cert *x509.Certificate) string {
+	switch {
+	case len(cert.URIs) > 0:
+		return cert.URIs[0].String()
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	case len(cert.EmailAddresses) > 0:
+		return cert.EmailAddresses[0]
+	default:
+		return cert.Subject.String()
+	}
+}
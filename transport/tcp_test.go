@@ -0,0 +1,221 @@
+package transport
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCA issues certificates for the TLS tests.
+type testCA struct {
+	t    *testing.T
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{t: t, cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue signs a leaf certificate from tmpl, returning it and its key as PEM.
+func (ca *testCA) issue(serial int64, tmpl *x509.Certificate) (certPEM, keyPEM []byte) {
+	ca.t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl.SerialNumber = big.NewInt(serial)
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		ca.t.Fatalf("CreateCertificate: %v", err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func (ca *testCA) serverCert(serial int64) (certPEM, keyPEM []byte) {
+	return ca.issue(serial, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "localhost"},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+}
+
+func (ca *testCA) clientCert(tmpl *x509.Certificate) tls.Certificate {
+	tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	certPEM, keyPEM := ca.issue(100, tmpl)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		ca.t.Fatalf("X509KeyPair: %v", err)
+	}
+	return cert
+}
+
+func writeFile(t *testing.T, path string, data []byte, mtime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatalf("Chtimes: %v", err)
+	}
+}
+
+func startTCPTransport(t *testing.T, config TCPTransportConfig) string {
+	t.Helper()
+	tr := NewTCPTransport(config)
+	if err := tr.Start(streamTestHandler{}); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { tr.Stop() })
+	return tr.Addr().String()
+}
+
+// dialTLS connects to addr, returning the handshake's outcome and a line reader.
+func dialTLS(t *testing.T, addr string, config *tls.Config) (*tls.Conn, *bufio.Reader, error) {
+	t.Helper()
+	conn, err := tls.Dial("tcp", addr, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	return conn, bufio.NewReader(conn), nil
+}
+
+func TestTCPServesNewlineDelimitedMessages(t *testing.T) {
+	addr := startTCPTransport(t, TCPTransportConfig{})
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	conn.Write([]byte(`{"jsonrpc":"2.0","id":1,"method":"whoami","params":{}}` + "\n"))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || !strings.Contains(line, `"principal":""`) {
+		t.Fatalf("whoami over plain TCP = %q, %v; want an empty principal", line, err)
+	}
+}
+
+func TestTCPMutualTLSExposesClientCertificateIdentity(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certPEM, keyPEM := ca.serverCert(2)
+	files := TLSConfig{
+		CertFile:     filepath.Join(dir, "server.pem"),
+		KeyFile:      filepath.Join(dir, "server-key.pem"),
+		ClientCAFile: filepath.Join(dir, "ca.pem"),
+	}
+	now := time.Now()
+	writeFile(t, files.CertFile, certPEM, now)
+	writeFile(t, files.KeyFile, keyPEM, now)
+	writeFile(t, files.ClientCAFile, ca.pem, now)
+	addr := startTCPTransport(t, TCPTransportConfig{TLS: &files})
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	spiffe, _ := url.Parse("spiffe://example.org/alice")
+	lookalike, _ := url.Parse("uid:0")
+	cases := []struct {
+		cert tls.Certificate
+		want string
+	}{
+		{ca.clientCert(&x509.Certificate{Subject: pkix.Name{CommonName: "alice"}, URIs: []*url.URL{spiffe}}), "cert:spiffe://example.org/alice"},
+		{ca.clientCert(&x509.Certificate{Subject: pkix.Name{CommonName: "bob", Organization: []string{"Acme"}}}), "cert:CN=bob,O=Acme"},
+		// A SAN spelled like a UNIX peer's principal must not pass for one.
+		{ca.clientCert(&x509.Certificate{Subject: pkix.Name{CommonName: "mallory"}, URIs: []*url.URL{lookalike}}), "cert:uid:0"},
+	}
+	for _, c := range cases {
+		conn, r, err := dialTLS(t, addr, &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{c.cert}})
+		if err != nil {
+			t.Fatalf("Dial with a client certificate: %v", err)
+		}
+		conn.Write([]byte(`{"jsonrpc":"2.0","id":1,"method":"whoami","params":{}}` + "\n"))
+		if line, err := r.ReadString('\n'); err != nil || !strings.Contains(line, `"principal":"`+c.want+`"`) {
+			t.Errorf("whoami = %q, %v; want principal %q", line, err, c.want)
+		}
+	}
+
+	// Without a client certificate the server fails the handshake; under TLS 1.3 the
+	// client only learns so on its first read.
+	conn, r, err := dialTLS(t, addr, &tls.Config{RootCAs: roots})
+	if err == nil {
+		conn.Write([]byte(`{"jsonrpc":"2.0","id":1,"method":"whoami","params":{}}` + "\n"))
+		if line, err := r.ReadString('\n'); err == nil {
+			t.Fatalf("client without a certificate got %q, want the handshake refused", line)
+		}
+	}
+}
+
+func TestTCPReloadsCertificatesOnChange(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	files := TLSConfig{
+		CertFile:       filepath.Join(dir, "server.pem"),
+		KeyFile:        filepath.Join(dir, "server-key.pem"),
+		ReloadInterval: time.Millisecond,
+	}
+	certPEM, keyPEM := ca.serverCert(2)
+	then := time.Now().Add(-time.Minute)
+	writeFile(t, files.CertFile, certPEM, then)
+	writeFile(t, files.KeyFile, keyPEM, then)
+	addr := startTCPTransport(t, TCPTransportConfig{TLS: &files})
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	serial := func() int64 {
+		t.Helper()
+		conn, _, err := dialTLS(t, addr, &tls.Config{RootCAs: roots})
+		if err != nil {
+			t.Fatalf("Dial: %v", err)
+		}
+		return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+	}
+	if got := serial(); got != 2 {
+		t.Fatalf("server certificate serial %d, want 2", got)
+	}
+
+	// A half-written rotation (new certificate, old key) keeps the old pair in use.
+	certPEM, keyPEM = ca.serverCert(3)
+	writeFile(t, files.CertFile, certPEM, time.Now())
+	time.Sleep(5 * time.Millisecond)
+	if got := serial(); got != 2 {
+		t.Fatalf("server certificate serial %d after a partial rotation, want 2", got)
+	}
+	writeFile(t, files.KeyFile, keyPEM, time.Now())
+	time.Sleep(5 * time.Millisecond)
+	if got := serial(); got != 3 {
+		t.Fatalf("server certificate serial %d after rotation, want 3", got)
+	}
+}
@@ -0,0 +1,124 @@
+package transport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/spirilis/generic-go-mcp/logging"
+)
+
+// defaultTLSReloadInterval is how often, unless TLSConfig.ReloadInterval says otherwise,
+// a TLS listener checks its files for changes.
+const defaultTLSReloadInterval = 5 * time.Second
+
+// fileStamp is what a file is checked for changes by: its modification time and size.
+type fileStamp struct {
+	modTime int64
+	size    int64
+}
+
+// certReloader hands each TLS handshake the configuration built from its TLSConfig's
+// files, rebuilding it first if, when last checked, any of them had changed.
+type certReloader struct {
+	files    TLSConfig
+	interval time.Duration
+
+	mu      sync.Mutex
+	checked time.Time
+	stamps  []fileStamp
+	config  *tls.Config
+}
+
+func newCertReloader(files TLSConfig) (*certReloader, error) {
+	if files.CertFile == "" || files.KeyFile == "" {
+		return nil, errors.New("a certificate and key file are required")
+	}
+	r := &certReloader{files: files, interval: files.ReloadInterval}
+	if r.interval <= 0 {
+		r.interval = defaultTLSReloadInterval
+	}
+	r.stamps = r.stat()
+	config, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	r.config = config
+	r.checked = time.Now()
+	return r, nil
+}
+
+// configForClient implements tls.Config.GetConfigForClient.
+func (r *certReloader) configForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Since(r.checked) < r.interval {
+		return r.config, nil
+	}
+	r.checked = time.Now()
+	stamps := r.stat()
+	if slices.Equal(stamps, r.stamps) {
+		return r.config, nil
+	}
+	// Take the new stamps even if loading fails, so a half-written rotation is retried
+	// once the rest of it lands rather than logged on every handshake.
+	r.stamps = stamps
+	config, err := r.load()
+	if err != nil {
+		logging.Warn("TLS files changed but failed to load; keeping the previous ones", "error", err)
+		return r.config, nil
+	}
+	r.config = config
+	logging.Info("Reloaded TLS certificates", "cert", r.files.CertFile)
+	return r.config, nil
+}
+
+func (r *certReloader) paths() []string {
+	paths := []string{r.files.CertFile, r.files.KeyFile}
+	if r.files.ClientCAFile != "" {
+		paths = append(paths, r.files.ClientCAFile)
+	}
+	return paths
+}
+
+// stat stamps each file; one that cannot be stat'ed gets the zero stamp.
+func (r *certReloader) stat() []fileStamp {
+	paths := r.paths()
+	stamps := make([]fileStamp, len(paths))
+	for i, p := range paths {
+		if fi, err := os.Stat(p); err == nil {
+			stamps[i] = fileStamp{modTime: fi.ModTime().UnixNano(), size: fi.Size()}
+		}
+	}
+	return stamps
+}
+
+// load builds the TLS configuration from the files as they are now.
+func (r *certReloader) load() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(r.files.CertFile, r.files.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if r.files.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.files.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", r.files.ClientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
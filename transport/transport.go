@@ -4,6 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"time"
+
+	"github.com/spirilis/generic-go-mcp/logging"
 )
 
 // Transport defines the interface for different communication mechanisms
@@ -30,6 +33,30 @@ type MessageHandler interface {
 	HandleMessage(ctx context.Context, data []byte, w ResponseWriter)
 }
 
+// Shutdowner is implemented by a MessageHandler whose long-lived requests can be ended
+// gracefully, such as mcp.Server with its subscriptions/listen streams. Every transport's
+// Stop calls Shutdown, allowing it ShutdownTimeout, before it tears down any connection,
+// so what the handler writes on the way out still reaches the client.
+type Shutdowner interface {
+	Shutdown(ctx context.Context) error
+}
+
+// ShutdownTimeout bounds how long a transport's Stop waits for its handler's Shutdown.
+const ShutdownTimeout = 5 * time.Second
+
+// shutdownHandler calls h's Shutdown, if it has one, bounded by ShutdownTimeout.
+func shutdownHandler(name string, h MessageHandler) {
+	sd, ok := h.(Shutdowner)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	if err := sd.Shutdown(ctx); err != nil {
+		logging.Warn("Handler shutdown incomplete", "transport", name, "error", err)
+	}
+}
+
 // ResponseWriter emits server-to-client messages belonging to one in-flight client request.
 type ResponseWriter interface {
 	// WriteNotification emits a request-scoped JSON-RPC notification (e.g.
@@ -6,6 +6,7 @@ import (
 	"net"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/spirilis/generic-go-mcp/logging"
 )
@@ -14,13 +15,38 @@ import (
 type UnixTransportConfig struct {
 	SocketPath string
 	FileMode   os.FileMode
+
+	// MaxConnections caps how many clients may be connected at once; one connecting
+	// beyond it gets a -32603 error and is disconnected. Zero means no limit.
+	MaxConnections int
+
+	// IdleTimeout, if set, disconnects a client that has sent nothing for this long while
+	// none of its requests are in flight. An open subscriptions/listen is in flight, so it
+	// keeps its connection alive however quiet it is.
+	IdleTimeout time.Duration
+
+	// AllowedUIDs and AllowedGIDs, if either is set, admit only a peer whose user is in
+	// AllowedUIDs or whose primary group is in AllowedGIDs, as the kernel reports them
+	// (see PeerCredentials). Anyone else is disconnected before a single message is read,
+	// as is everyone on a platform that cannot report peer credentials. This is on top of
+	// FileMode, not instead of it.
+	AllowedUIDs []uint32
+	AllowedGIDs []uint32
+
+	// SingleClient restores the transport's original behavior: only one client is served
+	// at a time, and a new connection closes the previous one, cancelling its in-flight
+	// requests. MaxConnections is ignored.
+	SingleClient bool
 }
 
 // UnixTransport implements Transport using UNIX domain sockets. Per the 2026-07-28 spec,
 // custom transports over a reliable bidirectional byte stream SHOULD reuse the stdio
 // newline-delimited JSON-RPC framing rather than defining a new one; this transport does,
 // via the shared streamTransport binding, so it inherits concurrent dispatch and
-// notifications/cancelled handling for free.
+// notifications/cancelled handling for free. Each connection gets a streamTransport of
+// its own, so clients sharing the socket never see one another's responses or
+// subscriptions. Where the platform reports them, each request's context carries the
+// connecting process's PeerCredentials.
 type UnixTransport struct {
 	config   UnixTransportConfig
 	listener net.Listener
@@ -28,9 +54,8 @@ type UnixTransport struct {
 	stopCh   chan struct{}
 	wg       sync.WaitGroup
 
-	connMu     sync.Mutex
-	conn       net.Conn
-	cancelConn context.CancelFunc
+	connMu sync.Mutex
+	conns  map[net.Conn]context.CancelFunc // open connections -> cancel for their requests
 }
 
 // NewUnixTransport creates a new UNIX socket transport
@@ -38,6 +63,7 @@ func NewUnixTransport(config UnixTransportConfig) *UnixTransport {
 	return &UnixTransport{
 		config: config,
 		stopCh: make(chan struct{}),
+		conns:  make(map[net.Conn]context.CancelFunc),
 	}
 }
 
@@ -75,8 +101,12 @@ func (t *UnixTransport) Start(handler MessageHandler) error {
 	return nil
 }
 
-// Stop gracefully stops the transport and cleans up the socket
+// Stop gracefully stops the transport and cleans up the socket. The handler is shut down
+// first (see Shutdowner), while the connections are still open to carry what it writes.
 func (t *UnixTransport) Stop() error {
+	if t.handler != nil {
+		shutdownHandler("unix", t.handler)
+	}
 	close(t.stopCh)
 
 	// Close the listener to stop accepting new connections
@@ -84,14 +114,9 @@ func (t *UnixTransport) Stop() error {
 		t.listener.Close()
 	}
 
-	// Close any active connection and cancel its in-flight requests
+	// Close every active connection and cancel its in-flight requests
 	t.connMu.Lock()
-	if t.conn != nil {
-		t.conn.Close()
-	}
-	if t.cancelConn != nil {
-		t.cancelConn()
-	}
+	t.closeConnsLocked()
 	t.connMu.Unlock()
 
 	// Wait for goroutines to finish
@@ -105,9 +130,19 @@ func (t *UnixTransport) Stop() error {
 	return nil
 }
 
-// acceptLoop accepts connections from the socket. Only one connection is served at a
-// time: a new connection closes and replaces whatever the previous one was doing, same
-// as before this migration.
+// closeConnsLocked closes every open connection and cancels its in-flight requests.
+// Callers must hold connMu.
+func (t *UnixTransport) closeConnsLocked() {
+	for c, cancel := range t.conns {
+		c.Close()
+		cancel()
+		delete(t.conns, c)
+	}
+}
+
+// acceptLoop accepts connections from the socket, serving each on its own goroutine
+// until it disconnects, up to MaxConnections at once. In SingleClient mode a new
+// connection replaces whatever the previous one was doing instead.
 func (t *UnixTransport) acceptLoop() {
 	for {
 		conn, err := t.listener.Accept()
@@ -121,17 +156,24 @@ func (t *UnixTransport) acceptLoop() {
 			}
 		}
 
-		ctx, cancel := context.WithCancel(context.Background())
+		ctx, ok := t.admit(conn)
+		if !ok {
+			conn.Close()
+			continue
+		}
+		ctx, cancel := context.WithCancel(ctx)
 
 		t.connMu.Lock()
-		if t.conn != nil {
-			t.conn.Close()
+		if t.config.SingleClient {
+			t.closeConnsLocked()
+		} else if max := t.config.MaxConnections; max > 0 && len(t.conns) >= max {
+			t.connMu.Unlock()
+			cancel()
+			logging.Warn("UNIX socket connection refused: too many connections", "max", max)
+			refuseConn(conn, "Too many connections")
+			continue
 		}
-		if t.cancelConn != nil {
-			t.cancelConn()
-		}
-		t.conn = conn
-		t.cancelConn = cancel
+		t.conns[conn] = cancel
 		t.connMu.Unlock()
 
 		logging.Debug("Client connected to UNIX socket")
@@ -139,14 +181,37 @@ func (t *UnixTransport) acceptLoop() {
 		t.wg.Add(1)
 		go func(c net.Conn, ctx context.Context, cancel context.CancelFunc) {
 			defer t.wg.Done()
-			defer c.Close()
-			defer cancel()
+			defer func() {
+				t.connMu.Lock()
+				delete(t.conns, c)
+				t.connMu.Unlock()
+				c.Close()
+				cancel()
+			}()
 
-			stream := newStreamTransport("unix")
-			stream.handler = t.handler
-			stream.serve(ctx, c, c)
+			serveConn(ctx, "unix", t.handler, c, t.config.IdleTimeout)
 
 			logging.Debug("Client disconnected from UNIX socket")
 		}(conn, ctx, cancel)
 	}
 }
+
+// admit reads conn's peer credentials and checks them against the allow-lists, returning
+// the context to serve the connection under, carrying them, or false if it is refused.
+func (t *UnixTransport) admit(conn net.Conn) (context.Context, bool) {
+	ctx := context.Background()
+	restricted := len(t.config.AllowedUIDs) > 0 || len(t.config.AllowedGIDs) > 0
+	cred, err := peerCredentials(conn)
+	if err != nil {
+		if restricted {
+			logging.Warn("UNIX socket connection refused: peer credentials unavailable", "error", err)
+			return nil, false
+		}
+		return ctx, true
+	}
+	if !t.config.peerAllowed(cred) {
+		logging.Warn("UNIX socket connection refused: peer not allowed", "uid", cred.UID, "gid", cred.GID, "pid", cred.PID)
+		return nil, false
+	}
+	return WithPeerCredentials(ctx, cred), true
+}
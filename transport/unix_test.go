@@ -0,0 +1,150 @@
+package transport
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func startUnixTransport(t *testing.T, config UnixTransportConfig) string {
+	t.Helper()
+	config.SocketPath = filepath.Join(t.TempDir(), "mcp.sock")
+	config.FileMode = 0o600
+	tr := NewUnixTransport(config)
+	if err := tr.Start(streamTestHandler{}); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { tr.Stop() })
+	return config.SocketPath
+}
+
+// dialLines connects to the socket and returns the connection with a channel of the
+// lines it receives, closed when the server disconnects it.
+func dialLines(t *testing.T, path string) (net.Conn, <-chan string) {
+	t.Helper()
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	lines := make(chan string, 16)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	return conn, lines
+}
+
+func send(t *testing.T, conn net.Conn, line string) {
+	t.Helper()
+	if _, err := conn.Write([]byte(line + "\n")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+}
+
+func expectClosedWithin(t *testing.T, lines <-chan string, d time.Duration) {
+	t.Helper()
+	deadline := time.After(d)
+	for {
+		select {
+		case _, ok := <-lines:
+			if !ok {
+				return
+			}
+		case <-deadline:
+			t.Fatal("connection still open")
+		}
+	}
+}
+
+func TestUnixServesConcurrentConnectionsUpToCap(t *testing.T) {
+	path := startUnixTransport(t, UnixTransportConfig{MaxConnections: 2})
+
+	a, aLines := dialLines(t, path)
+	b, bLines := dialLines(t, path)
+	// A subscription on a keeps its requests in flight while b is served alongside it.
+	send(t, a, `{"jsonrpc":"2.0","id":1,"method":"subscriptions/listen","params":{}}`)
+	readLineWithTimeout(t, aLines, 2*time.Second)
+	send(t, b, `{"jsonrpc":"2.0","id":1,"method":"tools/list","params":{}}`)
+	if got := readLineWithTimeout(t, bLines, 2*time.Second); !strings.Contains(got, `"echo":"tools/list"`) {
+		t.Fatalf("second client got %s, want its own response", got)
+	}
+	send(t, a, `{"jsonrpc":"2.0","id":2,"method":"tools/list","params":{}}`)
+	if got := readLineWithTimeout(t, aLines, 2*time.Second); !strings.Contains(got, `"id":2`) {
+		t.Fatalf("first client got %s, want its response to id 2", got)
+	}
+
+	_, cLines := dialLines(t, path)
+	if got := readLineWithTimeout(t, cLines, 2*time.Second); !strings.Contains(got, "Too many connections") {
+		t.Errorf("third client got %s, want a refusal", got)
+	}
+	expectClosedWithin(t, cLines, 2*time.Second)
+}
+
+func TestUnixIdleTimeoutSparesBusyConnections(t *testing.T) {
+	path := startUnixTransport(t, UnixTransportConfig{IdleTimeout: 100 * time.Millisecond})
+
+	_, idleLines := dialLines(t, path)
+	busy, busyLines := dialLines(t, path)
+	send(t, busy, `{"jsonrpc":"2.0","id":1,"method":"subscriptions/listen","params":{}}`)
+	readLineWithTimeout(t, busyLines, 2*time.Second)
+
+	expectClosedWithin(t, idleLines, 2*time.Second)
+	time.Sleep(300 * time.Millisecond)
+	send(t, busy, `{"jsonrpc":"2.0","id":2,"method":"tools/list","params":{}}`)
+	if got := readLineWithTimeout(t, busyLines, 2*time.Second); !strings.Contains(got, `"id":2`) {
+		t.Errorf("listening client got %s, want it still served", got)
+	}
+}
+
+func TestUnixSingleClientReplacesPreviousConnection(t *testing.T) {
+	path := startUnixTransport(t, UnixTransportConfig{SingleClient: true})
+
+	first, firstLines := dialLines(t, path)
+	send(t, first, `{"jsonrpc":"2.0","id":1,"method":"tools/list","params":{}}`)
+	readLineWithTimeout(t, firstLines, 2*time.Second)
+
+	second, secondLines := dialLines(t, path)
+	expectClosedWithin(t, firstLines, 2*time.Second)
+	send(t, second, `{"jsonrpc":"2.0","id":1,"method":"tools/list","params":{}}`)
+	readLineWithTimeout(t, secondLines, 2*time.Second)
+}
+
+func TestUnixPeerCredentialsReachRequestsAndGateConnections(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("peer credentials are read on Linux only")
+	}
+	uid, gid := uint32(os.Getuid()), uint32(os.Getgid())
+
+	path := startUnixTransport(t, UnixTransportConfig{AllowedUIDs: []uint32{uid}})
+	conn, lines := dialLines(t, path)
+	send(t, conn, `{"jsonrpc":"2.0","id":1,"method":"whoami","params":{}}`)
+	if got, want := readLineWithTimeout(t, lines, 2*time.Second), fmt.Sprintf(`"principal":"uid:%d"`, uid); !strings.Contains(got, want) {
+		t.Errorf("whoami = %s, want %s", got, want)
+	}
+
+	path = startUnixTransport(t, UnixTransportConfig{AllowedGIDs: []uint32{gid}})
+	conn, lines = dialLines(t, path)
+	send(t, conn, `{"jsonrpc":"2.0","id":1,"method":"tools/list","params":{}}`)
+	readLineWithTimeout(t, lines, 2*time.Second)
+
+	path = startUnixTransport(t, UnixTransportConfig{AllowedUIDs: []uint32{uid + 1}, AllowedGIDs: []uint32{gid + 1}})
+	_, lines = dialLines(t, path)
+	select {
+	case got, ok := <-lines:
+		if ok {
+			t.Fatalf("refused peer got %s, want to be disconnected unanswered", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("refused peer still connected")
+	}
+}
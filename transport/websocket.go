@@ -0,0 +1,386 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/spirilis/generic-go-mcp/logging"
+)
+
+// WebSocketSubprotocol is the Sec-WebSocket-Protocol the WebSocket binding selects when
+// a client offers it. Offering it is optional: a client that names no subprotocol is
+// served all the same.
+const WebSocketSubprotocol = "mcp"
+
+// websocketGUID is the fixed key suffix of RFC 6455's opening handshake.
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket frame opcodes (RFC 6455 section 5.2).
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+)
+
+// WebSocket close status codes (RFC 6455 section 7.4.1).
+const (
+	wsCloseNormal          = 1000
+	wsCloseGoingAway       = 1001
+	wsCloseProtocolError   = 1002
+	wsCloseUnsupportedData = 1003
+	wsCloseInvalidPayload  = 1007
+	wsCloseTooBig          = 1009
+)
+
+// wsPingInterval is how often a connection is pinged, so intermediaries and client idle
+// timeouts don't close a quiet one (chiefly one holding a subscriptions/listen open).
+const wsPingInterval = 15 * time.Second
+
+// wsCloseError ends a connection's read loop, carrying the status to close it with.
+type wsCloseError struct {
+	code   int
+	reason string
+}
+
+func (e *wsCloseError) Error() string {
+	return fmt.Sprintf("websocket closed: %d %s", e.code, e.reason)
+}
+
+// wsConn is the server end of one WebSocket connection: it reads client frames,
+// reassembling messages and answering pings, and writes unmasked text frames, serialized
+// so a message, a pong and a close never interleave.
+type wsConn struct {
+	conn net.Conn
+	br   *bufio.Reader
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// upgradeWebSocket completes the RFC 6455 opening handshake for r and takes over its
+// connection. If r is not a valid upgrade it answers with an HTTP error and fails.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	if r.Method != http.MethodGet {
+		writeHTTPError(w, http.StatusMethodNotAllowed, nil, InvalidRequest, "WebSocket upgrade requires GET")
+		return nil, errors.New("not a GET")
+	}
+	if !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") {
+		writeHTTPError(w, http.StatusBadRequest, nil, InvalidRequest, "Expected a WebSocket upgrade")
+		return nil, errors.New("not an upgrade")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		writeHTTPError(w, http.StatusUpgradeRequired, nil, InvalidRequest, "Unsupported WebSocket version")
+		return nil, errors.New("unsupported version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if raw, err := base64.StdEncoding.DecodeString(key); err != nil || len(raw) != 16 {
+		writeHTTPError(w, http.StatusBadRequest, nil, InvalidRequest, "Invalid Sec-WebSocket-Key")
+		return nil, errors.New("invalid key")
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		writeHTTPError(w, http.StatusInternalServerError, nil, InternalError, "WebSocket not supported")
+		return nil, errors.New("response cannot be hijacked")
+	}
+
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	// Deadlines the HTTP server set for the request must not bound the connection.
+	conn.SetDeadline(time.Time{})
+
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n"
+	if headerHasToken(r.Header, "Sec-WebSocket-Protocol", WebSocketSubprotocol) {
+		resp += "Sec-WebSocket-Protocol: " + WebSocketSubprotocol + "\r\n"
+	}
+	if _, err := brw.WriteString(resp + "\r\n"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := brw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, br: brw.Reader}, nil
+}
+
+// headerHasToken reports whether any of r's name header values lists token, comparing
+// comma-separated elements case-insensitively.
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// readMessage returns the next complete text message, answering pings on the way. It
+// fails with a *wsCloseError when the client closes the connection or breaks the
+// protocol, and with the underlying error if the connection does.
+func (c *wsConn) readMessage() ([]byte, error) {
+	var msg []byte
+	started := false
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case wsOpPing:
+			if err := c.writeFrame(wsOpPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			return nil, &wsCloseError{code: wsCloseNormal}
+		case wsOpText:
+			if started {
+				return nil, &wsCloseError{code: wsCloseProtocolError, reason: "expected a continuation frame"}
+			}
+			started = true
+		case wsOpBinary:
+			return nil, &wsCloseError{code: wsCloseUnsupportedData, reason: "messages must be text"}
+		case wsOpContinuation:
+			if !started {
+				return nil, &wsCloseError{code: wsCloseProtocolError, reason: "unexpected continuation frame"}
+			}
+		default:
+			return nil, &wsCloseError{code: wsCloseProtocolError, reason: "unknown opcode"}
+		}
+		if len(msg)+len(payload) > maxMessageSize {
+			return nil, &wsCloseError{code: wsCloseTooBig, reason: "message too big"}
+		}
+		msg = append(msg, payload...)
+		if fin {
+			if !utf8.Valid(msg) {
+				return nil, &wsCloseError{code: wsCloseInvalidPayload, reason: "invalid UTF-8"}
+			}
+			return msg, nil
+		}
+	}
+}
+
+// readFrame reads and unmasks one client frame.
+func (c *wsConn) readFrame() (fin bool, op byte, payload []byte, err error) {
+	var h [2]byte
+	if _, err = io.ReadFull(c.br, h[:]); err != nil {
+		return
+	}
+	fin, op = h[0]&0x80 != 0, h[0]&0x0F
+	if h[0]&0x70 != 0 {
+		return fin, op, nil, &wsCloseError{code: wsCloseProtocolError, reason: "reserved bits set"}
+	}
+	if h[1]&0x80 == 0 {
+		return fin, op, nil, &wsCloseError{code: wsCloseProtocolError, reason: "client frames must be masked"}
+	}
+
+	n := uint64(h[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if op >= wsOpClose && (n > 125 || !fin) {
+		return fin, op, nil, &wsCloseError{code: wsCloseProtocolError, reason: "invalid control frame"}
+	}
+	if n > maxMessageSize {
+		return fin, op, nil, &wsCloseError{code: wsCloseTooBig, reason: "message too big"}
+	}
+
+	var mask [4]byte
+	if _, err = io.ReadFull(c.br, mask[:]); err != nil {
+		return
+	}
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(c.br, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, op, payload, nil
+}
+
+// writeFrame writes payload as one unfragmented frame.
+func (c *wsConn) writeFrame(op byte, payload []byte) error {
+	header := make([]byte, 2, 10)
+	header[0] = 0x80 | op
+	switch n := len(payload); {
+	case n <= 125:
+		header[1] = byte(n)
+	case n <= 0xFFFF:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return net.ErrClosed
+	}
+	bufs := net.Buffers{header, payload}
+	_, err := bufs.WriteTo(c.conn)
+	return err
+}
+
+// close sends a close frame with code and reason, unless one was already sent, and
+// closes the connection. Nothing is written after it.
+func (c *wsConn) close(code int, reason string) {
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	payload = append(payload, reason...)
+	c.writeFrame(wsOpClose, payload)
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	c.conn.Close()
+}
+
+// keepAlive pings the client every wsPingInterval until done is closed.
+func (c *wsConn) keepAlive(done <-chan struct{}) {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := c.writeFrame(wsOpPing, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handleWebSocket serves the WebSocket binding: after the same Origin check as /mcp (and
+// behind the same auth middleware, if any), the request is upgraded and the connection
+// carries one JSON-RPC message per text message, in both directions, for as long as it
+// stays open. Messages are dispatched like a stream binding's lines (see streamTransport):
+// concurrently, honoring notifications/cancelled, each under a context derived from the
+// upgrade request's, so an authenticated user is seen by every request on the connection.
+// Closing the connection cancels whatever it still has in flight.
+func (h *MCPHandler) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	if !h.originAllowed(origin) {
+		logging.Warn("WebSocket upgrade rejected: origin not allowed", "origin", origin, "remote_addr", r.RemoteAddr)
+		writeHTTPError(w, http.StatusForbidden, nil, InvalidRequest, "Forbidden: origin not allowed")
+		return
+	}
+
+	conn, err := upgradeWebSocket(w, r)
+	if err != nil {
+		logging.Debug("WebSocket upgrade failed", "error", err, "remote_addr", r.RemoteAddr)
+		return
+	}
+	if !h.trackWebSocket(conn) {
+		conn.close(wsCloseGoingAway, "server stopping")
+		return
+	}
+	defer h.untrackWebSocket(conn)
+	logging.Debug("WebSocket client connected", "remote_addr", r.RemoteAddr)
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	stream := newStreamTransport("websocket")
+	stream.handler = h.handler
+	stream.write = func(msg []byte) error { return conn.writeFrame(wsOpText, msg) }
+
+	done := make(chan struct{})
+	go conn.keepAlive(done)
+
+	var readErr error
+	stream.serveMessages(ctx, func() ([]byte, error) {
+		msg, err := conn.readMessage()
+		if err != nil {
+			readErr = err
+			cancel()
+		}
+		return msg, err
+	})
+	close(done)
+
+	var ce *wsCloseError
+	if errors.As(readErr, &ce) {
+		conn.close(ce.code, ce.reason)
+	} else {
+		conn.close(wsCloseNormal, "")
+	}
+	logging.Debug("WebSocket client disconnected", "remote_addr", r.RemoteAddr, "error", readErr)
+}
+
+// trackWebSocket records conn as open, so Close can close it, unless the handler is
+// already closing.
+func (h *MCPHandler) trackWebSocket(conn *wsConn) bool {
+	h.wsMu.Lock()
+	defer h.wsMu.Unlock()
+	select {
+	case <-h.closing:
+		return false
+	default:
+	}
+	if h.wsConns == nil {
+		h.wsConns = make(map[*wsConn]struct{})
+	}
+	h.wsConns[conn] = struct{}{}
+	h.wg.Add(1)
+	return true
+}
+
+func (h *MCPHandler) untrackWebSocket(conn *wsConn) {
+	h.wsMu.Lock()
+	delete(h.wsConns, conn)
+	h.wsMu.Unlock()
+	h.wg.Done()
+}
+
+// closeWebSockets closes every open WebSocket connection with 1001 (going away).
+// http.Server.Shutdown does not, as it has handed them over.
+func (h *MCPHandler) closeWebSockets() {
+	h.wsMu.Lock()
+	conns := make([]*wsConn, 0, len(h.wsConns))
+	for c := range h.wsConns {
+		conns = append(conns, c)
+	}
+	h.wsMu.Unlock()
+	for _, c := range conns {
+		c.close(wsCloseGoingAway, "server stopping")
+	}
+}
@@ -0,0 +1,241 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// wsTestClient is just enough of an RFC 6455 client to drive the server end.
+type wsTestClient struct {
+	t    *testing.T
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+// dialWebSocket upgrades a connection to srv's /mcp/ws with the given extra headers and
+// returns the HTTP status, plus a client if the upgrade succeeded.
+func dialWebSocket(t *testing.T, srv *httptest.Server, header http.Header) (int, *wsTestClient) {
+	t.Helper()
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	key := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef"))
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/mcp/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if err := req.Write(conn); err != nil {
+		t.Fatalf("write handshake: %v", err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatalf("read handshake: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return resp.StatusCode, nil
+	}
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	if got := resp.Header.Get("Sec-WebSocket-Accept"); got != base64.StdEncoding.EncodeToString(sum[:]) {
+		t.Fatalf("Sec-WebSocket-Accept = %q", got)
+	}
+	return resp.StatusCode, &wsTestClient{t: t, conn: conn, br: br}
+}
+
+// writeFrame writes one masked frame, with masked=false breaking the protocol on purpose.
+func (c *wsTestClient) writeFrame(fin bool, op byte, payload []byte, masked bool) {
+	c.t.Helper()
+	b0 := op
+	if fin {
+		b0 |= 0x80
+	}
+	frame := []byte{b0, 0}
+	switch n := len(payload); {
+	case n <= 125:
+		frame[1] = byte(n)
+	default:
+		frame[1] = 126
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	}
+	body := append([]byte(nil), payload...)
+	if masked {
+		frame[1] |= 0x80
+		mask := []byte{1, 2, 3, 4}
+		frame = append(frame, mask...)
+		for i := range body {
+			body[i] ^= mask[i%4]
+		}
+	}
+	if _, err := c.conn.Write(append(frame, body...)); err != nil {
+		c.t.Fatalf("write frame: %v", err)
+	}
+}
+
+func (c *wsTestClient) send(msg string) {
+	c.writeFrame(true, wsOpText, []byte(msg), true)
+}
+
+// readFrame reads the next frame from the server, which is never masked.
+func (c *wsTestClient) readFrame() (op byte, payload []byte) {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var h [2]byte
+	if _, err := io.ReadFull(c.br, h[:]); err != nil {
+		c.t.Fatalf("read frame: %v", err)
+	}
+	n := int(h[1] & 0x7F)
+	if n == 126 {
+		var ext [2]byte
+		io.ReadFull(c.br, ext[:])
+		n = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		c.t.Fatalf("read payload: %v", err)
+	}
+	return h[0] & 0x0F, payload
+}
+
+// readMessage returns the next text message, skipping pings.
+func (c *wsTestClient) readMessage() string {
+	c.t.Helper()
+	for {
+		op, payload := c.readFrame()
+		switch op {
+		case wsOpText:
+			return string(payload)
+		case wsOpPing:
+			continue
+		default:
+			c.t.Fatalf("got opcode %#x (%q), want a text message", op, payload)
+		}
+	}
+}
+
+// expectClose reads until the server's close frame and checks its status code.
+func (c *wsTestClient) expectClose(code int) {
+	c.t.Helper()
+	for {
+		op, payload := c.readFrame()
+		if op != wsOpClose {
+			continue
+		}
+		if len(payload) < 2 || int(binary.BigEndian.Uint16(payload)) != code {
+			c.t.Fatalf("close payload %q, want status %d", payload, code)
+		}
+		return
+	}
+}
+
+func newWebSocketServer(t *testing.T, config HTTPTransportConfig) (*MCPHandler, *httptest.Server) {
+	t.Helper()
+	config.WebSocketPath = "/mcp/ws"
+	h, err := NewMCPHandler(streamTestHandler{}, config)
+	if err != nil {
+		t.Fatalf("NewMCPHandler: %v", err)
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return h, srv
+}
+
+// bearerAuth admits only requests carrying "Authorization: Bearer ok".
+type bearerAuth struct{}
+
+func (bearerAuth) RegisterRoutes(*http.ServeMux)      {}
+func (bearerAuth) RegisterAdminRoutes(*http.ServeMux) {}
+func (bearerAuth) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer ok" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+func (bearerAuth) UserFromContext(context.Context) (string, string, bool) { return "", "", false }
+
+func TestWebSocketDispatchesMessagesConcurrently(t *testing.T) {
+	_, srv := newWebSocketServer(t, HTTPTransportConfig{})
+	status, c := dialWebSocket(t, srv, http.Header{"Sec-Websocket-Protocol": {"mcp"}})
+	if status != http.StatusSwitchingProtocols {
+		t.Fatalf("upgrade status %d", status)
+	}
+
+	c.send(`{"jsonrpc":"2.0","id":1,"method":"subscriptions/listen","params":{}}`)
+	if got := c.readMessage(); !strings.Contains(got, "notifications/subscriptions/acknowledged") {
+		t.Fatalf("got %s, want the listen acknowledgement", got)
+	}
+	// A fragmented message, with a ping between its fragments, while the listen is open.
+	c.writeFrame(false, wsOpText, []byte(`{"jsonrpc":"2.0","id":2,`), true)
+	c.writeFrame(true, wsOpPing, []byte("hi"), true)
+	c.writeFrame(true, wsOpContinuation, []byte(`"method":"tools/list","params":{}}`), true)
+	if op, payload := c.readFrame(); op != wsOpPong || string(payload) != "hi" {
+		t.Fatalf("got opcode %#x %q, want the pong", op, payload)
+	}
+	if got := c.readMessage(); !strings.Contains(got, `"echo":"tools/list"`) || !strings.Contains(got, `"id":2`) {
+		t.Fatalf("got %s, want the tools/list response", got)
+	}
+
+	c.send(`{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":1}}`)
+	c.writeFrame(true, wsOpClose, []byte{0x03, 0xE8}, true)
+	c.expectClose(wsCloseNormal)
+}
+
+func TestWebSocketUpgradeChecksOriginAndAuth(t *testing.T) {
+	_, srv := newWebSocketServer(t, HTTPTransportConfig{AuthService: bearerAuth{}})
+
+	if status, _ := dialWebSocket(t, srv, nil); status != http.StatusUnauthorized {
+		t.Errorf("unauthenticated upgrade status %d, want 401", status)
+	}
+	status, _ := dialWebSocket(t, srv, http.Header{"Authorization": {"Bearer ok"}, "Origin": {"https://evil.example"}})
+	if status != http.StatusForbidden {
+		t.Errorf("foreign-origin upgrade status %d, want 403", status)
+	}
+	status, c := dialWebSocket(t, srv, http.Header{"Authorization": {"Bearer ok"}, "Origin": {"http://localhost:3000"}})
+	if status != http.StatusSwitchingProtocols {
+		t.Fatalf("authenticated upgrade status %d, want 101", status)
+	}
+	c.send(`{"jsonrpc":"2.0","id":1,"method":"tools/list","params":{}}`)
+	c.readMessage()
+}
+
+func TestWebSocketClosesOnProtocolErrorAndClose(t *testing.T) {
+	h, srv := newWebSocketServer(t, HTTPTransportConfig{})
+
+	_, c := dialWebSocket(t, srv, nil)
+	c.writeFrame(true, wsOpText, []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`), false)
+	c.expectClose(wsCloseProtocolError)
+
+	_, c = dialWebSocket(t, srv, nil)
+	c.send(`{"jsonrpc":"2.0","id":1,"method":"subscriptions/listen","params":{}}`)
+	c.readMessage()
+	closed := make(chan error, 1)
+	go func() { closed <- h.Close() }()
+	c.expectClose(wsCloseGoingAway)
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Errorf("Close: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close did not return after closing the WebSocket")
+	}
+}